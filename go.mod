@@ -51,7 +51,7 @@ require (
 	gopkg.in/yaml.v2 v2.2.2
 	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 	k8s.io/api v0.0.0-20190515023547-db5a9d1c40eb
-	k8s.io/apiextensions-apiserver v0.0.0-20190515024537-2fd0e9006049 // indirect
+	k8s.io/apiextensions-apiserver v0.0.0-20190515024537-2fd0e9006049
 	k8s.io/apimachinery v0.0.0-20190515023456-b74e4c97951f
 	k8s.io/apiserver v0.0.0-20190515064100-fc28ef5782df // indirect
 	k8s.io/cli-runtime v0.0.0-20190515024640-178667528169
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -9,14 +10,22 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog"
 
+	"github.com/mumoshu/helm-x/pkg/diff"
 	"github.com/mumoshu/helm-x/pkg/helmx"
+	"github.com/mumoshu/helm-x/pkg/images"
+	"github.com/mumoshu/helm-x/pkg/manifest"
+	"github.com/mumoshu/helm-x/pkg/notify"
 	"github.com/mumoshu/helm-x/pkg/releasetool"
+	"github.com/mumoshu/helm-x/pkg/validation"
 
 	"gopkg.in/yaml.v3"
 )
@@ -62,7 +71,7 @@ func main() {
 
 func NewRootCmd(r *helmx.Runner) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     fmt.Sprintf("%s [apply|diff|template|dump|adopt]", CommandName),
+		Use:     fmt.Sprintf("%s [apply|diff|plan|template|dump|adopt|convert-release|images|resources]", CommandName),
 		Short:   "Turn Kubernetes manifests, Kustomization, Helm Chart into Helm release. Sidecar injection supported.",
 		Long:    ``,
 		Version: Version,
@@ -73,9 +82,13 @@ func NewRootCmd(r *helmx.Runner) *cobra.Command {
 	cmd.AddCommand(NewApplyCommand(r, out, "apply", true))
 	cmd.AddCommand(NewApplyCommand(r, out, "upgrade", false))
 	cmd.AddCommand(NewDiffCommand(r, out))
+	cmd.AddCommand(NewPlanCommand(r, out))
 	cmd.AddCommand(NewTemplateCommand(r, out))
 	cmd.AddCommand(NewUtilDumpRelease(r, out))
 	cmd.AddCommand(NewAdopt(r, out))
+	cmd.AddCommand(NewConvertReleaseCommand(r, out))
+	cmd.AddCommand(NewImagesCommand(r, out))
+	cmd.AddCommand(NewResourcesCommand(r, out))
 
 	return cmd
 }
@@ -93,6 +106,10 @@ func NewApplyCommand(r *helmx.Runner, out io.Writer, cmdName string, installByDe
 	upOpts := &helmx.UpgradeOpts{Out: out}
 	pathOptions := clientcmd.NewDefaultPathOptions()
 
+	var planFile string
+
+	var concurrency int
+
 	cmd := &cobra.Command{
 		Use:   fmt.Sprintf("%s [RELEASE] [DIR_OR_CHART]", cmdName),
 		Short: "Install or upgrade the helm release from the directory or the chart specified",
@@ -108,42 +125,85 @@ It's also better in regard to security and reproducibility, as creating a helm r
 When DIR_OR_CHART is a local directory containing Kubernetes manifests, this copies all the manifests into a temporary directory, and turns it into a local Helm chart by generating a Chart.yaml whose version and appVersion are set to the value of the --version flag.
 
 When DIR_OR_CHART contains kustomization.yaml, this runs "kustomize build" to generate manifests, and then run injectors to update manifests, and install the temporary chart by running "helm upgrade --install".
+
+When --plan is specified, this installs the chart and the values saved in the plan made by "helm x plan" instead, and RELEASE and DIR_OR_CHART can be omitted.
+
+When RELEASE and DIR_OR_CHART are omitted and -f points to a releases file, this installs or upgrades all the releases in the file, up to --concurrency releases in parallel, and prints the summary at the end.
 `,
 		Args: func(cmd *cobra.Command, args []string) error {
+			if releasesFileFrom(args, upOpts.ChartifyOpts) != "" {
+				return nil
+			}
+			if planFile != "" {
+				if len(args) > 1 {
+					return errors.New("accepts at most one argument with --plan")
+				}
+				return nil
+			}
 			if len(args) != 2 {
 				return errors.New("requires two arguments")
 			}
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			release := args[0]
-			dir := args[1]
+			resolveScopesFromCluster(r)
 
-			tempLocalChartDir, err := r.Chartify(release, dir, upOpts.ChartifyOpts)
-			if err != nil {
+			if file := releasesFileFrom(args, upOpts.ChartifyOpts); file != "" {
 				cmd.SilenceUsage = true
-				return err
+				return applyReleases(r, file, upOpts, pathOptions, concurrency, out)
 			}
 
-			if !upOpts.Debug {
-				defer os.RemoveAll(tempLocalChartDir)
+			var release, source, tempLocalChartDir string
+
+			if planFile != "" {
+				if len(upOpts.ValuesFiles) > 0 || len(upOpts.SetValues) > 0 {
+					return errors.New("--values and --set can't be used with --plan, as the values are fixed in the plan")
+				}
+
+				if upOpts.ConvertDeprecatedAPIs {
+					return errors.New("--convert-deprecated-apis can't be used with --plan, as the manifests are fixed in the plan")
+				}
+
+				if upOpts.PinDigests != "" {
+					return errors.New("--pin-digests can't be used with --plan, as the manifests are fixed in the plan")
+				}
+
+				plan, err := r.OpenPlan(planFile, *upOpts)
+				if err != nil {
+					cmd.SilenceUsage = true
+					return err
+				}
+				defer os.RemoveAll(plan.Dir())
+
+				if len(args) == 1 && args[0] != plan.Release {
+					return fmt.Errorf("plan %s was made for release %s, not %s", planFile, plan.Release, args[0])
+				}
+
+				release = plan.Release
+				source = planFile
+				tempLocalChartDir = plan.ChartDir()
+				upOpts.ValuesFiles = []string{plan.ValuesFile()}
+				upOpts.Namespace = plan.Namespace
 			} else {
-				klog.Infof("helm chart has been written to %s for you to see. please remove it afterwards", tempLocalChartDir)
-			}
+				release = args[0]
+				source = args[1]
 
-			if len(upOpts.Adopt) > 0 {
-				if err := r.Adopt(
-					release,
-					upOpts.Adopt,
-					pathOptions,
-					helmx.TillerNamespace(upOpts.TillerNamespace),
-					helmx.Namespace(upOpts.Namespace),
-				); err != nil {
+				var err error
+
+				tempLocalChartDir, err = r.Chartify(release, source, upOpts.ChartifyOpts)
+				if err != nil {
+					cmd.SilenceUsage = true
 					return err
 				}
+
+				if !upOpts.Debug {
+					defer os.RemoveAll(tempLocalChartDir)
+				} else {
+					klog.Infof("helm chart has been written to %s for you to see. please remove it afterwards", tempLocalChartDir)
+				}
 			}
 
-			if err := r.Upgrade(release, tempLocalChartDir, *upOpts); err != nil {
+			if err := atomicUpgrade(r, release, source, tempLocalChartDir, upOpts, pathOptions, out); err != nil {
 				cmd.SilenceUsage = true
 				return err
 			}
@@ -155,17 +215,34 @@ When DIR_OR_CHART contains kustomization.yaml, this runs "kustomize build" to ge
 
 	upOpts.ChartifyOpts = chartifyOptsFromFlags(f)
 	upOpts.ClientOpts = clientOptsFromFlags(f)
+	upOpts.ValidateOpts = validateOptsFromFlags(f)
+	upOpts.Notify = notifyOptsFromFlags(f, "apply and --atomic rollback")
 
 	//f.StringVar(&u.release, "name", "", "release name (default \"release-name\")")
-	f.StringVar(&upOpts.Timeout, "timeout", "300", "time in seconds to wait for any individual Kubernetes operation (like Jobs for hooks)")
+	f.StringVar(&upOpts.Timeout, "timeout", "300", "time in seconds to wait for any individual Kubernetes operation (like Jobs for hooks), and for the resources to get ready with --wait")
 
 	f.BoolVar(&upOpts.DryRun, "dry-run", false, "simulate an upgrade")
 
+	f.BoolVar(&upOpts.Wait, "wait", false, "wait until all the Deployments, StatefulSets, DaemonSets, Jobs, PersistentVolumeClaims and LoadBalancer Services in the release get ready, for up to --timeout seconds")
+	f.BoolVar(&upOpts.Tillerless, "tillerless", false, "apply the resources with kubectl and write the release record into the tiller storage by itself, without tiller. hooks are run and the resources removed since the previous revision are deleted as tiller does. helm 2 only")
+	f.BoolVar(&upOpts.ServerSide, "server-side", false, "apply the resources with server-side apply under the helm-x field manager and then write the release record as --tillerless does. field-ownership conflicts are reported per resource. helm 2 only")
+	f.BoolVar(&upOpts.ForceConflicts, "force-conflicts", false, "take over the fields owned by other field managers on --server-side")
+
 	f.BoolVar(&upOpts.Install, "install", installByDefault, "install the release if missing")
 
 	f.BoolVar(&upOpts.ResetValues, "reset-values", false, "reset the values to the ones built into the chart and merge in any new values")
 
-	f.StringSliceVarP(&upOpts.Adopt, "adopt", "", []string{}, "adopt existing k8s resources before apply")
+	f.StringSliceVarP(&upOpts.Adopt, "adopt", "", []string{}, "adopt existing k8s resources before apply. Each resource is represented as `kind/name` or `namespace/kind/name`")
+	f.BoolVar(&upOpts.WatchEvents, "watch-events", false, "print the events of the resources in the release as they arrive during the upgrade and --wait, colored by type, followed by the summary of the warning events")
+	f.BoolVar(&upOpts.NoColor, "no-color", false, "remove colors from the events printed with --watch-events")
+	f.IntVar(&upOpts.Retries, "retries", 0, "number of times to retry helm upgrade when it fails with transient errors like API timeouts, etcd leader changes and another operation in progress on the release")
+	f.DurationVar(&upOpts.RetryBackoff, "retry-backoff", 2*time.Second, "time to wait before the first retry with --retries, doubled after each retry")
+	f.BoolVar(&upOpts.AutoAdopt, "auto-adopt", false, "adopt existing k8s resources that made the upgrade fail with \"already exists\", and retry the upgrade once. with helm 3, the resources are labeled and annotated as owned by the release, which requires helm 3.2 or greater")
+	f.IntVar(&concurrency, "concurrency", 1, "number of releases in the releases file to be processed in parallel. 0 processes all of them in parallel")
+	f.StringVar(&upOpts.PinDigests, "pin-digests", "", "YAML file mapping images like nginx:1.17 to their digests under the digests key. the rendered images found in the file are rewritten to REPOSITORY@DIGEST before apply")
+	f.StringVar(&upOpts.PolicyFile, "policy-file", "", "YAML file containing the policy rules to be checked against the rendered resources before apply. violations of warn rules are printed, and the ones of deny rules refuse the apply")
+	f.StringVar(&planFile, "plan", "", "install the chart and the values saved in the plan archive made by \"helm x plan\". refuses to apply when the release has changed since the plan was made")
+	f.BoolVar(&upOpts.Atomic, "atomic", false, "roll the release back to the previous deployed revision when the upgrade or --wait fails. on the first install, the release is uninstalled. with helm 2, the resources that existed before the install are left unmanaged as before. can't be used with --tillerless or --server-side, or with --auto-adopt on helm 3")
 
 	f.StringVar(&pathOptions.LoadingRules.ExplicitPath, pathOptions.ExplicitFileFlag, pathOptions.LoadingRules.ExplicitPath, "use a particular kubeconfig file")
 
@@ -178,6 +255,8 @@ func NewTemplateCommand(r *helmx.Runner, out io.Writer) *cobra.Command {
 
 	var release string
 
+	var concurrency int
+
 	cmd := &cobra.Command{
 		Use:   "template [DIR_OR_CHART]",
 		Short: "Print Kubernetes manifests that would be generated by `helm x apply`",
@@ -190,14 +269,24 @@ When DIR_OR_CHART is a local helm chart, this copies it into a temporary directo
 When DIR_OR_CHART is a local directory containing Kubernetes manifests, this copies all the manifests into a temporary directory, and turns it into a local Helm chart by generating a Chart.yaml whose version and appVersion are set to the value of the --version flag.
 
 When DIR_OR_CHART contains kustomization.yaml, this runs "kustomize build" to generate manifests, and then run injectors to update manifests, and prints the results.
+
+When DIR_OR_CHART is omitted and -f points to a releases file, this prints the manifests of all the releases in the file.
 `,
 		Args: func(cmd *cobra.Command, args []string) error {
+			if releasesFileFrom(args, templateOpts.ChartifyOpts) != "" {
+				return nil
+			}
 			if len(args) != 1 {
 				return errors.New("requires one argument")
 			}
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if file := releasesFileFrom(args, templateOpts.ChartifyOpts); file != "" {
+				cmd.SilenceUsage = true
+				return templateReleases(r, file, templateOpts, concurrency, out)
+			}
+
 			dir := args[0]
 
 			tempLocalChartDir, err := r.Chartify(release, dir, templateOpts.ChartifyOpts)
@@ -212,6 +301,32 @@ When DIR_OR_CHART contains kustomization.yaml, this runs "kustomize build" to ge
 				klog.Infof("helm chart has been written to %s for you to see. please remove it afterwards", tempLocalChartDir)
 			}
 
+			if templateOpts.PinDigests != "" {
+				if err := r.PinDigests(tempLocalChartDir, templateOpts.PinDigests, os.Stderr); err != nil {
+					cmd.SilenceUsage = true
+					return err
+				}
+			}
+
+			if err := r.CheckDeprecatedAPIs(tempLocalChartDir, templateOpts.ValidateOpts, os.Stderr); err != nil {
+				cmd.SilenceUsage = true
+				return err
+			}
+
+			if templateOpts.Validate {
+				if err := r.ValidateRelease(release, tempLocalChartDir, templateOpts.ChartifyOpts, templateOpts.ValidateOpts); err != nil {
+					cmd.SilenceUsage = true
+					return err
+				}
+			}
+
+			if templateOpts.PolicyFile != "" {
+				if err := r.CheckPolicy(release, tempLocalChartDir, templateOpts.PolicyFile, templateOpts.ChartifyOpts, os.Stderr); err != nil {
+					cmd.SilenceUsage = true
+					return err
+				}
+			}
+
 			if err := r.Render(release, tempLocalChartDir, *templateOpts); err != nil {
 				cmd.SilenceUsage = true
 				return err
@@ -223,25 +338,552 @@ When DIR_OR_CHART contains kustomization.yaml, this runs "kustomize build" to ge
 	f := cmd.Flags()
 
 	templateOpts.ChartifyOpts = chartifyOptsFromFlags(f)
+	templateOpts.ValidateOpts = validateOptsFromFlags(f)
 
 	f.StringVar(&release, "name", "release-name", "release name (default \"release-name\")")
+	f.IntVar(&concurrency, "concurrency", 1, "number of releases in the releases file to be rendered in parallel. 0 renders all of them in parallel")
+	f.StringVar(&templateOpts.PinDigests, "pin-digests", "", "YAML file mapping images like nginx:1.17 to their digests under the digests key. the rendered images found in the file are rewritten to REPOSITORY@DIGEST")
+	f.StringVar(&templateOpts.PolicyFile, "policy-file", "", "YAML file containing the policy rules to be checked against the rendered resources. violations of warn rules are printed to stderr, and the ones of deny rules fail the command")
 	f.BoolVar(&templateOpts.IncludeReleaseConfigmap, "include-release-configmap", false, "turn the result into a proper helm release, by removing hooks from the manifest, and including a helm release configmap/secret that should otherwise created by \"helm [upgrade|install]\"")
 	f.BoolVar(&templateOpts.IncludeReleaseSecret, "include-release-secret", false, "turn the result into a proper helm release, by removing hooks from the manifest, and including a helm release configmap/secret that should otherwise created by \"helm [upgrade|install]\"")
 
 	return cmd
 }
 
+// NewPlanCommand represents the plan command
+func NewPlanCommand(r *helmx.Runner, out io.Writer) *cobra.Command {
+	planOpts := &helmx.PlanOpts{Out: out}
+
+	cmd := &cobra.Command{
+		Use:   "plan [RELEASE] [DIR_OR_CHART]",
+		Short: "Save what `helm x apply` would install into a plan archive, to be applied later with `helm x apply --plan`",
+		Long: `Save what ` + "`helm x apply`" + ` would install into a plan archive, to be applied later with ` + "`helm x apply --plan`" + `
+
+The plan archive contains the chart generated from DIR_OR_CHART in the same way as "helm x apply" does, the values merged from --values and --set, the rendered manifest, the diff against the deployed release, and the checksum of them along with the release, the namespace and the revision the plan is made against.
+
+"helm x apply --plan" installs exactly the chart and the values in the plan, and refuses to do so when the plan has been modified or the release has changed since the plan was made. So what has been reviewed is what gets deployed.
+
+The checksum in the plan archive only catches accidental corruption, as anyone who can modify the archive can recompute it. To detect tampering, record the SHA256 checksum of the archive printed at the end, and verify it with sha256sum before applying.
+
+The plan archive contains the values and the rendered manifest including Secrets, so it is written with mode 0600.
+`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("requires two arguments")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resolveScopesFromCluster(r)
+
+			release := args[0]
+			dir := args[1]
+
+			tempDir, err := r.Chartify(release, dir, planOpts.ChartifyOpts)
+			if err != nil {
+				cmd.SilenceUsage = true
+				return err
+			}
+
+			if planOpts.Debug {
+				klog.Infof("helm chart has been written to %s for you to see. please remove it afterwards", tempDir)
+			} else {
+				defer os.RemoveAll(tempDir)
+			}
+
+			if err := r.Plan(release, tempDir, *planOpts); err != nil {
+				cmd.SilenceUsage = true
+				return err
+			}
+
+			return nil
+		},
+	}
+	f := cmd.Flags()
+
+	planOpts.ChartifyOpts = chartifyOptsFromFlags(f)
+	planOpts.ClientOpts = clientOptsFromFlags(f)
+
+	f.StringVarP(&planOpts.File, "output", "o", "plan.tgz", "path to the plan archive to be written")
+
+	return cmd
+}
+
+// resolveScopesFromCluster makes the cluster tell which kinds are cluster-scoped, like ClusterIssuer, in the commands
+// that talk to the cluster anyway. The other commands rely on the well-known kinds and the CRDs in the manifests, so
+// that they work without access to the cluster
+func resolveScopesFromCluster(r *helmx.Runner) {
+	manifest.SetScopeResolver(r.ClusterScopedKinds)
+}
+
+// releasesFileFrom returns the path to the releases file, when it is given with -f without positional arguments
+func releasesFileFrom(args []string, o *chartify.ChartifyOpts) string {
+	if len(args) > 0 || len(o.ValuesFiles) != 1 || !helmx.IsReleasesFile(o.ValuesFiles[0]) {
+		return ""
+	}
+	return o.ValuesFiles[0]
+}
+
+// commonChartifyOpts returns the options shared by all the releases in the releases file, that is given with -f
+func commonChartifyOpts(o *chartify.ChartifyOpts) *chartify.ChartifyOpts {
+	common := *o
+	common.ValuesFiles = nil
+	return &common
+}
+
+// applyReleases installs or upgrades all the releases in the releases file. The outputs are printed in the order of
+// the releases, so that the outputs of the releases applied concurrently don't interleave
+func applyReleases(r *helmx.Runner, file string, upOpts *helmx.UpgradeOpts, pathOptions *clientcmd.PathOptions, concurrency int, out io.Writer) error {
+	releases, err := helmx.LoadReleasesFile(file)
+	if err != nil {
+		return err
+	}
+
+	common := *upOpts
+	common.ChartifyOpts = commonChartifyOpts(upOpts.ChartifyOpts)
+
+	outputs := map[string]*bytes.Buffer{}
+	for _, rel := range releases.Releases {
+		outputs[rel.Name] = &bytes.Buffer{}
+	}
+
+	results, err := helmx.RunReleases(releases.Releases, concurrency, func(rel helmx.ReleaseSpec) (string, error) {
+		o := rel.UpgradeOpts(common)
+		o.Out = outputs[rel.Name]
+
+		chart, err := r.Chartify(rel.Name, rel.Chart, o.ChartifyOpts)
+		if err != nil {
+			return "", err
+		}
+
+		if !o.Debug {
+			defer os.RemoveAll(chart)
+		} else {
+			klog.Infof("helm chart for release %s has been written to %s for you to see. please remove it afterwards", rel.Name, chart)
+		}
+
+		if err := atomicUpgrade(r, rel.Name, rel.Chart, chart, o, pathOptions, o.Out); err != nil {
+			return "", err
+		}
+
+		if o.DryRun {
+			return "simulated", nil
+		}
+
+		return "applied", nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range releases.Releases {
+		if outputs[rel.Name].Len() > 0 {
+			fmt.Fprintf(out, "release %s:\n%s\n", rel.Name, outputs[rel.Name].String())
+		}
+	}
+
+	return helmx.PrintReleaseSummary(out, results)
+}
+
+// diffReleases shows the diff of all the releases in the releases file, and returns true when any of them has changes
+// and DetailedExitcode is set. The diffs are printed in the order of the releases
+func diffReleases(r *helmx.Runner, file string, diffOpts *helmx.DiffOpts, concurrency int, out io.Writer) (bool, error) {
+	if diffOpts.ReportFile != "" {
+		return false, errors.New("--report-file can't be used with a releases file")
+	}
+
+	releases, err := helmx.LoadReleasesFile(file)
+	if err != nil {
+		return false, err
+	}
+
+	common := commonChartifyOpts(diffOpts.ChartifyOpts)
+
+	outputs := map[string]*bytes.Buffer{}
+	for _, rel := range releases.Releases {
+		outputs[rel.Name] = &bytes.Buffer{}
+	}
+
+	results, err := helmx.RunReleases(releases.Releases, concurrency, func(rel helmx.ReleaseSpec) (string, error) {
+		o := *diffOpts
+		o.ChartifyOpts = rel.ChartifyOpts(common)
+		o.Out = outputs[rel.Name]
+		// Always detect changes to show them in the summary
+		o.DetailedExitcode = true
+
+		chart, err := r.Chartify(rel.Name, rel.Chart, o.ChartifyOpts)
+		if err != nil {
+			return "", err
+		}
+
+		if o.Debug {
+			klog.Infof("helm chart for release %s has been written to %s for you to see. please remove it afterwards", rel.Name, chart)
+		} else {
+			defer os.RemoveAll(chart)
+		}
+
+		changed, err := diffRelease(r, rel.Name, rel.Chart, chart, &o, o.Out)
+		if err != nil {
+			return "", err
+		}
+
+		if changed {
+			return "changed", nil
+		}
+
+		return "unchanged", nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	var changed bool
+
+	for i, rel := range releases.Releases {
+		if outputs[rel.Name].Len() > 0 {
+			fmt.Fprintf(out, "release %s:\n%s\n", rel.Name, outputs[rel.Name].String())
+		}
+
+		if results[i].Status == "changed" {
+			changed = true
+		}
+	}
+
+	return changed && diffOpts.DetailedExitcode, helmx.PrintReleaseSummary(out, results)
+}
+
+// templateReleases prints the manifests of all the releases in the releases file, in the order of the releases.
+// The summary is printed to stderr to not break the manifests
+func templateReleases(r *helmx.Runner, file string, templateOpts *helmx.RenderOpts, concurrency int, out io.Writer) error {
+	releases, err := helmx.LoadReleasesFile(file)
+	if err != nil {
+		return err
+	}
+
+	common := commonChartifyOpts(templateOpts.ChartifyOpts)
+
+	outputs := map[string]*bytes.Buffer{}
+	for _, rel := range releases.Releases {
+		outputs[rel.Name] = &bytes.Buffer{}
+	}
+
+	results, err := helmx.RunReleases(releases.Releases, concurrency, func(rel helmx.ReleaseSpec) (string, error) {
+		o := *templateOpts
+		o.ChartifyOpts = rel.ChartifyOpts(common)
+		o.Out = outputs[rel.Name]
+
+		chart, err := r.Chartify(rel.Name, rel.Chart, o.ChartifyOpts)
+		if err != nil {
+			return "", err
+		}
+
+		if o.Debug {
+			klog.Infof("helm chart for release %s has been written to %s for you to see. please remove it afterwards", rel.Name, chart)
+		} else {
+			defer os.RemoveAll(chart)
+		}
+
+		if o.PinDigests != "" {
+			if err := r.PinDigests(chart, o.PinDigests, os.Stderr); err != nil {
+				return "", err
+			}
+		}
+
+		if err := r.CheckDeprecatedAPIs(chart, o.ValidateOpts, os.Stderr); err != nil {
+			return "", err
+		}
+
+		if o.Validate {
+			if err := r.ValidateRelease(rel.Name, chart, o.ChartifyOpts, o.ValidateOpts); err != nil {
+				return "", err
+			}
+		}
+
+		if o.PolicyFile != "" {
+			if err := r.CheckPolicy(rel.Name, chart, o.PolicyFile, o.ChartifyOpts, os.Stderr); err != nil {
+				return "", err
+			}
+		}
+
+		if err := r.Render(rel.Name, chart, o); err != nil {
+			return "", err
+		}
+
+		return "rendered", nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range releases.Releases {
+		fmt.Fprint(out, outputs[rel.Name].String())
+	}
+
+	return helmx.PrintReleaseSummary(os.Stderr, results)
+}
+
+// atomicUpgrade pins the images to digests, checks the deprecated APIs, validates the resources and checks the policy if enabled, and runs upgrade, and rolls the release back to the previous deployed revision
+// on failure with --atomic
+func atomicUpgrade(r *helmx.Runner, release, source, chart string, upOpts *helmx.UpgradeOpts, pathOptions *clientcmd.PathOptions, out io.Writer) (err error) {
+	if err := upOpts.CheckOptions(r.IsHelm3()); err != nil {
+		return err
+	}
+
+	notifier, err := upOpts.Notify.Notifier()
+	if err != nil {
+		return err
+	}
+
+	n := r.NewNotification(notify.CommandApply, release, source, chart, upOpts.ChartifyOpts, upOpts.ClientOpts)
+	n.DryRun = upOpts.DryRun
+
+	defer func() {
+		r.Notify(notifier, n, err, out)
+	}()
+
+	if upOpts.PinDigests != "" {
+		if err := r.PinDigests(chart, upOpts.PinDigests, out); err != nil {
+			return err
+		}
+	}
+
+	if err := r.CheckDeprecatedAPIs(chart, upOpts.ValidateOpts, out); err != nil {
+		return err
+	}
+
+	// The chart is rendered at most once per apply, after the templates are rewritten above, and the manifest is shared
+	// by the checks, the rollback point, the watcher and the wait instead of each of them running `helm template`
+	var rendered string
+	render := func() (string, error) {
+		if rendered == "" {
+			m, err := r.Template(release, chart, upOpts.ChartifyOpts)
+			if err != nil {
+				return "", err
+			}
+			rendered = m
+		}
+		return rendered, nil
+	}
+
+	if upOpts.Validate {
+		m, err := render()
+		if err != nil {
+			return err
+		}
+
+		if err := r.ValidateManifest(m, upOpts.Namespace, upOpts.ValidateOpts); err != nil {
+			return err
+		}
+	}
+
+	if upOpts.PolicyFile != "" {
+		m, err := render()
+		if err != nil {
+			return err
+		}
+
+		if err := r.CheckManifestPolicy(release, m, upOpts.PolicyFile, upOpts.Namespace, out); err != nil {
+			return err
+		}
+	}
+
+	if notifier != nil {
+		n.Diff = diffSummary(release, func() (*diff.Summary, error) {
+			m, err := render()
+			if err != nil {
+				return nil, err
+			}
+			return r.ManifestDiffSummary(release, m, &helmx.DiffOpts{ChartifyOpts: upOpts.ChartifyOpts, ClientOpts: upOpts.ClientOpts})
+		})
+	}
+
+	var rollbackPoint *helmx.RollbackPoint
+	if upOpts.Atomic {
+		m, err := render()
+		if err != nil {
+			return err
+		}
+
+		rollbackPoint, err = r.NewRollbackPoint(release, m, *upOpts)
+		if err != nil {
+			return err
+		}
+	}
+
+	stopWatching := func() {}
+	if upOpts.WatchEvents && !upOpts.DryRun {
+		m, err := render()
+		if err != nil {
+			return err
+		}
+
+		o := *upOpts
+
+		w, stop, err := r.WatchEvents(release, m, o)
+		if err != nil {
+			return err
+		}
+
+		// Everything is written through the watcher's writer until it stops, not to interleave with the events
+		o.Out = w
+		upOpts, out, stopWatching = &o, w, stop
+	}
+
+	// Copied not to leak the manifest into the options shared by the releases in the releases file. The upgrade
+	// renders the chart by itself when nothing above has rendered it
+	o := *upOpts
+	o.Manifest = rendered
+	upOpts = &o
+
+	err = r.UpgradeWithAdoption(release, chart, *upOpts, pathOptions)
+
+	// Stopped before the rollback, so that the summary of the warning events explains why the upgrade failed
+	stopWatching()
+
+	if err != nil {
+		if !upOpts.Atomic || upOpts.DryRun {
+			return err
+		}
+
+		rollback := r.NewNotification(notify.CommandRollback, release, source, chart, upOpts.ChartifyOpts, upOpts.ClientOpts)
+
+		report, rollbackErr := r.RollbackFailedUpgrade(release, rollbackPoint, *upOpts)
+		for _, l := range report {
+			fmt.Fprintln(out, l)
+		}
+
+		r.Notify(notifier, rollback, rollbackErr, out)
+
+		if rollbackErr != nil {
+			return fmt.Errorf("%v\nrollback failed: %v", err, rollbackErr)
+		}
+
+		return fmt.Errorf("%v\nrelease %s has been rolled back as --atomic is set", err, release)
+	}
+
+	return nil
+}
+
+// diffSummary returns the summary of the changes to the release computed by summarize for notifications, or nil when
+// it can't be computed. The error is only logged, as the summary is optional
+func diffSummary(release string, summarize func() (*diff.Summary, error)) *diff.Summary {
+	s, err := summarize()
+	if err != nil {
+		klog.Warningf("unable to compute the diff summary of release %s for notifications: %v", release, err)
+		return nil
+	}
+	return s
+}
+
+// diffRelease checks the temporary chart and shows the diff of the release, returning true when the diff succeeds and
+// changes are detected with DetailedExitcode. The outcome is notified to the sinks in diffOpts.Notify
+func diffRelease(r *helmx.Runner, release, source, chart string, diffOpts *helmx.DiffOpts, out io.Writer) (changed bool, err error) {
+	notifier, err := diffOpts.Notify.Notifier()
+	if err != nil {
+		return false, err
+	}
+
+	n := r.NewNotification(notify.CommandDiff, release, source, chart, diffOpts.ChartifyOpts, diffOpts.ClientOpts)
+
+	defer func() {
+		r.Notify(notifier, n, err, out)
+	}()
+
+	if diffOpts.PinDigests != "" {
+		if err := r.PinDigests(chart, diffOpts.PinDigests, out); err != nil {
+			return false, err
+		}
+	}
+
+	if err := r.CheckDeprecatedAPIs(chart, diffOpts.ValidateOpts, out); err != nil {
+		return false, err
+	}
+
+	if diffOpts.Validate {
+		if err := r.ValidateRelease(release, chart, diffOpts.ChartifyOpts, diffOpts.ValidateOpts); err != nil {
+			return false, err
+		}
+	}
+
+	if notifier != nil {
+		n.Diff = diffSummary(release, func() (*diff.Summary, error) {
+			return r.DiffSummary(release, chart, diffOpts)
+		})
+	}
+
+	return r.Diff(release, chart, diffOpts)
+}
+
 // NewDiffCommand represents the diff command
 func NewDiffCommand(r *helmx.Runner, out io.Writer) *cobra.Command {
 	diff := newDiffCommand(r, "diff", out)
 	upgrade := newDiffCommand(r, "upgrade", out)
 	diff.AddCommand(upgrade)
+	diff.AddCommand(newDiffLocalCommand(r, out))
 	return diff
 }
 
+func newDiffLocalCommand(r *helmx.Runner, out io.Writer) *cobra.Command {
+	diffOpts := &helmx.DiffLocalOpts{Out: out}
+
+	var common, a, b *chartify.ChartifyOpts
+
+	cmd := &cobra.Command{
+		Use:   "local [SRC_A] [SRC_B]",
+		Short: "Show a diff between the manifests rendered from two sources, without accessing the cluster",
+		Long: `Show a diff between the manifests rendered from two sources, without accessing the cluster.
+
+Each source is chartified and rendered with "helm template" as ` + "`helm x template`" + ` does, and the results are compared resource by resource.
+
+A source can be anything accepted by ` + "`helm x template`" + `, or a directory or chart at a git ref in the format of git:REF:PATH like "git:origin/master:overlays/production". PATH is relative to the current directory and defaults to it.
+
+Flags like --values, --set and --inject apply to both sources, and the ones prefixed with --a- and --b- like --a-values and --b-set apply to SRC_A and SRC_B respectively.
+`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("requires two arguments")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			diffOpts.A = mergeChartifyOpts(common, a)
+			diffOpts.B = mergeChartifyOpts(common, b)
+
+			changed, err := r.DiffLocal(args[0], args[1], diffOpts)
+			if err != nil {
+				cmd.SilenceUsage = true
+				return err
+			}
+			if changed {
+				os.Exit(2)
+			}
+
+			return nil
+		},
+	}
+	f := cmd.Flags()
+
+	common = chartifyOptsFromFlags(f)
+	a = sourceChartifyOptsFromFlags(f, "a", "SRC_A")
+	b = sourceChartifyOptsFromFlags(f, "b", "SRC_B")
+
+	f.StringVar(&diffOpts.Release, "name", "release-name", "the release name passed to helm template")
+	f.BoolVar(&diffOpts.DetailedExitcode, "detailed-exitcode", false, "return a non-zero exit code when there are changes")
+	f.IntVar(&diffOpts.Context, "context", 3, "output NUM lines of context around changes")
+	f.BoolVar(&diffOpts.NoColor, "no-color", false, "remove colors from the output")
+	f.StringVar(&diffOpts.Output, "output", helmx.DiffOutputText, "the output format. either `text`, `json`, `yaml`, `markdown` or `html`")
+	f.StringVar(&diffOpts.ReportFile, "report-file", "", "write the diff to the file instead of stdout. the exit code keeps its meaning")
+	f.StringArrayVar(&diffOpts.Ignore, "ignore", nil, "ignore changes in the fields at the path of the kind of resources, in the format of `KIND:PATH` (can specify multiple)")
+	f.StringVar(&diffOpts.IgnoreFile, "ignore-file", "", "YAML file containing the list of ignore rules under the `ignore` key, each with `kind` and `path`")
+
+	return cmd
+}
+
 func newDiffCommand(r *helmx.Runner, use string, out io.Writer) *cobra.Command {
 	diffOpts := &helmx.DiffOpts{Out: out}
 
+	var concurrency int
+
 	cmd := &cobra.Command{
 		Use:   fmt.Sprintf("%s [RELEASE] [DIR_OR_CHART]", use),
 		Short: "Show a diff explaining what `helm x apply` would change",
@@ -254,14 +896,35 @@ When DIR_OR_CHART is a local helm chart, this copies it into a temporary directo
 When DIR_OR_CHART is a local directory containing Kubernetes manifests, this copies all the manifests into a temporary directory, and turns it into a local Helm chart by generating a Chart.yaml whose version and appVersion are set to the value of the --version flag.
 
 When DIR_OR_CHART contains kustomization.yaml, this runs "kustomize build" to generate manifests, and then run injectors to update manifests, and prints the results.
+
+When RELEASE and DIR_OR_CHART are omitted and -f points to a releases file, this shows the diffs of all the releases in the file, followed by the summary.
 `,
 		Args: func(cmd *cobra.Command, args []string) error {
+			if releasesFileFrom(args, diffOpts.ChartifyOpts) != "" {
+				return nil
+			}
 			if len(args) != 2 {
 				return errors.New("requires two arguments")
 			}
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			resolveScopesFromCluster(r)
+
+			if file := releasesFileFrom(args, diffOpts.ChartifyOpts); file != "" {
+				cmd.SilenceUsage = true
+
+				changed, err := diffReleases(r, file, diffOpts, concurrency, out)
+				if err != nil {
+					return err
+				}
+				if changed {
+					os.Exit(2)
+				}
+
+				return nil
+			}
+
 			release := args[0]
 			dir := args[1]
 
@@ -277,7 +940,7 @@ When DIR_OR_CHART contains kustomization.yaml, this runs "kustomize build" to ge
 				defer os.RemoveAll(tempDir)
 			}
 
-			changed, err := r.Diff(release, tempDir, diffOpts)
+			changed, err := diffRelease(r, release, dir, tempDir, diffOpts, out)
 			if err != nil {
 				cmd.SilenceUsage = true
 				return err
@@ -293,10 +956,24 @@ When DIR_OR_CHART contains kustomization.yaml, this runs "kustomize build" to ge
 
 	diffOpts.ChartifyOpts = chartifyOptsFromFlags(f)
 	diffOpts.ClientOpts = clientOptsFromFlags(f)
+	diffOpts.ValidateOpts = validateOptsFromFlags(f)
+	diffOpts.Notify = notifyOptsFromFlags(f, "diff")
 
 	f.BoolVar(&diffOpts.AllowUnreleased, "allow-unreleased", false, "enables diffing of releases that are not yet deployed via Helm")
 	f.BoolVar(&diffOpts.DetailedExitcode, "detailed-exitcode", false, "return a non-zero exit code when there are changes")
 	f.BoolVar(&diffOpts.ResetValues, "reset-values", false, "reset the values to the ones built into the chart and merge in any new values")
+	f.StringVar(&diffOpts.Engine, "engine", helmx.DiffEngineHelmDiff, "the diff engine to use. either `helm-diff` to run the helm-diff plugin, or `native` to use the one built into helm-x that doesn't require the plugin")
+	f.IntVar(&diffOpts.Context, "context", 3, "output NUM lines of context around changes")
+	f.BoolVar(&diffOpts.NoColor, "no-color", false, "remove colors from the output")
+	f.StringVar(&diffOpts.Against, "against", helmx.DiffAgainstRelease, "what to compare the desired state with. either `release` to compare with the manifest of the deployed release, or `live` to compare with the live objects in the cluster. `live` implies --engine native")
+	f.BoolVar(&diffOpts.ThreeWay, "three-way", false, "show both the pending changes from the deployed release to the desired state, and the drift of the live objects from the deployed release. implies --engine native")
+	f.BoolVar(&diffOpts.IncludeHooks, "include-hooks", false, "compare the rendered hooks with the ones stored in the deployed release, too. hooks are listed separately from the other resources, tagged with their events. implies --engine native")
+	f.StringVar(&diffOpts.Output, "output", helmx.DiffOutputText, "the output format. either `text` to print the diff, `json` or `yaml` to emit the list of changed resources with their merge patches and changed fields plus a summary, or `markdown` or `html` to write the report for pull request comments. anything other than `text` implies --engine native")
+	f.StringVar(&diffOpts.ReportFile, "report-file", "", "write the diff to the file instead of stdout. the exit code keeps its meaning. implies --engine native")
+	f.StringArrayVar(&diffOpts.Ignore, "ignore", nil, "ignore changes in the fields at the path of the kind of resources, in the format of `KIND:PATH` like `Deployment:spec.replicas` and `*:metadata.annotations[\"checksum/*\"]` (can specify multiple). implies --engine native")
+	f.StringVar(&diffOpts.IgnoreFile, "ignore-file", "", "YAML file containing the list of ignore rules under the `ignore` key, each with `kind` and `path`. implies --engine native")
+	f.StringVar(&diffOpts.PinDigests, "pin-digests", "", "YAML file mapping images like nginx:1.17 to their digests under the digests key. the rendered images found in the file are rewritten to REPOSITORY@DIGEST before diffing")
+	f.IntVar(&concurrency, "concurrency", 1, "number of releases in the releases file to be diffed in parallel. 0 diffs all of them in parallel")
 
 	//f.StringVar(&u.release, "name", "", "release name (default \"release-name\")")
 
@@ -308,6 +985,8 @@ func NewAdopt(r *helmx.Runner, out io.Writer) *cobra.Command {
 	adoptOpts := &helmx.AdoptOpts{Out: out}
 	pathOptions := clientcmd.NewDefaultPathOptions()
 
+	var exportChart string
+
 	cmd := &cobra.Command{
 		Use: "adopt [RELEASE] [RESOURCES]...",
 		Short: `Adopt the existing kubernetes resources as a helm release
@@ -316,9 +995,27 @@ RESOURCES are represented as a whitespace-separated list of kind/name, like:
 
   configmap/foo.v1 secret/bar deployment/myapp
 
+Resources in namespaces other than the one specified by --namespace are represented as namespace/kind/name, and
+cluster-scoped resources like ClusterRoles, CRDs and ClusterIssuers are represented as kind/name, like:
+
+  configmap/foo.v1 monitoring/servicemonitor/myapp clusterrole/myapp customresourcedefinition/foos.example.com
+
+Which kinds are cluster-scoped is looked up with kubectl api-resources, so that custom resources are covered, too.
+
+When the release already exists, the resources are added to the manifest of its latest revision as a new revision.
+
 So that the full command looks like:
 
   helm x adopt myrelease configmap/foo.v1 secret/bar deployment/myapp
+
+Add --export-chart DIR to also write the resources as a helm chart, so that the release can be managed from source afterwards:
+
+  helm x adopt myrelease deployment/myapp service/myapp --export-chart ./myapp
+  helm x apply myrelease ./myapp
+
+Images and replica counts are extracted into values.yaml, keyed by the kind, the namespace and the name, like:
+
+  helm x apply myrelease ./myapp --set deployment.default.myapp.replicas=3
 `,
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 2 {
@@ -327,9 +1024,26 @@ So that the full command looks like:
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			resolveScopesFromCluster(r)
+
 			release := args[0]
 			resources := args[1:]
 
+			if exportChart != "" {
+				exported, err := r.ExportChart(
+					release,
+					resources,
+					exportChart,
+					pathOptions,
+					helmx.Namespace(adoptOpts.Namespace),
+				)
+				if err != nil {
+					return err
+				}
+
+				fmt.Fprintf(out, "exported %d resource(s) as the chart %s\n", exported, exportChart)
+			}
+
 			return r.Adopt(
 				release,
 				resources,
@@ -345,12 +1059,220 @@ So that the full command looks like:
 	adoptOpts.ClientOpts = clientOptsFromFlags(f)
 
 	f.StringVar(&adoptOpts.Namespace, "namespace", "", "The Namespace in which the resources to be adopted reside")
+	f.StringVar(&exportChart, "export-chart", "", "write the adopted resources as an editable helm chart into the directory, with images and replica counts extracted into values.yaml")
 
 	f.StringVar(&pathOptions.LoadingRules.ExplicitPath, pathOptions.ExplicitFileFlag, pathOptions.LoadingRules.ExplicitPath, "use a particular kubeconfig file")
 
 	return cmd
 }
 
+// NewConvertReleaseCommand represents the convert-release command
+func NewConvertReleaseCommand(r *helmx.Runner, out io.Writer) *cobra.Command {
+	convertOpts := helmx.ConvertReleaseOpts{Out: out}
+
+	cmd := &cobra.Command{
+		Use:   "convert-release [RELEASE]",
+		Short: "Rewrite the stored manifest of the release to the API versions supported by the K8s version",
+		Long: `Rewrite the stored manifest of the release to the API versions supported by the K8s version
+
+This rewrites the resources using the APIs deprecated or removed in --kube-version within the manifest stored in the latest revision of the release, like extensions/v1beta1 Deployments to apps/v1 ones with spec.selector added.
+
+It's mainly for the releases created by "helm x adopt", whose manifests are the resources obtained from the cluster as-is. Run this before upgrading the cluster or the release, so that Tiller doesn't fail to upgrade the release on the API versions no longer served. Helm 2 only.
+`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one argument")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			return r.ConvertRelease(args[0], convertOpts)
+		},
+	}
+	f := cmd.Flags()
+
+	convertOpts.ClientOpts = clientOptsFromFlags(f)
+
+	f.StringVar(&convertOpts.TillerNamespace, "tiller-namespace", "", "namespace in which release configmap/secret objects reside. defaults to $TILLER_NAMESPACE or kube-system")
+	f.StringVar(&convertOpts.KubeVersion, "kube-version", "", fmt.Sprintf("the K8s version whose supported API versions the resources are converted to. defaults to %s", validation.BundledKubeVersion))
+	f.BoolVar(&convertOpts.DryRun, "dry-run", false, "print the converted manifest without storing it")
+
+	return cmd
+}
+
+// NewImagesCommand represents the images command
+func NewImagesCommand(r *helmx.Runner, out io.Writer) *cobra.Command {
+	var release, output, pinDigests string
+
+	var requireDigest bool
+
+	var chartifyOpts *chartify.ChartifyOpts
+
+	cmd := &cobra.Command{
+		Use:   "images [DIR_OR_CHART]",
+		Short: "List the container images that would be deployed by `helm x apply`",
+		Long: `List the container images that would be deployed by ` + "`helm x apply`" + `
+
+This generates Kubernetes manifests from DIR_OR_CHART in the same way as "helm x template" does, including the sidecars added by injectors and the adhoc dependencies, and lists the images of all the containers and init containers along with the resources using them.
+
+Pass --require-digest to fail when any image isn't pinned by its digest, and --pin-digests to pin the images to the digests in the mapping file like:
+
+  digests:
+    nginx:1.17: sha256:...
+    gcr.io/myproject/app:1.0: sha256:...
+
+The same file can be passed to "helm x apply --pin-digests" to deploy the images exactly as listed.
+`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one argument")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "text" && output != "json" {
+				return fmt.Errorf("unsupported output format %q: must be either text or json", output)
+			}
+
+			cmd.SilenceUsage = true
+
+			tempLocalChartDir, err := r.Chartify(release, args[0], chartifyOpts)
+			if err != nil {
+				return err
+			}
+
+			if !chartifyOpts.Debug {
+				defer os.RemoveAll(tempLocalChartDir)
+			} else {
+				klog.Infof("helm chart has been written to %s for you to see. please remove it afterwards", tempLocalChartDir)
+			}
+
+			if pinDigests != "" {
+				if err := r.PinDigests(tempLocalChartDir, pinDigests, os.Stderr); err != nil {
+					return err
+				}
+			}
+
+			imgs, err := r.Images(release, tempLocalChartDir, chartifyOpts)
+			if err != nil {
+				return err
+			}
+
+			if err := printImages(out, imgs, output); err != nil {
+				return err
+			}
+
+			if unpinned := images.Unpinned(imgs); requireDigest && len(unpinned) > 0 {
+				var msgs []string
+				for _, i := range unpinned {
+					msgs = append(msgs, fmt.Sprintf("%s used by %s/%s container %s in %s", i.Image, i.Kind, i.Name, i.Container, i.Source))
+				}
+				return fmt.Errorf("%d image(s) aren't pinned by digest:\n%s", len(unpinned), strings.Join(msgs, "\n"))
+			}
+
+			return nil
+		},
+	}
+	f := cmd.Flags()
+
+	chartifyOpts = chartifyOptsFromFlags(f)
+
+	f.StringVar(&release, "name", "release-name", "release name used to render the chart")
+	f.StringVar(&output, "output", "text", "the output format. either text to print a table, or json to emit the list of the images with their repositories, tags, digests and resources")
+	f.BoolVar(&requireDigest, "require-digest", false, "fail when any image isn't pinned by its digest")
+	f.StringVar(&pinDigests, "pin-digests", "", "YAML file mapping images like nginx:1.17 to their digests under the digests key. the rendered images found in the file are rewritten to REPOSITORY@DIGEST before listing")
+
+	return cmd
+}
+
+func printImages(out io.Writer, imgs []images.Image, output string) error {
+	if output == "json" {
+		if imgs == nil {
+			imgs = []images.Image{}
+		}
+
+		bs, err := json.MarshalIndent(imgs, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(out, string(bs))
+
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "IMAGE\tRESOURCE\tCONTAINER\tSOURCE")
+
+	for _, i := range imgs {
+		container := i.Container
+		if i.Init {
+			container += " (init)"
+		}
+
+		fmt.Fprintf(w, "%s\t%s/%s\t%s\t%s\n", i.Image, i.Kind, i.Name, container, i.Source)
+	}
+
+	return w.Flush()
+}
+
+// NewResourcesCommand represents the resources command
+func NewResourcesCommand(r *helmx.Runner, out io.Writer) *cobra.Command {
+	resourcesOpts := helmx.ResourcesOpts{Out: out}
+
+	var release string
+
+	cmd := &cobra.Command{
+		Use:   "resources [DIR_OR_CHART]",
+		Short: "Report the CPU and memory that would be requested by the pods deployed with `helm x apply`",
+		Long: `Report the CPU and memory that would be requested by the pods deployed with ` + "`helm x apply`" + `
+
+This generates Kubernetes manifests from DIR_OR_CHART in the same way as "helm x template" does, including the sidecars added by injectors, and sums up the CPU and memory requests and limits of the pods per namespace and workload kind, weighted by the replicas. DaemonSets are assumed to run a pod on each of --nodes nodes.
+
+Containers without requests are reported as warnings. Pass --quota to check the totals against the ResourceQuotas in the file, and fail when the release wouldn't fit in them before "helm upgrade" hits the quotas.
+`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one argument")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if o := resourcesOpts.Output; o != helmx.ResourcesOutputText && o != helmx.ResourcesOutputJSON {
+				return fmt.Errorf("unsupported output format %q: must be either text or json", o)
+			}
+
+			cmd.SilenceUsage = true
+
+			tempLocalChartDir, err := r.Chartify(release, args[0], resourcesOpts.ChartifyOpts)
+			if err != nil {
+				return err
+			}
+
+			if !resourcesOpts.Debug {
+				defer os.RemoveAll(tempLocalChartDir)
+			} else {
+				klog.Infof("helm chart has been written to %s for you to see. please remove it afterwards", tempLocalChartDir)
+			}
+
+			return r.Resources(release, tempLocalChartDir, resourcesOpts)
+		},
+	}
+	f := cmd.Flags()
+
+	resourcesOpts.ChartifyOpts = chartifyOptsFromFlags(f)
+
+	f.StringVar(&release, "name", "release-name", "release name used to render the chart")
+	f.StringVar(&resourcesOpts.Output, "output", helmx.ResourcesOutputText, "the output format. either text to print the totals per namespace and kind, or json to emit the totals along with the requests and limits of every workload")
+	f.Int64Var(&resourcesOpts.Nodes, "nodes", 1, "number of the nodes each DaemonSet is assumed to run a pod on")
+	f.StringVar(&resourcesOpts.QuotaFile, "quota", "", "YAML file containing ResourceQuotas to check the totals against. fails when the release would exceed the hard limits, or has containers not specifying the resources limited by the quotas")
+
+	return cmd
+}
+
 // NewDiffCommand represents the diff command
 func NewUtilDumpRelease(r *helmx.Runner, out io.Writer) *cobra.Command {
 	dumpOpts := &dumpCmd{Out: out}
@@ -423,6 +1345,69 @@ func chartifyOptsFromFlags(f *pflag.FlagSet) *chartify.ChartifyOpts {
 	return chartifyOpts
 }
 
+// sourceChartifyOptsFromFlags adds the flags prefixed with `--PREFIX-` for the options specific to one of the sources
+func sourceChartifyOptsFromFlags(f *pflag.FlagSet, prefix, src string) *chartify.ChartifyOpts {
+	chartifyOpts := &chartify.ChartifyOpts{}
+
+	flag := func(name string) string {
+		return prefix + "-" + name
+	}
+
+	f.StringArrayVar(&chartifyOpts.Injects, flag("inject"), []string{}, fmt.Sprintf("injector to use for %s (can specify multiple)", src))
+	f.StringArrayVar(&chartifyOpts.AdhocChartDependencies, flag("dependency"), []string{}, fmt.Sprintf("Adhoc dependencies to be added to the temporary local helm chart for %s. Syntax: ALIAS=REPO/CHART:VERSION", src))
+	f.StringArrayVar(&chartifyOpts.JsonPatches, flag("json-patch"), []string{}, fmt.Sprintf("Kustomize JSON Patch file to be applied to the K8s manifests rendered from %s", src))
+	f.StringArrayVar(&chartifyOpts.StrategicMergePatches, flag("strategic-merge-patch"), []string{}, fmt.Sprintf("Kustomize Strategic Merge Patch file to be applied to the K8s manifests rendered from %s", src))
+	f.StringArrayVar(&chartifyOpts.ValuesFiles, flag("values"), []string{}, fmt.Sprintf("specify values for %s in a YAML file or a URL (can specify multiple)", src))
+	f.StringArrayVar(&chartifyOpts.SetValues, flag("set"), []string{}, fmt.Sprintf("set values for %s on the command line (can specify multiple)", src))
+	f.StringVar(&chartifyOpts.Namespace, flag("namespace"), "", fmt.Sprintf("Namespace to render %s into. Overrides --namespace", src))
+	f.StringVar(&chartifyOpts.ChartVersion, flag("version"), "", fmt.Sprintf("specify the exact chart version to use for %s. Overrides --version", src))
+
+	return chartifyOpts
+}
+
+// mergeChartifyOpts returns the options for a source, by appending the source-specific ones to the common ones
+func mergeChartifyOpts(common, src *chartify.ChartifyOpts) *chartify.ChartifyOpts {
+	merged := *common
+
+	merged.Injectors = append(append([]string{}, common.Injectors...), src.Injectors...)
+	merged.Injects = append(append([]string{}, common.Injects...), src.Injects...)
+	merged.AdhocChartDependencies = append(append([]string{}, common.AdhocChartDependencies...), src.AdhocChartDependencies...)
+	merged.JsonPatches = append(append([]string{}, common.JsonPatches...), src.JsonPatches...)
+	merged.StrategicMergePatches = append(append([]string{}, common.StrategicMergePatches...), src.StrategicMergePatches...)
+	merged.ValuesFiles = append(append([]string{}, common.ValuesFiles...), src.ValuesFiles...)
+	merged.SetValues = append(append([]string{}, common.SetValues...), src.SetValues...)
+
+	if src.Namespace != "" {
+		merged.Namespace = src.Namespace
+	}
+	if src.ChartVersion != "" {
+		merged.ChartVersion = src.ChartVersion
+	}
+
+	return &merged
+}
+
+func validateOptsFromFlags(f *pflag.FlagSet) *helmx.ValidateOpts {
+	validateOpts := &helmx.ValidateOpts{}
+	f.BoolVar(&validateOpts.Validate, "validate", false, "validate the rendered resources against the OpenAPI schemas of the K8s version and the CRDs, without connecting to the cluster")
+	f.StringVar(&validateOpts.KubeVersion, "kube-version", "", fmt.Sprintf("the K8s version to validate the resources against with --validate. also warns about the APIs deprecated in the version, and fails on the removed ones. defaults to %s, the version of the bundled schemas", validation.BundledKubeVersion))
+	f.StringVar(&validateOpts.SchemaDir, "schema-dir", "", "directory containing KUBE_VERSION/swagger.json or swagger.json to be used instead of the bundled schemas with --validate")
+	f.StringVar(&validateOpts.CRDDir, "crd-dir", "", "directory containing CRDs whose custom resources are validated with --validate, in addition to the CRDs in the rendered resources")
+	f.BoolVar(&validateOpts.IgnoreMissingSchemas, "ignore-missing-schemas", false, "skip the resources of the kinds without schemas on --validate, instead of failing on them")
+	f.BoolVar(&validateOpts.ConvertDeprecatedAPIs, "convert-deprecated-apis", false, "rewrite the resources using the APIs deprecated or removed in --kube-version to the supported API versions, along with the required field changes")
+	return validateOpts
+}
+
+func notifyOptsFromFlags(f *pflag.FlagSet, outcomes string) *helmx.NotifyOpts {
+	notifyOpts := &helmx.NotifyOpts{}
+	f.StringArrayVar(&notifyOpts.Webhooks, "notify-webhook", nil, fmt.Sprintf("URL to post the outcome of the %s to in JSON, including the release, the namespace, the source, the chart version, the diff summary, the duration, the status and the error (can specify multiple)", outcomes))
+	f.StringArrayVar(&notifyOpts.SlackWebhooks, "notify-slack", nil, fmt.Sprintf("URL of the Slack incoming webhook to post the outcome of the %s to (can specify multiple)", outcomes))
+	f.StringVar(&notifyOpts.ConfigFile, "notify-config", "", "YAML file containing the notification sinks under the sinks key, each with type, url, headers, and optionally commands and statuses to filter the notifications")
+	f.DurationVar(&notifyOpts.Timeout, "notify-timeout", 0, "timeout of each request to the notification sinks. defaults to the timeout in --notify-config, or 10s")
+	f.IntVar(&notifyOpts.Retries, "notify-retries", 0, "number of times to retry the notifications failed with network errors, 429 or 5xx responses. defaults to the retries in --notify-config")
+	return notifyOpts
+}
+
 func clientOptsFromFlags(f *pflag.FlagSet) *helmx.ClientOpts {
 	clientOpts := &helmx.ClientOpts{}
 	f.BoolVar(&clientOpts.TLS, "tls", false, "enable TLS for request")
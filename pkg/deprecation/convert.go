@@ -0,0 +1,220 @@
+package deprecation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+// Convert rewrites the object using a deprecated API to the newest replacement available in the K8s version, following
+// the chain of the replacements like `extensions/v1beta1` to `networking.k8s.io/v1beta1` to `networking.k8s.io/v1` for
+// Ingresses. It returns true when the object is converted.
+//
+// It fails when the API is removed in the K8s version but has no replacement, or the migration requires manual changes
+// like the ones of CRDs. Such APIs are left as-is while they're still served.
+func Convert(obj map[string]interface{}, kubeVersion string) (bool, error) {
+	var converted bool
+
+	for {
+		apiVersion, _ := obj["apiVersion"].(string)
+		kind, _ := obj["kind"].(string)
+
+		api := Lookup(apiVersion, kind)
+		if api == nil || !api.DeprecatedInVersion(kubeVersion) {
+			return converted, nil
+		}
+
+		// Still-served APIs that can't be converted automatically are left as-is
+		if api.Replacement == "" {
+			if !api.RemovedInVersion(kubeVersion) {
+				return converted, nil
+			}
+			return converted, fmt.Errorf("%s %s has no replacement: remove it or keep using a K8s version older than %s", apiVersion, kind, api.RemovedIn)
+		}
+
+		if api.manual {
+			if !api.RemovedInVersion(kubeVersion) {
+				return converted, nil
+			}
+			return converted, fmt.Errorf("%s %s requires manual changes to migrate to %s", apiVersion, kind, api.Replacement)
+		}
+
+		if api.convert != nil {
+			if err := api.convert(obj); err != nil {
+				return converted, fmt.Errorf("unable to convert %s %s to %s: %v", apiVersion, kind, api.Replacement, err)
+			}
+		}
+
+		obj["apiVersion"] = api.Replacement
+
+		converted = true
+	}
+}
+
+// ConvertManifest converts all the resources using deprecated APIs in the multi-document manifest with Convert, and
+// returns the resulting manifest along with the findings of the original resources.
+//
+// The manifest is returned as-is when nothing is converted. Otherwise every resource is re-serialized, preceded by its
+// `# Source:` comment.
+func ConvertManifest(m, kubeVersion string) (string, []Finding, error) {
+	resources, err := manifest.Parse(m, "")
+	if err != nil {
+		return "", nil, err
+	}
+
+	findings := Check(resources, kubeVersion)
+	if len(findings) == 0 {
+		return m, nil, nil
+	}
+
+	var errs []string
+	var changed bool
+
+	for _, f := range findings {
+		c, err := Convert(f.Resource.Object, kubeVersion)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s/%s in %s: %v", f.Resource.Kind, f.Resource.Name, sourceOrUnknown(f.Resource.Source), err))
+		}
+		changed = changed || c
+	}
+
+	if len(errs) > 0 {
+		return "", findings, fmt.Errorf("unable to convert %d resource(s) for K8s %s:\n%s", len(errs), kubeVersion, strings.Join(errs, "\n"))
+	}
+
+	if !changed {
+		return m, findings, nil
+	}
+
+	converted, err := manifest.Join(resources)
+	if err != nil {
+		return "", findings, err
+	}
+
+	return converted, findings, nil
+}
+
+func sourceOrUnknown(source string) string {
+	if source == "" {
+		return "unknown source"
+	}
+	return source
+}
+
+// toAppsV1 migrates the workloads of `extensions/v1beta1`, `apps/v1beta1` and `apps/v1beta2` to `apps/v1`, which
+// requires `spec.selector` and no longer supports `spec.rollbackTo` and `spec.templateGeneration`.
+//
+// The update strategy of DaemonSets and StatefulSets is set to `OnDelete` unless specified, so that it stays the same
+// as the default of the deprecated APIs.
+func toAppsV1(obj map[string]interface{}) error {
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("missing spec")
+	}
+
+	if _, ok := spec["selector"]; !ok {
+		labels := nested(spec, "template", "metadata", "labels")
+		if len(labels) == 0 {
+			return fmt.Errorf("spec.selector is required, but can't be derived from the empty spec.template.metadata.labels")
+		}
+
+		matchLabels := map[string]interface{}{}
+		for k, v := range labels {
+			matchLabels[k] = v
+		}
+
+		spec["selector"] = map[string]interface{}{"matchLabels": matchLabels}
+	}
+
+	delete(spec, "rollbackTo")
+	delete(spec, "templateGeneration")
+
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+
+	keepOnDelete := kind == "DaemonSet" && apiVersion == "extensions/v1beta1" ||
+		kind == "StatefulSet" && apiVersion == "apps/v1beta1"
+
+	if _, ok := spec["updateStrategy"]; !ok && keepOnDelete {
+		spec["updateStrategy"] = map[string]interface{}{"type": "OnDelete"}
+	}
+
+	return nil
+}
+
+// ingressToV1 migrates Ingresses to `networking.k8s.io/v1`, which renames `spec.backend` to `spec.defaultBackend`,
+// restructures backends into `service.name` and `service.port`, and requires `pathType` in every path
+func ingressToV1(obj map[string]interface{}) error {
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if backend, ok := spec["backend"].(map[string]interface{}); ok {
+		spec["defaultBackend"] = convertBackend(backend)
+		delete(spec, "backend")
+	}
+
+	rules, _ := spec["rules"].([]interface{})
+	for _, r := range rules {
+		rule, _ := r.(map[string]interface{})
+
+		paths, _ := nested(rule, "http")["paths"].([]interface{})
+		for _, p := range paths {
+			path, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			if backend, ok := path["backend"].(map[string]interface{}); ok {
+				path["backend"] = convertBackend(backend)
+			}
+
+			if _, ok := path["pathType"]; !ok {
+				path["pathType"] = "ImplementationSpecific"
+			}
+		}
+	}
+
+	return nil
+}
+
+func convertBackend(backend map[string]interface{}) map[string]interface{} {
+	name, hasName := backend["serviceName"]
+	port, hasPort := backend["servicePort"]
+
+	if !hasName && !hasPort {
+		return backend
+	}
+
+	converted := map[string]interface{}{}
+	for k, v := range backend {
+		if k != "serviceName" && k != "servicePort" {
+			converted[k] = v
+		}
+	}
+
+	svcPort := map[string]interface{}{}
+	if s, ok := port.(string); ok {
+		svcPort["name"] = s
+	} else if hasPort {
+		svcPort["number"] = port
+	}
+
+	converted["service"] = map[string]interface{}{"name": name, "port": svcPort}
+
+	return converted
+}
+
+func nested(obj map[string]interface{}, fields ...string) map[string]interface{} {
+	cur := obj
+	for _, f := range fields {
+		next, ok := cur[f].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = next
+	}
+	return cur
+}
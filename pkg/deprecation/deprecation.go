@@ -0,0 +1,190 @@
+package deprecation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+// API is an API version of a kind that is deprecated and eventually removed from K8s
+type API struct {
+	APIVersion string
+	Kind       string
+
+	// DeprecatedIn is the K8s version like `1.16` that deprecated the API, in which the replacement is available, too
+	DeprecatedIn string
+
+	// RemovedIn is the K8s version that no longer serves the API
+	RemovedIn string
+
+	// Replacement is the API version to migrate to. Empty when the kind is removed without any replacement
+	Replacement string
+
+	// convert applies the field changes required to migrate the object to the replacement.
+	// nil when no field change is required
+	convert func(obj map[string]interface{}) error
+
+	// manual is true when the migration requires changes that can't be made automatically
+	manual bool
+}
+
+const (
+	apps       = "apps/v1"
+	rbac       = "rbac.authorization.k8s.io/v1"
+	networking = "networking.k8s.io/v1"
+)
+
+// APIs is the list of the deprecated APIs known to helm-x.
+//
+// See https://kubernetes.io/docs/reference/using-api/deprecation-guide/
+var APIs = []API{
+	{APIVersion: "extensions/v1beta1", Kind: "Deployment", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: apps, convert: toAppsV1},
+	{APIVersion: "extensions/v1beta1", Kind: "DaemonSet", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: apps, convert: toAppsV1},
+	{APIVersion: "extensions/v1beta1", Kind: "ReplicaSet", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: apps, convert: toAppsV1},
+	{APIVersion: "apps/v1beta1", Kind: "Deployment", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: apps, convert: toAppsV1},
+	{APIVersion: "apps/v1beta1", Kind: "StatefulSet", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: apps, convert: toAppsV1},
+	{APIVersion: "apps/v1beta2", Kind: "Deployment", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: apps, convert: toAppsV1},
+	{APIVersion: "apps/v1beta2", Kind: "StatefulSet", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: apps, convert: toAppsV1},
+	{APIVersion: "apps/v1beta2", Kind: "DaemonSet", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: apps, convert: toAppsV1},
+	{APIVersion: "apps/v1beta2", Kind: "ReplicaSet", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: apps, convert: toAppsV1},
+	{APIVersion: "extensions/v1beta1", Kind: "NetworkPolicy", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: networking},
+	{APIVersion: "extensions/v1beta1", Kind: "PodSecurityPolicy", DeprecatedIn: "1.11", RemovedIn: "1.16", Replacement: "policy/v1beta1"},
+	{APIVersion: "extensions/v1beta1", Kind: "Ingress", DeprecatedIn: "1.14", RemovedIn: "1.22", Replacement: "networking.k8s.io/v1beta1"},
+	{APIVersion: "networking.k8s.io/v1beta1", Kind: "Ingress", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: networking, convert: ingressToV1},
+	{APIVersion: "networking.k8s.io/v1beta1", Kind: "IngressClass", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: networking},
+	{APIVersion: "rbac.authorization.k8s.io/v1beta1", Kind: "ClusterRole", DeprecatedIn: "1.17", RemovedIn: "1.22", Replacement: rbac},
+	{APIVersion: "rbac.authorization.k8s.io/v1beta1", Kind: "ClusterRoleBinding", DeprecatedIn: "1.17", RemovedIn: "1.22", Replacement: rbac},
+	{APIVersion: "rbac.authorization.k8s.io/v1beta1", Kind: "Role", DeprecatedIn: "1.17", RemovedIn: "1.22", Replacement: rbac},
+	{APIVersion: "rbac.authorization.k8s.io/v1beta1", Kind: "RoleBinding", DeprecatedIn: "1.17", RemovedIn: "1.22", Replacement: rbac},
+	{APIVersion: "rbac.authorization.k8s.io/v1alpha1", Kind: "ClusterRole", DeprecatedIn: "1.17", RemovedIn: "1.22", Replacement: rbac},
+	{APIVersion: "rbac.authorization.k8s.io/v1alpha1", Kind: "ClusterRoleBinding", DeprecatedIn: "1.17", RemovedIn: "1.22", Replacement: rbac},
+	{APIVersion: "rbac.authorization.k8s.io/v1alpha1", Kind: "Role", DeprecatedIn: "1.17", RemovedIn: "1.22", Replacement: rbac},
+	{APIVersion: "rbac.authorization.k8s.io/v1alpha1", Kind: "RoleBinding", DeprecatedIn: "1.17", RemovedIn: "1.22", Replacement: rbac},
+	{APIVersion: "scheduling.k8s.io/v1beta1", Kind: "PriorityClass", DeprecatedIn: "1.14", RemovedIn: "1.22", Replacement: "scheduling.k8s.io/v1"},
+	{APIVersion: "storage.k8s.io/v1beta1", Kind: "StorageClass", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: "storage.k8s.io/v1"},
+	{APIVersion: "storage.k8s.io/v1beta1", Kind: "CSIDriver", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: "storage.k8s.io/v1"},
+	{APIVersion: "coordination.k8s.io/v1beta1", Kind: "Lease", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: "coordination.k8s.io/v1"},
+	{APIVersion: "apiregistration.k8s.io/v1beta1", Kind: "APIService", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: "apiregistration.k8s.io/v1"},
+	{APIVersion: "apiextensions.k8s.io/v1beta1", Kind: "CustomResourceDefinition", DeprecatedIn: "1.16", RemovedIn: "1.22", Replacement: "apiextensions.k8s.io/v1", manual: true},
+	{APIVersion: "admissionregistration.k8s.io/v1beta1", Kind: "MutatingWebhookConfiguration", DeprecatedIn: "1.16", RemovedIn: "1.22", Replacement: "admissionregistration.k8s.io/v1", manual: true},
+	{APIVersion: "admissionregistration.k8s.io/v1beta1", Kind: "ValidatingWebhookConfiguration", DeprecatedIn: "1.16", RemovedIn: "1.22", Replacement: "admissionregistration.k8s.io/v1", manual: true},
+	{APIVersion: "certificates.k8s.io/v1beta1", Kind: "CertificateSigningRequest", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: "certificates.k8s.io/v1", manual: true},
+	{APIVersion: "batch/v1beta1", Kind: "CronJob", DeprecatedIn: "1.21", RemovedIn: "1.25", Replacement: "batch/v1"},
+	{APIVersion: "policy/v1beta1", Kind: "PodDisruptionBudget", DeprecatedIn: "1.21", RemovedIn: "1.25", Replacement: "policy/v1"},
+	{APIVersion: "policy/v1beta1", Kind: "PodSecurityPolicy", DeprecatedIn: "1.21", RemovedIn: "1.25"},
+	{APIVersion: "discovery.k8s.io/v1beta1", Kind: "EndpointSlice", DeprecatedIn: "1.21", RemovedIn: "1.25", Replacement: "discovery.k8s.io/v1", manual: true},
+	{APIVersion: "autoscaling/v2beta1", Kind: "HorizontalPodAutoscaler", DeprecatedIn: "1.22", RemovedIn: "1.25", Replacement: "autoscaling/v2", manual: true},
+	{APIVersion: "autoscaling/v2beta2", Kind: "HorizontalPodAutoscaler", DeprecatedIn: "1.23", RemovedIn: "1.26", Replacement: "autoscaling/v2"},
+}
+
+// Lookup returns the deprecated API of the kind, or nil if the API version of the kind isn't known to be deprecated
+func Lookup(apiVersion, kind string) *API {
+	for i := range APIs {
+		if APIs[i].APIVersion == apiVersion && APIs[i].Kind == kind {
+			return &APIs[i]
+		}
+	}
+	return nil
+}
+
+// DeprecatedInVersion returns true when the API is deprecated or removed in the K8s version
+func (a *API) DeprecatedInVersion(kubeVersion string) bool {
+	return compareVersions(kubeVersion, a.DeprecatedIn) >= 0
+}
+
+// RemovedInVersion returns true when the API is no longer served by the K8s version
+func (a *API) RemovedInVersion(kubeVersion string) bool {
+	return compareVersions(kubeVersion, a.RemovedIn) >= 0
+}
+
+// replacementIn follows the chain of the replacements deprecated in the K8s version, and returns the last one
+func (a *API) replacementIn(kubeVersion string) string {
+	r := a.Replacement
+	for next := Lookup(r, a.Kind); next != nil && next.Replacement != "" && next.DeprecatedInVersion(kubeVersion); next = Lookup(r, a.Kind) {
+		r = next.Replacement
+	}
+	return r
+}
+
+// Finding is a resource using a deprecated or removed API in the target K8s version
+type Finding struct {
+	Resource *manifest.Resource
+	API      *API
+
+	// Removed is true when the API is no longer served by the target K8s version
+	Removed bool
+
+	// Replacement is the newest API version available in the target K8s version to migrate to
+	Replacement string
+}
+
+func (f Finding) String() string {
+	state := fmt.Sprintf("deprecated since K8s %s and removed in %s", f.API.DeprecatedIn, f.API.RemovedIn)
+	if f.Removed {
+		state = fmt.Sprintf("removed in K8s %s", f.API.RemovedIn)
+	}
+
+	migration := "with no replacement"
+	if f.Replacement != "" {
+		migration = "migrate to " + f.Replacement
+	}
+
+	return fmt.Sprintf("%s/%s in %s uses %s, which is %s: %s", f.Resource.Kind, f.Resource.Name, sourceOrUnknown(f.Resource.Source), f.API.APIVersion, state, migration)
+}
+
+// Check returns the findings of the resources using the APIs deprecated or removed in the K8s version like `1.16`
+func Check(resources []*manifest.Resource, kubeVersion string) []Finding {
+	var findings []Finding
+
+	for _, res := range resources {
+		api := Lookup(res.APIVersion, res.Kind)
+		if api == nil || !api.DeprecatedInVersion(kubeVersion) {
+			continue
+		}
+
+		findings = append(findings, Finding{
+			Resource:    res,
+			API:         api,
+			Removed:     api.RemovedInVersion(kubeVersion),
+			Replacement: api.replacementIn(kubeVersion),
+		})
+	}
+
+	return findings
+}
+
+// Removed returns the findings of the APIs removed in the target K8s version
+func Removed(findings []Finding) []Finding {
+	var removed []Finding
+	for _, f := range findings {
+		if f.Removed {
+			removed = append(removed, f)
+		}
+	}
+	return removed
+}
+
+// compareVersions compares the major and minor versions of K8s like `1.16` and `v1.16.2`
+func compareVersions(a, b string) int {
+	pa, pb := parseVersion(a), parseVersion(b)
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func parseVersion(v string) [2]int {
+	var res [2]int
+	items := strings.SplitN(strings.TrimPrefix(v, "v"), ".", 3)
+	for i := 0; i < len(items) && i < 2; i++ {
+		res[i], _ = strconv.Atoi(strings.TrimRightFunc(items[i], func(r rune) bool { return r < '0' || r > '9' }))
+	}
+	return res
+}
@@ -0,0 +1,181 @@
+package deprecation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+const testManifest = `---
+# Source: x/templates/deployment.yaml
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  rollbackTo:
+    revision: 1
+  template:
+    metadata:
+      labels:
+        app: x
+    spec:
+      containers:
+      - name: app
+        image: app:1.0
+---
+# Source: x/templates/ingress.yaml
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: app
+spec:
+  backend:
+    serviceName: default
+    servicePort: 80
+  rules:
+  - host: example.com
+    http:
+      paths:
+      - path: /
+        backend:
+          serviceName: app
+          servicePort: http
+---
+# Source: x/templates/crd.yaml
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+---
+# Source: x/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+`
+
+func TestCheck(t *testing.T) {
+	resources, err := manifest.Parse(testManifest, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		kubeVersion string
+		expected    []string
+	}{
+		{
+			kubeVersion: "1.8",
+		},
+		{
+			kubeVersion: "v1.16.3",
+			expected: []string{
+				"Deployment/app in x/templates/deployment.yaml uses extensions/v1beta1, which is removed in K8s 1.16: migrate to apps/v1",
+				"Ingress/app in x/templates/ingress.yaml uses extensions/v1beta1, which is deprecated since K8s 1.14 and removed in 1.22: migrate to networking.k8s.io/v1beta1",
+				"CustomResourceDefinition/widgets.example.com in x/templates/crd.yaml uses apiextensions.k8s.io/v1beta1, which is deprecated since K8s 1.16 and removed in 1.22: migrate to apiextensions.k8s.io/v1",
+			},
+		},
+		{
+			kubeVersion: "1.22",
+			expected: []string{
+				"Deployment/app in x/templates/deployment.yaml uses extensions/v1beta1, which is removed in K8s 1.16: migrate to apps/v1",
+				"Ingress/app in x/templates/ingress.yaml uses extensions/v1beta1, which is removed in K8s 1.22: migrate to networking.k8s.io/v1",
+				"CustomResourceDefinition/widgets.example.com in x/templates/crd.yaml uses apiextensions.k8s.io/v1beta1, which is removed in K8s 1.22: migrate to apiextensions.k8s.io/v1",
+			},
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		var actual []string
+		for _, f := range Check(resources, tc.kubeVersion) {
+			actual = append(actual, f.String())
+		}
+
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("unexpected findings for case %d:\nexpected=%q\ngot=%q", i, tc.expected, actual)
+		}
+	}
+}
+
+func TestConvertManifest(t *testing.T) {
+	if _, _, err := ConvertManifest(testManifest, "1.22"); err == nil {
+		t.Fatal("expected error for the CRD that requires manual conversion, got none")
+	}
+
+	converted, findings, err := ConvertManifest(testManifest, "1.19")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(findings) != 3 {
+		t.Errorf("unexpected number of findings: expected=3, got=%d", len(findings))
+	}
+
+	expected := `---
+# Source: x/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  selector:
+    matchLabels:
+      app: x
+  template:
+    metadata:
+      labels:
+        app: x
+    spec:
+      containers:
+      - image: app:1.0
+        name: app
+---
+# Source: x/templates/ingress.yaml
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app
+spec:
+  defaultBackend:
+    service:
+      name: default
+      port:
+        number: 80
+  rules:
+  - host: example.com
+    http:
+      paths:
+      - backend:
+          service:
+            name: app
+            port:
+              name: http
+        path: /
+        pathType: ImplementationSpecific
+---
+# Source: x/templates/crd.yaml
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+---
+# Source: x/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+`
+
+	if converted != expected {
+		t.Errorf("unexpected manifest:\nexpected:\n%s\ngot:\n%s", expected, converted)
+	}
+
+	unchanged := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\n"
+	if m, _, err := ConvertManifest(unchanged, "1.22"); err != nil || m != unchanged {
+		t.Errorf("unexpected result for the manifest without deprecated APIs: %q, %v", m, err)
+	}
+}
@@ -0,0 +1,3 @@
+// deprecation finds K8s resources using the API versions that are deprecated or removed in the target K8s version, and
+// converts them to the supported versions along with the required field changes.
+package deprecation
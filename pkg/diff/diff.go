@@ -0,0 +1,172 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+// Action is the kind of change made to a resource
+type Action string
+
+const (
+	ActionAdd    Action = "add"
+	ActionChange Action = "change"
+	ActionRemove Action = "remove"
+)
+
+// Change is a change made to a resource, keyed on apiVersion/kind/namespace/name
+type Change struct {
+	Action Action
+
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+
+	// HookEvents is the events the resource is run on, like `pre-upgrade`. Empty unless the resource is a helm hook
+	HookEvents []string
+
+	// Old is the resource before the change. Nil when the resource is being added
+	Old *manifest.Resource
+	// New is the resource after the change. Nil when the resource is being removed
+	New *manifest.Resource
+
+	// Before and After are the YAML representations of Old and New after secret suppression, used to print the diff
+	Before string
+	After  string
+
+	// before and after are the objects of Old and New after secret suppression, used to compute the patch
+	before, after map[string]interface{}
+}
+
+// String returns the human-readable identifier of the changed resource
+func (c *Change) String() string {
+	if c.New != nil {
+		return c.New.String()
+	}
+	return c.Old.String()
+}
+
+// IsHook returns true when the changed resource is a helm hook
+func (c *Change) IsHook() bool {
+	return len(c.HookEvents) > 0
+}
+
+// label returns the identifier of the changed resource, tagged with the hook events if it's a hook
+func (c *Change) label() string {
+	if c.IsHook() {
+		return fmt.Sprintf("%s [hook: %s]", c, strings.Join(c.HookEvents, ","))
+	}
+	return c.String()
+}
+
+// Opts controls how resources are compared
+type Opts struct {
+	// SuppressSecrets masks the data of Secrets, so that only the keys and sizes of changed values are shown
+	SuppressSecrets bool
+
+	// Ignore removes the fields matched by its rules from both sides before comparing. Optional
+	Ignore *Ignorer
+}
+
+// Resources compares the resources resource by resource, and returns the changes sorted by their keys.
+// Resources that are identical in old and new are omitted.
+func Resources(old, new []*manifest.Resource, opts Opts) ([]*Change, error) {
+	olds := index(old)
+	news := index(new)
+
+	keys := []string{}
+	for k := range olds {
+		keys = append(keys, k)
+	}
+	for k := range news {
+		if _, ok := olds[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []*Change
+
+	for _, k := range keys {
+		o, n := olds[k], news[k]
+
+		c := &Change{Old: o, New: n}
+
+		var ref *manifest.Resource
+		switch {
+		case o == nil:
+			c.Action = ActionAdd
+			ref = n
+		case n == nil:
+			c.Action = ActionRemove
+			ref = o
+		default:
+			c.Action = ActionChange
+			ref = n
+		}
+
+		c.APIVersion, c.Kind, c.Namespace, c.Name = ref.APIVersion, ref.Kind, ref.Namespace, ref.Name
+		c.HookEvents = ref.HookEvents()
+
+		var oldObj, newObj map[string]interface{}
+		if o != nil {
+			oldObj = o.Object
+		}
+		if n != nil {
+			newObj = n.Object
+		}
+
+		if opts.Ignore != nil {
+			ignoredOld, ignoredNew := opts.Ignore.apply(c.Kind, oldObj), opts.Ignore.apply(c.Kind, newObj)
+			if c.Action == ActionChange {
+				opts.Ignore.Suppressed += len(changedFields("", oldObj, newObj, nil)) - len(changedFields("", ignoredOld, ignoredNew, nil))
+			}
+			oldObj, newObj = ignoredOld, ignoredNew
+		}
+
+		if opts.SuppressSecrets && c.Kind == "Secret" {
+			oldObj, newObj = redactSecrets(oldObj, newObj)
+		}
+
+		c.before, c.after = oldObj, newObj
+
+		var err error
+		if oldObj != nil {
+			if c.Before, err = manifest.Marshal(oldObj); err != nil {
+				return nil, err
+			}
+		}
+		if newObj != nil {
+			if c.After, err = manifest.Marshal(newObj); err != nil {
+				return nil, err
+			}
+		}
+
+		if c.Action == ActionChange && c.Before == c.After {
+			continue
+		}
+
+		changes = append(changes, c)
+	}
+
+	return changes, nil
+}
+
+func index(resources []*manifest.Resource) map[string]*manifest.Resource {
+	m := map[string]*manifest.Resource{}
+	for _, r := range resources {
+		m[r.Key()] = r
+	}
+	return m
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,248 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+const oldManifest = `---
+# Source: myapp/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: app
+        image: myapp:v1
+---
+# Source: myapp/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: myapp
+data:
+  password: Zm9v
+  username: YWRtaW4=
+---
+# Source: myapp/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: obsolete
+data:
+  foo: bar
+`
+
+const newManifest = `---
+# Source: myapp/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: app
+        image: myapp:v1
+---
+# Source: myapp/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: myapp
+data:
+  password: YmFy
+  username: YWRtaW4=
+---
+# Source: myapp/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: myapp
+spec:
+  type: ClusterIP
+`
+
+func TestResources(t *testing.T) {
+	old, err := manifest.Parse(oldManifest, "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	new, err := manifest.Parse(newManifest, "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	changes, err := Resources(old, new, Opts{SuppressSecrets: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Print(buf, changes, PrintOpts{Context: 1, NoColor: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `default, myapp, Deployment (apps/v1) has changed:
+@@ -5,3 +5,3 @@
+  spec:
+-   replicas: 1
++   replicas: 2
+    template:
+
+default, obsolete, ConfigMap (v1) has been removed:
+- apiVersion: v1
+- data:
+-   foo: bar
+- kind: ConfigMap
+- metadata:
+-   name: obsolete
+
+default, myapp, Secret (v1) has changed:
+@@ -2,3 +2,3 @@
+  data:
+-   password: '-------- # (3 bytes)'
++   password: '++++++++ # (3 bytes)'
+    username: 'REDACTED # (5 bytes)'
+
+default, myapp, Service (v1) has been added:
++ apiVersion: v1
++ kind: Service
++ metadata:
++   name: myapp
++ spec:
++   type: ClusterIP
+
+`
+
+	if actual := buf.String(); actual != expected {
+		t.Errorf("unexpected diff:\nexpected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestResourcesIgnore(t *testing.T) {
+	old, err := manifest.Parse(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+  annotations:
+    checksum/config: abc
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: app
+        image: myapp:v1
+      - name: istio-proxy
+        image: proxyv2:1.1.0
+`, "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	new, err := manifest.Parse(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+  annotations:
+    checksum/config: def
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: app
+        image: myapp:v2
+      - name: istio-proxy
+        image: proxyv2:1.2.0
+`, "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var rules []*IgnoreRule
+	for _, r := range []string{
+		`Deployment:spec.replicas`,
+		`*:metadata.annotations["checksum/*"]`,
+		`Deployment:spec.template.spec.containers[name=istio-proxy]`,
+		`Service:spec.template`,
+	} {
+		rule, err := ParseIgnoreRule(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	ignorer := &Ignorer{Rules: rules}
+
+	changes, err := Resources(old, new, Opts{Ignore: ignorer})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(changes) != 1 {
+		t.Fatalf("unexpected number of changes: expected 1, got %d", len(changes))
+	}
+
+	fields := NewReport(changes).Changes[0].FieldsChanged
+	if len(fields) != 1 || fields[0] != "spec.template.spec.containers" {
+		t.Errorf("unexpected fields changed: %v", fields)
+	}
+
+	if ignorer.Suppressed != 2 {
+		t.Errorf("unexpected number of suppressed changes: expected 2, got %d", ignorer.Suppressed)
+	}
+
+	if old[0].Object["spec"].(map[string]interface{})["replicas"] != 1 {
+		t.Errorf("the resource has been modified in-place")
+	}
+}
+
+func TestThreeWayIgnore(t *testing.T) {
+	parse := func(replicas int) []*manifest.Resource {
+		resources, err := manifest.Parse(fmt.Sprintf(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+spec:
+  replicas: %d
+`, replicas), "default")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resources
+	}
+
+	rule, err := ParseIgnoreRule("Deployment:spec.replicas")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ignorer := &Ignorer{Rules: []*IgnoreRule{rule}}
+
+	// Both the pending change and the drift are in the ignored field, like the replicas scaled by an autoscaler
+	changes, err := ThreeWay(parse(1), parse(3), parse(5), Opts{Ignore: ignorer})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(changes) != 0 {
+		t.Errorf("unexpected changes: expected none, got %v", changes)
+	}
+
+	if ignorer.Suppressed != 2 {
+		t.Errorf("unexpected number of suppressed changes: expected 2, got %d", ignorer.Suppressed)
+	}
+}
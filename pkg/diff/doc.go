@@ -0,0 +1,2 @@
+// diff compares K8s manifests resource by resource, without relying on the helm-diff plugin.
+package diff
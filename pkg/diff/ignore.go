@@ -0,0 +1,270 @@
+package diff
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IgnoreRule removes the fields at the path from the resources of the kind before they are compared
+type IgnoreRule struct {
+	// Kind is the kind of the resources the rule applies to. `*` or empty matches any kind
+	Kind string `yaml:"kind"`
+
+	// Path is the JSONPath-like path to the fields to be ignored, like `spec.replicas`,
+	// `metadata.annotations["checksum/*"]` and `spec.template.spec.containers[name=istio-proxy].image`.
+	//
+	// Keys can contain glob patterns. `[*]` matches every element of a list, `[N]` the N-th element,
+	// and `[KEY=VALUE]` the elements whose KEY field equals to VALUE
+	Path string `yaml:"path"`
+
+	segments []segment
+}
+
+type segment struct {
+	// key is the glob pattern that matches the keys of a map
+	key string
+
+	// index is the index of the list element matched by the segment. -1 matches every element
+	index int
+
+	// selectKey and selectValue select the list elements whose selectKey field equals to selectValue
+	selectKey, selectValue string
+
+	isList bool
+}
+
+// Ignorer removes the fields matched by the rules from the resources, and counts the changes suppressed by them
+type Ignorer struct {
+	Rules []*IgnoreRule
+
+	// Suppressed is the number of the changed fields that have been ignored
+	Suppressed int
+}
+
+// ParseIgnoreRule parses the rule in the `KIND:PATH` format like `Deployment:spec.replicas`
+func ParseIgnoreRule(s string) (*IgnoreRule, error) {
+	items := strings.SplitN(s, ":", 2)
+	if len(items) != 2 {
+		return nil, fmt.Errorf("invalid ignore rule \"%s\": must be in the format of KIND:PATH", s)
+	}
+	return newIgnoreRule(items[0], items[1])
+}
+
+// LoadIgnoreRules loads the rules from the YAML file like:
+//
+//	ignore:
+//	- kind: Deployment
+//	  path: spec.replicas
+//	- kind: "*"
+//	  path: metadata.annotations["checksum/*"]
+func LoadIgnoreRules(file string) ([]*IgnoreRule, error) {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var f struct {
+		Ignore []*IgnoreRule `yaml:"ignore"`
+	}
+
+	if err := yaml.Unmarshal(bs, &f); err != nil {
+		return nil, fmt.Errorf("unable to parse ignore rules from %s: %v", file, err)
+	}
+
+	var rules []*IgnoreRule
+	for _, r := range f.Ignore {
+		rule, err := newIgnoreRule(r.Kind, r.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func newIgnoreRule(kind, p string) (*IgnoreRule, error) {
+	segments, err := parsePath(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ignore rule \"%s:%s\": %v", kind, p, err)
+	}
+	return &IgnoreRule{Kind: kind, Path: p, segments: segments}, nil
+}
+
+func parsePath(p string) ([]segment, error) {
+	p = strings.TrimPrefix(strings.TrimSuffix(strings.TrimPrefix(p, "{"), "}"), "$")
+
+	var segments []segment
+
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+		case '[':
+			end := closingBracket(p)
+			if end < 0 {
+				return nil, fmt.Errorf("missing ] in %s", p)
+			}
+			seg, err := parseBracket(p[1:end])
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, seg)
+			p = p[end+1:]
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			segments = append(segments, segment{key: p[:end]})
+			p = p[end:]
+		}
+	}
+
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	return segments, nil
+}
+
+// closingBracket returns the index of the `]` that closes the bracket at the head of p, skipping quoted strings
+func closingBracket(p string) int {
+	quoted := false
+	for i := 1; i < len(p); i++ {
+		switch p[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ']':
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseBracket(s string) (segment, error) {
+	switch {
+	case strings.HasPrefix(s, `"`) || strings.HasPrefix(s, `'`):
+		key, err := strconv.Unquote(`"` + strings.Trim(s, `"'`) + `"`)
+		if err != nil {
+			return segment{}, fmt.Errorf("invalid key %s: %v", s, err)
+		}
+		return segment{key: key}, nil
+	case s == "*":
+		return segment{isList: true, index: -1}, nil
+	case strings.Contains(s, "="):
+		kv := strings.SplitN(s, "=", 2)
+		return segment{isList: true, selectKey: strings.TrimSpace(kv[0]), selectValue: strings.Trim(strings.TrimSpace(kv[1]), `"'`)}, nil
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return segment{}, fmt.Errorf("invalid index [%s]: must be a quoted key, *, a number or KEY=VALUE", s)
+	}
+
+	return segment{isList: true, index: i}, nil
+}
+
+func (r *IgnoreRule) matchesKind(kind string) bool {
+	return r.Kind == "" || r.Kind == "*" || r.Kind == kind
+}
+
+// apply returns the copy of the object without the fields matched by the rules
+func (ig *Ignorer) apply(kind string, obj map[string]interface{}) map[string]interface{} {
+	if ig == nil || obj == nil {
+		return obj
+	}
+
+	var result interface{} = obj
+
+	copied := false
+
+	for _, r := range ig.Rules {
+		if !r.matchesKind(kind) {
+			continue
+		}
+		if !copied {
+			// Copy before the first removal, so that the resources are never modified in-place
+			result = deepCopy(result)
+			copied = true
+		}
+		result = remove(result, r.segments)
+	}
+
+	m, _ := result.(map[string]interface{})
+
+	return m
+}
+
+// remove removes the fields at the path from v, and returns the result
+func remove(v interface{}, segments []segment) interface{} {
+	seg, last := segments[0], len(segments) == 1
+
+	switch typed := v.(type) {
+	case map[string]interface{}:
+		if seg.isList {
+			return v
+		}
+		for k, child := range typed {
+			if ok, _ := path.Match(seg.key, k); !ok {
+				continue
+			}
+			if last {
+				delete(typed, k)
+			} else {
+				typed[k] = remove(child, segments[1:])
+			}
+		}
+		return typed
+	case []interface{}:
+		if !seg.isList {
+			return v
+		}
+		result := make([]interface{}, 0, len(typed))
+		for i, child := range typed {
+			if !seg.matchesElement(i, child) {
+				result = append(result, child)
+			} else if !last {
+				result = append(result, remove(child, segments[1:]))
+			}
+		}
+		return result
+	}
+
+	return v
+}
+
+func (s segment) matchesElement(i int, v interface{}) bool {
+	if s.selectKey != "" {
+		m, ok := v.(map[string]interface{})
+		return ok && fmt.Sprint(m[s.selectKey]) == s.selectValue
+	}
+	return s.index < 0 || s.index == i
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch typed := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(typed))
+		for k, child := range typed {
+			c[k] = deepCopy(child)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(typed))
+		for i, child := range typed {
+			c[i] = deepCopy(child)
+		}
+		return c
+	}
+	return v
+}
@@ -0,0 +1,192 @@
+package diff
+
+type op int
+
+const (
+	opEqual op = iota
+	opDelete
+	opInsert
+)
+
+type edit struct {
+	op   op
+	text string
+}
+
+// diffLines computes the shortest edit script that turns a into b, by using the Myers' algorithm.
+// See http://www.xmailserver.org/diff2.pdf and https://blog.jcoglan.com/2017/02/12/the-myers-diff-algorithm-part-1/
+func diffLines(a, b []string) []edit {
+	// Common prefix and suffix are trimmed beforehand, so that the cost of the algorithm depends only on the changed part
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := []edit{}
+	for _, l := range a[:prefix] {
+		edits = append(edits, edit{op: opEqual, text: l})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		edits = append(edits, edit{op: opEqual, text: l})
+	}
+
+	return edits
+}
+
+func myers(a, b []string) []edit {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+
+	v := make([]int, 2*max+3)
+
+	// trace[d] holds v[-d..d] at the beginning of the d-th iteration, which is required to backtrack the edit script
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[offset-d:offset+d+1])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	var reversed []edit
+
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		snapshot := trace[d]
+		at := func(k int) int { return snapshot[k+d] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, edit{op: opEqual, text: a[x-1]})
+			x--
+			y--
+		}
+
+		if x == prevX {
+			reversed = append(reversed, edit{op: opInsert, text: b[y-1]})
+		} else {
+			reversed = append(reversed, edit{op: opDelete, text: a[x-1]})
+		}
+
+		x, y = prevX, prevY
+	}
+
+	for x > 0 && y > 0 {
+		reversed = append(reversed, edit{op: opEqual, text: a[x-1]})
+		x--
+		y--
+	}
+
+	edits := make([]edit, 0, len(reversed))
+	for i := len(reversed) - 1; i >= 0; i-- {
+		edits = append(edits, reversed[i])
+	}
+
+	return edits
+}
+
+// hunk is a group of edits with the surrounding context lines
+type hunk struct {
+	oldStart, oldLines int
+	newStart, newLines int
+
+	edits []edit
+}
+
+// hunks groups the edits into hunks, each surrounded by the context lines.
+// Hunks whose contexts overlap are merged into one.
+func hunks(edits []edit, context int) []hunk {
+	var changed []int
+	for i, e := range edits {
+		if e.op != opEqual {
+			changed = append(changed, i)
+		}
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	var ranges [][2]int
+	start, end := changed[0], changed[0]
+	for _, i := range changed[1:] {
+		if i-end > 2*context {
+			ranges = append(ranges, [2]int{start, end})
+			start = i
+		}
+		end = i
+	}
+	ranges = append(ranges, [2]int{start, end})
+
+	var result []hunk
+
+	for _, r := range ranges {
+		from := r[0] - context
+		if from < 0 {
+			from = 0
+		}
+		to := r[1] + context + 1
+		if to > len(edits) {
+			to = len(edits)
+		}
+
+		h := hunk{oldStart: 1, newStart: 1, edits: edits[from:to]}
+
+		for _, e := range edits[:from] {
+			if e.op != opInsert {
+				h.oldStart++
+			}
+			if e.op != opDelete {
+				h.newStart++
+			}
+		}
+
+		for _, e := range h.edits {
+			if e.op != opInsert {
+				h.oldLines++
+			}
+			if e.op != opDelete {
+				h.newLines++
+			}
+		}
+
+		result = append(result, h)
+	}
+
+	return result
+}
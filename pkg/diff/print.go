@@ -0,0 +1,124 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorCyan   = "\x1b[36m"
+)
+
+// PrintOpts controls how changes are printed
+type PrintOpts struct {
+	// Context is the number of unchanged lines shown around each changed line
+	Context int
+
+	// NoColor disables colorizing the output with ANSI escape sequences
+	NoColor bool
+}
+
+func (o PrintOpts) colorize(color, s string) string {
+	if o.NoColor {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// Print writes the changes to w in the unified diff format, resource by resource.
+// Changes to hooks are written after the others, under the "hooks:" header
+func Print(w io.Writer, changes []*Change, opts PrintOpts) error {
+	var hooks []*Change
+
+	for _, c := range changes {
+		if c.IsHook() {
+			hooks = append(hooks, c)
+			continue
+		}
+		if err := printChange(w, c, opts); err != nil {
+			return err
+		}
+	}
+
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	if _, err := fmt.Fprintln(w, "hooks:"); err != nil {
+		return err
+	}
+
+	for _, c := range hooks {
+		if err := printChange(w, c, opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func printChange(w io.Writer, c *Change, opts PrintOpts) error {
+	var verb string
+	switch c.Action {
+	case ActionAdd:
+		verb = "has been added"
+	case ActionRemove:
+		verb = "has been removed"
+	default:
+		verb = "has changed"
+	}
+
+	if _, err := fmt.Fprintln(w, opts.colorize(colorYellow, fmt.Sprintf("%s %s:", c.label(), verb))); err != nil {
+		return err
+	}
+
+	if err := printEdits(w, c, opts); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintln(w)
+
+	return err
+}
+
+// printEdits writes the changed lines of the resource, grouped into hunks with the context lines
+func printEdits(w io.Writer, c *Change, opts PrintOpts) error {
+	edits := diffLines(splitLines(c.Before), splitLines(c.After))
+
+	var hs []hunk
+	if c.Action == ActionChange {
+		hs = hunks(edits, opts.Context)
+	} else {
+		hs = []hunk{{edits: edits}}
+	}
+
+	for _, h := range hs {
+		if c.Action == ActionChange {
+			header := fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.oldStart, h.oldLines, h.newStart, h.newLines)
+			if _, err := fmt.Fprintln(w, opts.colorize(colorCyan, header)); err != nil {
+				return err
+			}
+		}
+
+		for _, e := range h.edits {
+			var line string
+			switch e.op {
+			case opDelete:
+				line = opts.colorize(colorRed, "- "+e.text)
+			case opInsert:
+				line = opts.colorize(colorGreen, "+ "+e.text)
+			default:
+				line = "  " + e.text
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package diff
+
+// Prune drops the fields from the live object that are set by neither of the templates, like the ones defaulted or
+// populated by the API server and controllers, so that only the fields managed by the release are compared.
+//
+// Elements of lists are matched by their `name` fields if any, or by their indices otherwise.
+func Prune(live map[string]interface{}, templates ...map[string]interface{}) map[string]interface{} {
+	var ts []interface{}
+	for _, t := range templates {
+		if t != nil {
+			ts = append(ts, t)
+		}
+	}
+
+	if len(ts) == 0 {
+		return live
+	}
+
+	pruned, _ := prune(live, ts).(map[string]interface{})
+
+	return pruned
+}
+
+func prune(live interface{}, templates []interface{}) interface{} {
+	switch typed := live.(type) {
+	case map[string]interface{}:
+		var tmaps []map[string]interface{}
+		for _, t := range templates {
+			if m, ok := t.(map[string]interface{}); ok {
+				tmaps = append(tmaps, m)
+			}
+		}
+
+		if len(tmaps) == 0 {
+			return live
+		}
+
+		result := map[string]interface{}{}
+		for k, v := range typed {
+			var children []interface{}
+			for _, t := range tmaps {
+				if c, ok := t[k]; ok {
+					children = append(children, c)
+				}
+			}
+
+			if len(children) == 0 {
+				continue
+			}
+
+			result[k] = prune(v, children)
+		}
+
+		return result
+	case []interface{}:
+		var tlists [][]interface{}
+		for _, t := range templates {
+			if l, ok := t.([]interface{}); ok {
+				tlists = append(tlists, l)
+			}
+		}
+
+		if len(tlists) == 0 {
+			return live
+		}
+
+		result := make([]interface{}, 0, len(typed))
+		for i, v := range typed {
+			var children []interface{}
+			for _, l := range tlists {
+				if c := matchElement(l, i, v); c != nil {
+					children = append(children, c)
+				}
+			}
+
+			if len(children) == 0 {
+				result = append(result, v)
+			} else {
+				result = append(result, prune(v, children))
+			}
+		}
+
+		return result
+	}
+
+	return live
+}
+
+// matchElement returns the element in the list that corresponds to the i-th live element v
+func matchElement(list []interface{}, i int, v interface{}) interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		if name, ok := m["name"].(string); ok {
+			for _, e := range list {
+				if em, ok := e.(map[string]interface{}); ok && em["name"] == name {
+					return e
+				}
+			}
+			return nil
+		}
+	}
+
+	if i < len(list) {
+		return list[i]
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Report is the machine-readable representation of the changes, emitted by `helm x diff --output json|yaml`
+type Report struct {
+	Changes []Entry `json:"changes"`
+	Summary Summary `json:"summary"`
+}
+
+// Entry is a change made to a resource
+type Entry struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Action     Action `json:"action"`
+
+	// HookEvents is the events the hook is run on. Omitted unless the resource is a helm hook
+	HookEvents []string `json:"hookEvents,omitempty"`
+
+	// Patch is the JSON merge patch(RFC 7386) that turns the old resource into the new one.
+	// The whole new resource for additions, and null for removals
+	Patch interface{} `json:"patch"`
+
+	// FieldsChanged is the sorted list of the paths to the changed fields like `spec.replicas` and
+	// `metadata.annotations["checksum/config"]`. Empty for additions and removals
+	FieldsChanged []string `json:"fieldsChanged"`
+}
+
+// Summary is the number of the changes per action
+type Summary struct {
+	Added   int `json:"added"`
+	Changed int `json:"changed"`
+	Removed int `json:"removed"`
+
+	// Suppressed is the number of the changed fields ignored by the ignore rules
+	Suppressed int `json:"suppressed"`
+}
+
+// NewReport turns the changes into a report
+func NewReport(changes []*Change) *Report {
+	report := &Report{Changes: []Entry{}}
+
+	for _, c := range changes {
+		e := Entry{
+			APIVersion:    c.APIVersion,
+			Kind:          c.Kind,
+			Namespace:     c.Namespace,
+			Name:          c.Name,
+			Action:        c.Action,
+			HookEvents:    c.HookEvents,
+			FieldsChanged: []string{},
+		}
+
+		switch c.Action {
+		case ActionAdd:
+			e.Patch = c.after
+			report.Summary.Added++
+		case ActionRemove:
+			report.Summary.Removed++
+		default:
+			e.Patch = mergePatch(c.before, c.after)
+			e.FieldsChanged = changedFields("", c.before, c.after, nil)
+			sort.Strings(e.FieldsChanged)
+			report.Summary.Changed++
+		}
+
+		report.Changes = append(report.Changes, e)
+	}
+
+	return report
+}
+
+// WriteJSON writes the report to w in indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	bs, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(bs))
+	return err
+}
+
+// WriteYAML writes the report to w in YAML
+func (r *Report) WriteYAML(w io.Writer) error {
+	bs, err := yaml.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bs)
+	return err
+}
+
+// mergePatch returns the JSON merge patch that turns old into new.
+// See https://tools.ietf.org/html/rfc7386
+func mergePatch(old, new map[string]interface{}) map[string]interface{} {
+	patch := map[string]interface{}{}
+
+	for k, ov := range old {
+		nv, ok := new[k]
+		if !ok {
+			patch[k] = nil
+			continue
+		}
+
+		if reflect.DeepEqual(ov, nv) {
+			continue
+		}
+
+		om, ook := ov.(map[string]interface{})
+		nm, nok := nv.(map[string]interface{})
+		if ook && nok {
+			patch[k] = mergePatch(om, nm)
+		} else {
+			patch[k] = nv
+		}
+	}
+
+	for k, nv := range new {
+		if _, ok := old[k]; !ok {
+			patch[k] = nv
+		}
+	}
+
+	return patch
+}
+
+var identPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// fieldPath appends the key to the path in the JSONPath-like notation used by FieldsChanged
+func fieldPath(path, key string) string {
+	if !identPattern.MatchString(key) {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// changedFields appends the paths to the leaf fields that differ between old and new to fields.
+// Lists are compared as a whole, as they are in merge patches
+func changedFields(path string, old, new interface{}, fields []string) []string {
+	om, ook := old.(map[string]interface{})
+	nm, nok := new.(map[string]interface{})
+
+	if !ook || !nok {
+		if !reflect.DeepEqual(old, new) {
+			fields = append(fields, path)
+		}
+		return fields
+	}
+
+	for k, ov := range om {
+		nv, ok := nm[k]
+		if !ok {
+			fields = append(fields, fieldPath(path, k))
+			continue
+		}
+		fields = changedFields(fieldPath(path, k), ov, nv, fields)
+	}
+
+	for k := range nm {
+		if _, ok := om[k]; !ok {
+			fields = append(fields, fieldPath(path, k))
+		}
+	}
+
+	return fields
+}
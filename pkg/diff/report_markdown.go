@@ -0,0 +1,207 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// kindGroup is the changes made to the resources of a kind
+type kindGroup struct {
+	kind    string
+	changes []*Change
+	summary Summary
+}
+
+// groupByKind groups the changes by their kinds, sorted by the kinds. Hooks are grouped separately from the others
+func groupByKind(changes []*Change) []*kindGroup {
+	groups := map[string]*kindGroup{}
+
+	for _, c := range changes {
+		kind := c.Kind
+		if c.IsHook() {
+			kind += " (hooks)"
+		}
+
+		g, ok := groups[kind]
+		if !ok {
+			g = &kindGroup{kind: kind}
+			groups[kind] = g
+		}
+
+		g.changes = append(g.changes, c)
+
+		switch c.Action {
+		case ActionAdd:
+			g.summary.Added++
+		case ActionRemove:
+			g.summary.Removed++
+		default:
+			g.summary.Changed++
+		}
+	}
+
+	kinds := []string{}
+	for k := range groups {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+
+	var result []*kindGroup
+	for _, k := range kinds {
+		result = append(result, groups[k])
+	}
+
+	return result
+}
+
+// unifiedDiff returns the uncolored diff of the change
+func unifiedDiff(c *Change, opts PrintOpts) (string, error) {
+	opts.NoColor = true
+
+	buf := &bytes.Buffer{}
+	if err := printEdits(buf, c, opts); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// PrintMarkdown writes the changes to w as a Markdown report suitable for pull request comments.
+//
+// The report starts with the table of the numbers of the added, changed and removed resources per kind, followed by
+// the diffs grouped by kind in collapsible sections. suppressed is the number of changes ignored by the ignore rules.
+func PrintMarkdown(w io.Writer, changes []*Change, suppressed int, opts PrintOpts) error {
+	groups := groupByKind(changes)
+	total := NewReport(changes).Summary
+
+	buf := &bytes.Buffer{}
+
+	buf.WriteString("## helm-x diff\n\n")
+
+	if len(changes) == 0 {
+		buf.WriteString("No changes.\n")
+	} else {
+		buf.WriteString("| Kind | Added | Changed | Removed |\n")
+		buf.WriteString("|------|------:|--------:|--------:|\n")
+		for _, g := range groups {
+			fmt.Fprintf(buf, "| %s | %d | %d | %d |\n", g.kind, g.summary.Added, g.summary.Changed, g.summary.Removed)
+		}
+		fmt.Fprintf(buf, "| **Total** | **%d** | **%d** | **%d** |\n", total.Added, total.Changed, total.Removed)
+	}
+
+	if suppressed > 0 {
+		fmt.Fprintf(buf, "\n%d change(s) suppressed by ignore rules.\n", suppressed)
+	}
+
+	for _, g := range groups {
+		fmt.Fprintf(buf, "\n<details>\n<summary>%s (%d)</summary>\n", html.EscapeString(g.kind), len(g.changes))
+
+		for _, c := range g.changes {
+			d, err := unifiedDiff(c, opts)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(buf, "\n#### %s `%s`\n\n", c.Action, c.label())
+			fence := codeFence(d)
+			fmt.Fprintf(buf, "%sdiff\n%s%s\n", fence, d, fence)
+		}
+
+		buf.WriteString("\n</details>\n")
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// codeFence returns the backticks long enough to not be closed by the content
+func codeFence(content string) string {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	return fence
+}
+
+// PrintHTML writes the changes to w as a self-contained HTML report, in the same structure as PrintMarkdown
+func PrintHTML(w io.Writer, changes []*Change, suppressed int, opts PrintOpts) error {
+	groups := groupByKind(changes)
+	total := NewReport(changes).Summary
+
+	buf := &bytes.Buffer{}
+
+	buf.WriteString(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>helm-x diff</title>
+<style>
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; }
+td.count { text-align: right; }
+pre { background: #f6f8fa; padding: 8px; }
+.add { color: #22863a; background: #f0fff4; }
+.remove { color: #b31d28; background: #ffeef0; }
+.hunk { color: #005cc5; }
+</style>
+</head>
+<body>
+<h2>helm-x diff</h2>
+`)
+
+	if len(changes) == 0 {
+		buf.WriteString("<p>No changes.</p>\n")
+	} else {
+		buf.WriteString("<table>\n<tr><th>Kind</th><th>Added</th><th>Changed</th><th>Removed</th></tr>\n")
+		for _, g := range groups {
+			fmt.Fprintf(buf, "<tr><td>%s</td><td class=\"count\">%d</td><td class=\"count\">%d</td><td class=\"count\">%d</td></tr>\n", html.EscapeString(g.kind), g.summary.Added, g.summary.Changed, g.summary.Removed)
+		}
+		fmt.Fprintf(buf, "<tr><th>Total</th><th>%d</th><th>%d</th><th>%d</th></tr>\n</table>\n", total.Added, total.Changed, total.Removed)
+	}
+
+	if suppressed > 0 {
+		fmt.Fprintf(buf, "<p>%d change(s) suppressed by ignore rules.</p>\n", suppressed)
+	}
+
+	for _, g := range groups {
+		fmt.Fprintf(buf, "<details>\n<summary>%s (%d)</summary>\n", html.EscapeString(g.kind), len(g.changes))
+
+		for _, c := range g.changes {
+			d, err := unifiedDiff(c, opts)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(buf, "<h4>%s <code>%s</code></h4>\n<pre>", c.Action, html.EscapeString(c.label()))
+
+			for _, line := range splitLines(d) {
+				escaped := html.EscapeString(line)
+				switch {
+				case strings.HasPrefix(line, "@@"):
+					fmt.Fprintf(buf, "<span class=\"hunk\">%s</span>\n", escaped)
+				case strings.HasPrefix(line, "+"):
+					fmt.Fprintf(buf, "<span class=\"add\">%s</span>\n", escaped)
+				case strings.HasPrefix(line, "-"):
+					fmt.Fprintf(buf, "<span class=\"remove\">%s</span>\n", escaped)
+				default:
+					fmt.Fprintf(buf, "%s\n", escaped)
+				}
+			}
+
+			buf.WriteString("</pre>\n")
+		}
+
+		buf.WriteString("</details>\n")
+	}
+
+	buf.WriteString("</body>\n</html>\n")
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
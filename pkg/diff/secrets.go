@@ -0,0 +1,66 @@
+package diff
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// redactSecrets masks the values in data and stringData of the old and new Secrets, while keeping the changed values distinguishable.
+// Unchanged values are masked as `REDACTED`, removed ones as `--------` and added or changed ones as `++++++++`, with their sizes.
+func redactSecrets(old, new map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	old, new = shallowCopy(old), shallowCopy(new)
+
+	for _, field := range []string{"data", "stringData"} {
+		oldData, _ := old[field].(map[string]interface{})
+		newData, _ := new[field].(map[string]interface{})
+
+		redactedOld := map[string]interface{}{}
+		redactedNew := map[string]interface{}{}
+
+		for k, v := range oldData {
+			if nv, ok := newData[k]; ok && fmt.Sprint(nv) == fmt.Sprint(v) {
+				redactedOld[k] = fmt.Sprintf("REDACTED # (%d bytes)", secretSize(field, v))
+			} else {
+				redactedOld[k] = fmt.Sprintf("-------- # (%d bytes)", secretSize(field, v))
+			}
+		}
+
+		for k, v := range newData {
+			if ov, ok := oldData[k]; ok && fmt.Sprint(ov) == fmt.Sprint(v) {
+				redactedNew[k] = fmt.Sprintf("REDACTED # (%d bytes)", secretSize(field, v))
+			} else {
+				redactedNew[k] = fmt.Sprintf("++++++++ # (%d bytes)", secretSize(field, v))
+			}
+		}
+
+		if old != nil && oldData != nil {
+			old[field] = redactedOld
+		}
+		if new != nil && newData != nil {
+			new[field] = redactedNew
+		}
+	}
+
+	return old, new
+}
+
+func secretSize(field string, v interface{}) int {
+	s := fmt.Sprintf("%v", v)
+	if field == "data" {
+		if decoded, err := base64.StdEncoding.DecodeString(s); err == nil {
+			return len(decoded)
+		}
+	}
+	return len(s)
+}
+
+func shallowCopy(obj map[string]interface{}) map[string]interface{} {
+	if obj == nil {
+		return nil
+	}
+	c := map[string]interface{}{}
+	for k, v := range obj {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,122 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+// ThreeWayChange is the set of changes made to a resource, among the desired, the last-applied and the live states
+type ThreeWayChange struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+
+	// Pending is the change from the last-applied state to the desired state, that is going to be made by the next apply.
+	// Nil when there's no pending change
+	Pending *Change
+
+	// Drift is the change from the last-applied state to the live state, that has been made outside of helm, like
+	// `kubectl edit`. Nil when the resource hasn't drifted
+	Drift *Change
+}
+
+func (c *ThreeWayChange) String() string {
+	return fmt.Sprintf("%s, %s, %s (%s)", c.Namespace, c.Name, c.Kind, c.APIVersion)
+}
+
+// ThreeWay compares the desired, the last-applied and the live resources, and returns the resources that have either
+// pending changes or drifts, sorted by their keys.
+func ThreeWay(lastApplied, desired, live []*manifest.Resource, opts Opts) ([]*ThreeWayChange, error) {
+	pending, err := Resources(lastApplied, desired, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	drifts, err := Resources(lastApplied, live, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]*ThreeWayChange{}
+
+	get := func(c *Change) *ThreeWayChange {
+		key := fmt.Sprintf("%s/%s/%s/%s", c.APIVersion, c.Kind, c.Namespace, c.Name)
+		twc, ok := changes[key]
+		if !ok {
+			twc = &ThreeWayChange{APIVersion: c.APIVersion, Kind: c.Kind, Namespace: c.Namespace, Name: c.Name}
+			changes[key] = twc
+		}
+		return twc
+	}
+
+	for _, c := range pending {
+		get(c).Pending = c
+	}
+
+	for _, c := range drifts {
+		get(c).Drift = c
+	}
+
+	keys := []string{}
+	for k := range changes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var result []*ThreeWayChange
+	for _, k := range keys {
+		result = append(result, changes[k])
+	}
+
+	return result, nil
+}
+
+// PrintThreeWay writes the pending changes and the drifts of each resource to w
+func PrintThreeWay(w io.Writer, changes []*ThreeWayChange, opts PrintOpts) error {
+	for _, c := range changes {
+		if _, err := fmt.Fprintln(w, opts.colorize(colorYellow, fmt.Sprintf("%s:", c))); err != nil {
+			return err
+		}
+
+		sections := []struct {
+			title  string
+			change *Change
+			verbs  map[Action]string
+		}{
+			{
+				title:  "pending changes (last-applied -> desired)",
+				change: c.Pending,
+				verbs:  map[Action]string{ActionAdd: "to be added", ActionChange: "to be changed", ActionRemove: "to be removed"},
+			},
+			{
+				title:  "drift (last-applied -> live)",
+				change: c.Drift,
+				verbs:  map[Action]string{ActionAdd: "created outside of helm", ActionChange: "modified outside of helm", ActionRemove: "deleted outside of helm"},
+			},
+		}
+
+		for _, s := range sections {
+			if s.change == nil {
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, "%s, %s:\n", s.title, s.verbs[s.change.Action]); err != nil {
+				return err
+			}
+
+			if err := printEdits(w, s.change, opts); err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,18 +1,17 @@
 package helmx
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"strings"
 
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/helm/pkg/tiller/environment"
-
-	"github.com/mumoshu/helm-x/pkg/releasetool"
 )
 
 type AdoptOpts struct {
@@ -56,6 +55,17 @@ func getActiveContext(pathOptions *clientcmd.PathOptions) string {
 	return ""
 }
 
+// namespaceOrDefault returns the namespace if not empty, or the namespace of the active kubeconfig context, or "default"
+func namespaceOrDefault(namespace string, pathOptions *clientcmd.PathOptions) string {
+	if namespace != "" {
+		return namespace
+	}
+	if ns := getActiveContext(pathOptions); ns != "" {
+		return ns
+	}
+	return "default"
+}
+
 func (r *Runner) Adopt(release string, resources []string, pathOptions *clientcmd.PathOptions, opts ...AdoptOption) error {
 	o := &AdoptOpts{}
 	for i := range opts {
@@ -68,105 +78,132 @@ func (r *Runner) Adopt(release string, resources []string, pathOptions *clientcm
 	if tillerNs == "" {
 		tillerNs = getTillerNamespace()
 	}
-	namespace := o.Namespace
 
-	var storage *releasetool.ReleaseTool
-	var err error
 	switch o.TillerStorageBackend {
-	case "configmaps":
-		storage, err = releasetool.NewConfigMapBackedReleaseTool(tillerNs)
-		if err != nil {
-			return err
-		}
-	case "secrets":
-		storage, err = releasetool.NewSecretBackednReleaseTool(tillerNs)
-		if err != nil {
-			return err
-		}
+	case "configmaps", "secrets":
 	default:
 		return errors.Errorf("unsupported tiller storage backend: %s", o.TillerStorageBackend)
 	}
 
-	kubectlArgs := []string{"get", "-o=json"}
-
-	var ns string
-	if namespace != "" {
-		ns = namespace
-	} else {
-		ns = getActiveContext(pathOptions)
-		if ns == "" {
-			ns = "default"
-		}
+	storage, err := r.releaseTool(tillerNs, o.TillerStorageBackend)
+	if err != nil {
+		return err
 	}
-	kubectlArgs = append(kubectlArgs, "-n="+ns)
 
-	kubectlArgs = append(kubectlArgs, resources...)
+	ns := namespaceOrDefault(o.Namespace, pathOptions)
 
-	jsonData, err := r.Run("kubectl", kubectlArgs...)
+	refs, err := parseResourceRefs(resources, ns)
 	if err != nil {
 		return err
 	}
 
-	var manifest string
-
-	if len(resources) == 1 {
-		item := map[string]interface{}{}
+	items, err := r.getResourcesByRefs(refs, false)
+	if err != nil {
+		return err
+	}
 
-		if err := json.Unmarshal([]byte(jsonData), &item); err != nil {
-			return err
-		}
+	var manifest string
 
+	for _, item := range items {
 		yamlData, err := YamlMarshal(item)
 		if err != nil {
 			return err
 		}
 
-		item = export(item)
+		manifest += fmt.Sprintf("\n---\n# Source: helm-x-dummy-chart/templates/%s\n", templatePath(item, ns)) + string(yamlData)
+	}
 
-		yamlData, err = YamlMarshal(item)
-		if err != nil {
-			return err
-		}
+	if manifest == "" {
+		return fmt.Errorf("no resources to be adopted")
+	}
 
-		metadata := item["metadata"].(map[string]interface{})
-		escaped := fmt.Sprintf("%s.%s", metadata["name"], strings.ToLower(item["kind"].(string)))
-		manifest += fmt.Sprintf("\n---\n# Source: helm-x-dummy-chart/templates/%s.yaml\n", escaped) + string(yamlData)
-	} else {
-		type jsonVal struct {
-			Items []map[string]interface{} `json:"items"`
-		}
-		v := jsonVal{}
+	if err := storage.AdoptIntoRelease(release, ns, manifest); err != nil {
+		return err
+	}
 
-		if err := json.Unmarshal([]byte(jsonData), &v); err != nil {
-			return err
-		}
+	return nil
+}
 
-		for _, item := range v.Items {
-			yamlData, err := YamlMarshal(item)
-			if err != nil {
-				return err
-			}
+// getResources fetches the resources from the namespace and sanitizes them with `export`.
+// The resources are fetched without specifying the namespace when ns is empty, which is the case for cluster-scoped resources.
+// Missing resources are silently skipped when ignoreNotFound is true.
+func (r *Runner) getResources(ns string, resources []string, ignoreNotFound bool) ([]map[string]interface{}, error) {
+	items, err := r.getObjects(ns, resources, ignoreNotFound)
+	if err != nil {
+		return nil, err
+	}
 
-			item = export(item)
+	for i := range items {
+		items[i] = export(items[i])
+	}
 
-			yamlData, err = YamlMarshal(item)
-			if err != nil {
-				return err
-			}
+	return items, nil
+}
 
-			metadata := item["metadata"].(map[string]interface{})
-			escaped := fmt.Sprintf("%s.%s", metadata["name"], strings.ToLower(item["kind"].(string)))
-			manifest += fmt.Sprintf("\n---\n# Source: helm-x-dummy-chart/templates/%s.yaml\n", escaped) + string(yamlData)
-		}
+// getObjects fetches the resources from the namespace as they are, including their statuses
+func (r *Runner) getObjects(ns string, resources []string, ignoreNotFound bool) ([]map[string]interface{}, error) {
+	kubectlArgs := []string{"get", "-o=json"}
+
+	if ns != "" {
+		kubectlArgs = append(kubectlArgs, "-n="+ns)
 	}
 
-	if manifest == "" {
-		return fmt.Errorf("no resources to be adopted")
+	if ignoreNotFound {
+		kubectlArgs = append(kubectlArgs, "--ignore-not-found")
 	}
 
-	if err := storage.AdoptRelease(release, ns, manifest); err != nil {
-		return err
+	kubectlArgs = append(kubectlArgs, resources...)
+
+	jsonData, err := r.Run("kubectl", kubectlArgs...)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	var items []map[string]interface{}
+
+	if strings.TrimSpace(jsonData) == "" {
+		return items, nil
+	}
+
+	// JSON is decoded as YAML so that integers are kept as integers rather than float64s,
+	// which would otherwise be marshaled like `1e+06`
+	item := map[string]interface{}{}
+
+	if err := yaml.Unmarshal([]byte(jsonData), &item); err != nil {
+		return nil, err
+	}
+
+	if item["kind"] != "List" {
+		items = append(items, item)
+	} else {
+		type jsonVal struct {
+			Items []map[string]interface{} `yaml:"items"`
+		}
+		v := jsonVal{}
+
+		if err := yaml.Unmarshal([]byte(jsonData), &v); err != nil {
+			return nil, err
+		}
+
+		items = append(items, v.Items...)
+	}
+
+	return items, nil
+}
+
+// templateFileName returns the name of the template file for the resource, like `<name>.<kind>.yaml`
+func templateFileName(item map[string]interface{}) string {
+	metadata := item["metadata"].(map[string]interface{})
+	return fmt.Sprintf("%s.%s.yaml", metadata["name"], strings.ToLower(item["kind"].(string)))
+}
+
+// templatePath returns the path to the template file for the resource relative to the templates directory.
+// Resources outside of the release namespace are put under the directory named after their namespace, so that
+// resources with the same kind and name in different namespaces never collide.
+func templatePath(item map[string]interface{}, releaseNs string) string {
+	metadata := item["metadata"].(map[string]interface{})
+	if ns, _ := metadata["namespace"].(string); ns != "" && ns != releaseNs {
+		return path.Join(ns, templateFileName(item))
+	}
+	return templateFileName(item)
 }
@@ -0,0 +1,259 @@
+package helmx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	rspb "k8s.io/helm/pkg/proto/hapi/release"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+// helmArgs appends the flags to connect to the release storage to the args of the helm command
+func (r *Runner) helmArgs(o UpgradeOpts, args ...string) []string {
+	if r.IsHelm3() {
+		if o.Namespace != "" {
+			args = append(args, "--namespace", o.Namespace)
+		}
+	} else if o.TillerNamespace != "" {
+		args = append(args, "--tiller-namespace", o.TillerNamespace)
+	}
+	if o.KubeContext != "" {
+		args = append(args, "--kube-context", o.KubeContext)
+	}
+	if !r.IsHelm3() {
+		if o.TLS {
+			args = append(args, "--tls")
+		}
+		if o.TLSCert != "" {
+			args = append(args, "--tls-cert", o.TLSCert)
+		}
+		if o.TLSKey != "" {
+			args = append(args, "--tls-key", o.TLSKey)
+		}
+	}
+	return args
+}
+
+// DeployedRevision returns the latest revision of the release whose status is DEPLOYED, or 0 if there's none
+func (r *Runner) DeployedRevision(release string, o UpgradeOpts) (int, error) {
+	deployed, _, err := r.Revisions(release, o)
+	return deployed, err
+}
+
+// Revisions returns the latest revision of the release whose status is DEPLOYED, and the latest revision regardless of
+// its status. Either is 0 if there's none.
+//
+// The latest revision recorded before `helm x apply` tells the revisions created by the apply from the older ones
+func (r *Runner) Revisions(release string, o UpgradeOpts) (int, int, error) {
+	if !r.IsHelm3() {
+		storage, err := r.releaseTool(o.TillerNamespace, o.TillerStorageBackend)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		history, err := storage.History(release)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				return 0, 0, nil
+			}
+			return 0, 0, err
+		}
+
+		var deployed, latest int
+		for _, rel := range history {
+			v := int(rel.Version)
+			if rel.Info != nil && rel.Info.Status != nil && rel.Info.Status.Code == rspb.Status_DEPLOYED && v > deployed {
+				deployed = v
+			}
+			if v > latest {
+				latest = v
+			}
+		}
+
+		return deployed, latest, nil
+	}
+
+	stdout, stderr, err := r.CaptureBytes(r.HelmBin(), r.helmArgs(o, "history", release, "--output", "json", "--max", "256"))
+	if err != nil {
+		if strings.Contains(string(stderr), "not found") {
+			return 0, 0, nil
+		}
+		return 0, 0, fmt.Errorf("%v: %s", err, string(stderr))
+	}
+
+	var history []struct {
+		Revision int    `json:"revision"`
+		Status   string `json:"status"`
+	}
+
+	if err := json.Unmarshal(stdout, &history); err != nil {
+		return 0, 0, fmt.Errorf("unable to parse the history of release %s: %v", release, err)
+	}
+
+	var deployed, latest int
+	for _, h := range history {
+		if strings.EqualFold(h.Status, "deployed") && h.Revision > deployed {
+			deployed = h.Revision
+		}
+		if h.Revision > latest {
+			latest = h.Revision
+		}
+	}
+
+	return deployed, latest, nil
+}
+
+// RollbackPoint is the state of the release and its resources before `helm x apply`, which RollbackFailedUpgrade
+// reverts the release to
+type RollbackPoint struct {
+	// Previous is the revision deployed before the apply, or 0 if there's none
+	Previous int
+
+	// Latest is the latest revision before the apply regardless of its status, so that the revisions created by the
+	// apply can be told from the older ones
+	Latest int
+
+	// resources are the resources rendered for the apply
+	resources []*manifest.Resource
+
+	// existing is the set of the keys of the rendered resources that existed before the apply
+	existing map[string]bool
+}
+
+// NewRollbackPoint records the revisions of the release, and which of the resources in the rendered manifest m exist
+// before the apply, so that a failed install deletes only the resources it has created
+func (r *Runner) NewRollbackPoint(release, m string, o UpgradeOpts) (*RollbackPoint, error) {
+	previous, latest, err := r.Revisions(release, o)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := manifest.Parse(m, o.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &RollbackPoint{Previous: previous, Latest: latest, resources: resources, existing: map[string]bool{}}
+
+	var refs []ResourceRef
+	for _, res := range resources {
+		refs = append(refs, ResourceRef{Kind: kubectlType(res), Namespace: res.Namespace, Name: res.Name})
+	}
+
+	if len(refs) == 0 {
+		return p, nil
+	}
+
+	objs, err := r.getObjectsByRefs(refs, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, obj := range objs {
+		p.existing[objectKey(obj)] = true
+	}
+
+	return p, nil
+}
+
+// RollbackFailedUpgrade reverts the release to the state before the failed `helm x apply`, and returns the
+// descriptions of what have been rolled back.
+//
+// The release is rolled back to the revision deployed before the apply, when there's one. Otherwise it's uninstalled.
+// With Helm 2, when any of the resources existed before the apply, like the ones adopted in this run or the ones the
+// install failed on with "already exists", only the resources created by the failed install are deleted, and the
+// release records are removed, so that the existing resources are left unmanaged as they were before.
+func (r *Runner) RollbackFailedUpgrade(release string, p *RollbackPoint, o UpgradeOpts) ([]string, error) {
+	if p.Previous > 0 {
+		_, stderr, err := r.CaptureBytes(r.HelmBin(), r.helmArgs(o, "rollback", release, strconv.Itoa(p.Previous)))
+		if err != nil {
+			return nil, fmt.Errorf("unable to roll back release %s to revision %d: %v: %s", release, p.Previous, err, string(stderr))
+		}
+
+		return []string{fmt.Sprintf("rolled back release %s to revision %d", release, p.Previous)}, nil
+	}
+
+	if !r.IsHelm3() && len(p.existing) > 0 {
+		return r.revertInstall(release, p, o)
+	}
+
+	var args []string
+	if r.IsHelm3() {
+		args = r.helmArgs(o, "uninstall", release)
+	} else {
+		args = r.helmArgs(o, "delete", "--purge", release)
+	}
+
+	_, stderr, err := r.CaptureBytes(r.HelmBin(), args)
+	if err != nil {
+		if strings.Contains(string(stderr), "not found") {
+			return []string{fmt.Sprintf("release %s has not been created. nothing to roll back", release)}, nil
+		}
+		return nil, fmt.Errorf("unable to uninstall release %s: %v: %s", release, err, string(stderr))
+	}
+
+	return []string{fmt.Sprintf("uninstalled release %s", release)}, nil
+}
+
+// revertInstall deletes the resources created by the failed install, and removes the release records without
+// deleting the resources that existed before the apply, as `helm delete --purge` would delete them, too
+func (r *Runner) revertInstall(release string, p *RollbackPoint, o UpgradeOpts) ([]string, error) {
+	var created, existing []ResourceRef
+	for _, res := range p.resources {
+		ref := ResourceRef{Kind: res.Kind, Namespace: res.Namespace, Name: res.Name}
+		if p.existing[resourceKey(res)] {
+			existing = append(existing, ref)
+		} else {
+			created = append(created, ref)
+		}
+	}
+
+	var report []string
+
+	if len(created) > 0 {
+		namespaces, groups := groupByNamespace(created)
+		for _, ns := range namespaces {
+			args := []string{"delete", "--ignore-not-found"}
+			if ns != "" {
+				args = append(args, "-n="+ns)
+			}
+			args = append(args, groups[ns]...)
+
+			if _, err := r.Run("kubectl", args...); err != nil {
+				return report, fmt.Errorf("unable to delete the resources created by the failed install: %v", err)
+			}
+		}
+
+		report = append(report, fmt.Sprintf("deleted %d resource(s) created by the failed install of release %s:", len(created), release))
+		for _, c := range created {
+			report = append(report, "  "+c.String())
+		}
+	}
+
+	storage, err := r.releaseTool(o.TillerNamespace, o.TillerStorageBackend)
+	if err != nil {
+		return report, err
+	}
+
+	// Tiller may have failed before recording the release
+	deleted, err := storage.DeleteRelease(release)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		return report, fmt.Errorf("unable to remove the records of release %s: %v", release, err)
+	}
+
+	report = append(report, fmt.Sprintf("removed %d revision(s) of release %s, leaving %d existing resource(s) unmanaged as before:", len(deleted), release, len(existing)))
+	for _, e := range existing {
+		report = append(report, "  "+e.String())
+	}
+
+	return report, nil
+}
+
+// resourceKey identifies the resource regardless of its API version, so that the live objects can be matched with the
+// rendered resources
+func resourceKey(res *manifest.Resource) string {
+	return fmt.Sprintf("%s/%s/%s", res.Kind, res.Namespace, res.Name)
+}
@@ -0,0 +1,187 @@
+package helmx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/variantdev/chartify"
+
+	"github.com/mumoshu/helm-x/pkg/releasetool"
+)
+
+func TestUpgradeOptsCheckOptions(t *testing.T) {
+	testcases := []struct {
+		opts  UpgradeOpts
+		helm3 bool
+		valid bool
+	}{
+		{opts: UpgradeOpts{Atomic: true}, valid: true},
+		{opts: UpgradeOpts{Tillerless: true}, valid: true},
+		{opts: UpgradeOpts{ServerSide: true}, valid: true},
+		{opts: UpgradeOpts{Atomic: true, Tillerless: true}, valid: false},
+		{opts: UpgradeOpts{Atomic: true, ServerSide: true}, valid: false},
+		{opts: UpgradeOpts{Atomic: true, AutoAdopt: true}, valid: true},
+		{opts: UpgradeOpts{Atomic: true, AutoAdopt: true}, helm3: true, valid: false},
+		{opts: UpgradeOpts{AutoAdopt: true}, helm3: true, valid: true},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		err := tc.opts.CheckOptions(tc.helm3)
+
+		if tc.valid && err != nil {
+			t.Errorf("unexpected error for case %d: %v", i, err)
+		}
+
+		if !tc.valid && err == nil {
+			t.Errorf("expected error for case %d, got none", i)
+		}
+	}
+}
+
+func TestRollbackFailedUpgrade(t *testing.T) {
+	defer stubKubectl(t)()
+
+	helm, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const m = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+`
+
+	const (
+		deployment = `{"kind": "Deployment", "metadata": {"name": "app", "namespace": "prod"}}`
+		configMap  = `{"kind": "ConfigMap", "metadata": {"name": "config", "namespace": "prod"}}`
+	)
+
+	testcases := []struct {
+		helm3 bool
+
+		// history is the output of `helm history` before the apply
+		history string
+
+		// existing is the JSON of the rendered resources that exist before the apply
+		existing []string
+
+		// adopted is the manifest adopted in this run with Helm 2
+		adopted string
+
+		calls  []string
+		report []string
+	}{
+		{
+			helm3:   true,
+			history: `[{"revision": 1, "status": "superseded"}, {"revision": 2, "status": "deployed"}, {"revision": 3, "status": "failed"}]`,
+			calls: []string{
+				"helm history myapp --output json --max 256 --namespace prod",
+				"kubectl get -o=json -n=prod --ignore-not-found Deployment.v1.apps/app Service/app ConfigMap/config",
+				"helm rollback myapp 2 --namespace prod",
+			},
+			report: []string{"rolled back release myapp to revision 2"},
+		},
+		{
+			// The Deployment has been adopted, and the install failed before reaching the existing ConfigMap
+			existing: []string{deployment, configMap},
+			adopted:  "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n  namespace: prod\n",
+			calls: []string{
+				"kubectl get -o=json -n=prod --ignore-not-found Deployment.v1.apps/app Service/app ConfigMap/config",
+				"kubectl delete --ignore-not-found -n=prod Service/app",
+			},
+			report: []string{
+				"deleted 1 resource(s) created by the failed install of release myapp:",
+				"  prod/Service/app",
+				"removed 1 revision(s) of release myapp, leaving 2 existing resource(s) unmanaged as before:",
+				"  prod/Deployment/app",
+				"  prod/ConfigMap/config",
+			},
+		},
+		{
+			calls: []string{
+				"kubectl get -o=json -n=prod --ignore-not-found Deployment.v1.apps/app Service/app ConfigMap/config",
+				"helm delete --purge myapp",
+			},
+			report: []string{"uninstalled release myapp"},
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		var calls []string
+
+		r := New(HelmBin(helm), UseHelm3(tc.helm3), Commander(func(cmd string, args []string, stdout, stderr io.Writer, env map[string]string) error {
+			if cmd != "kubectl" {
+				cmd = "helm"
+			}
+
+			// Helm 2 is detected by `helm version`
+			if args[0] == "version" {
+				fmt.Fprint(stdout, "Client: v2.16.1")
+				return nil
+			}
+
+			calls = append(calls, cmd+" "+strings.Join(args, " "))
+
+			switch {
+			case cmd == "kubectl" && args[0] == "get":
+				fmt.Fprintf(stdout, `{"kind": "List", "items": [%s]}`, strings.Join(tc.existing, ","))
+			case cmd == "helm" && args[0] == "history":
+				fmt.Fprint(stdout, tc.history)
+			}
+
+			return nil
+		}))
+
+		storage := releasetool.NewMemoryReleaseTool()
+		r.releaseStorage = storage
+
+		o := UpgradeOpts{ChartifyOpts: &chartify.ChartifyOpts{Namespace: "prod"}, ClientOpts: &ClientOpts{}, Atomic: true}
+
+		p, err := r.NewRollbackPoint("myapp", m, o)
+		if err != nil {
+			t.Fatalf("unexpected error for case %d: %v", i, err)
+		}
+
+		if tc.adopted != "" {
+			if err := storage.AdoptRelease("myapp", "prod", tc.adopted); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		report, err := r.RollbackFailedUpgrade("myapp", p, o)
+		if err != nil {
+			t.Fatalf("unexpected error for case %d: %v", i, err)
+		}
+
+		if !reflect.DeepEqual(calls, tc.calls) {
+			t.Errorf("unexpected commands for case %d:\nexpected=%q\ngot=%q", i, tc.calls, calls)
+		}
+
+		if !reflect.DeepEqual(report, tc.report) {
+			t.Errorf("unexpected report for case %d:\nexpected=%q\ngot=%q", i, tc.report, report)
+		}
+
+		if history, _ := storage.History("myapp"); len(history) > 0 {
+			t.Errorf("expected the records of the release to be removed for case %d", i)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package helmx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	// Helm 3.2 and greater, which imports the existing resources into the release once they have the ownership metadata.
+	// Helm 3.0 and 3.1 can't import existing resources at all, so their errors are intentionally left unparsed:
+	//   rendered manifests contain a resource that already exists. Unable to continue with install: Deployment "foo" in namespace "default" exists and cannot be imported into the current release: ...
+	alreadyExistsHelm32Pattern = regexp.MustCompile(`(\w+) "([^"]+)" in namespace "([^"]*)" exists and cannot be imported`)
+
+	// Helm 2:
+	//   Error: release foo failed: deployments.apps "foo" already exists
+	alreadyExistsHelm2Pattern = regexp.MustCompile(`([\w.-]+) "([^"]+)" already exists`)
+)
+
+// ParseAlreadyExists extracts the resources that made `helm upgrade` fail with "already exists" from the error message.
+// defaultNamespace is used for resources whose namespace is not included in the message, which is the case for Helm 2.
+func ParseAlreadyExists(errMsg, defaultNamespace string) []ResourceRef {
+	var conflicts []ResourceRef
+
+	seen := map[string]struct{}{}
+
+	add := func(c ResourceRef) {
+		k := c.String()
+		if _, ok := seen[k]; ok {
+			return
+		}
+		seen[k] = struct{}{}
+		conflicts = append(conflicts, c)
+	}
+
+	for _, m := range alreadyExistsHelm32Pattern.FindAllStringSubmatch(errMsg, -1) {
+		add(ResourceRef{Kind: m[1], Name: m[2], Namespace: m[3]})
+	}
+
+	if len(conflicts) == 0 {
+		for _, m := range alreadyExistsHelm2Pattern.FindAllStringSubmatch(errMsg, -1) {
+			// Helm 2 never includes namespaces in the message, and reports only the first conflict
+			add(ResourceRef{Kind: m[1], Name: m[2], Namespace: defaultNamespace})
+		}
+	}
+
+	return conflicts
+}
+
+// Helm 3.2 and greater imports the existing resources having the label and the annotations into the release
+const (
+	helm3ManagedByLabel             = "app.kubernetes.io/managed-by"
+	helm3ReleaseNameAnnotation      = "meta.helm.sh/release-name"
+	helm3ReleaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+)
+
+// AdoptConflicting adopts the resources that made `helm upgrade` fail with "already exists" into the release,
+// so that the upgrade can be retried.
+//
+// With Helm 2, the resources are adopted by writing the release record into the Tiller storage like Adopt does,
+// as a new revision on top of the latest one when the release already exists.
+// With Helm 3, the resources are labeled and annotated as owned by the release, so that Helm imports them on the retry.
+//
+// It returns the adopted resources, or an empty slice when the error isn't caused by already existing resources.
+func (r *Runner) AdoptConflicting(release string, upgradeErr error, pathOptions *clientcmd.PathOptions, opts ...AdoptOption) ([]ResourceRef, error) {
+	o := &AdoptOpts{}
+	for i := range opts {
+		if err := opts[i].SetAdoptOption(o); err != nil {
+			return nil, err
+		}
+	}
+
+	conflicts := ParseAlreadyExists(upgradeErr.Error(), o.Namespace)
+	if len(conflicts) == 0 {
+		return nil, nil
+	}
+
+	if r.IsHelm3() {
+		if err := r.setHelm3Ownership(release, namespaceOrDefault(o.Namespace, pathOptions), conflicts); err != nil {
+			return nil, err
+		}
+
+		return conflicts, nil
+	}
+
+	resources := []string{}
+	for _, c := range conflicts {
+		resources = append(resources, c.String())
+	}
+
+	if err := r.Adopt(release, resources, pathOptions, opts...); err != nil {
+		return nil, err
+	}
+
+	return conflicts, nil
+}
+
+// setHelm3Ownership marks the resources as owned by the release in the namespace
+func (r *Runner) setHelm3Ownership(release, releaseNs string, refs []ResourceRef) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]string{
+				helm3ManagedByLabel: "Helm",
+			},
+			"annotations": map[string]string{
+				helm3ReleaseNameAnnotation:      release,
+				helm3ReleaseNamespaceAnnotation: releaseNs,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		args := []string{"patch", ref.Ref(), "--type=merge", "-p", string(patch)}
+		if ref.Namespace != "" {
+			args = append(args, "-n="+ref.Namespace)
+		}
+
+		if out, err := r.Run("kubectl", args...); err != nil {
+			return fmt.Errorf("unable to mark %s as owned by release %s: %v: %s", ref, release, err, out)
+		}
+	}
+
+	return nil
+}
+
+// UpgradeWithAdoption adopts the resources in o.Adopt, and then upgrades the release.
+//
+// When o.AutoAdopt is set and the upgrade fails with "already exists", the conflicting resources are adopted with
+// AdoptConflicting and the upgrade is retried once.
+func (r *Runner) UpgradeWithAdoption(release, chart string, o UpgradeOpts, pathOptions *clientcmd.PathOptions) error {
+	out := o.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	if len(o.Adopt) > 0 {
+		// The storage backend is passed so that --adopt honors --tiller-storage-backend as `helm x adopt` does
+		if err := r.Adopt(
+			release,
+			o.Adopt,
+			pathOptions,
+			TillerNamespace(o.TillerNamespace),
+			Namespace(o.Namespace),
+			TillerStorageBackend(o.TillerStorageBackend),
+		); err != nil {
+			return err
+		}
+	}
+
+	err := r.Upgrade(release, chart, o)
+	if err == nil || !o.AutoAdopt {
+		return err
+	}
+
+	adopted, adoptErr := r.AdoptConflicting(
+		release,
+		err,
+		pathOptions,
+		TillerNamespace(o.TillerNamespace),
+		Namespace(o.Namespace),
+		TillerStorageBackend(o.TillerStorageBackend),
+	)
+	if adoptErr != nil {
+		return fmt.Errorf("%v\nauto-adoption failed: %v", err, adoptErr)
+	}
+
+	if len(adopted) == 0 {
+		return err
+	}
+
+	fmt.Fprintf(out, "adopted %d existing resource(s) into release %s:\n", len(adopted), release)
+	for _, a := range adopted {
+		fmt.Fprintf(out, "  %s\n", a)
+	}
+
+	return r.Upgrade(release, chart, o)
+}
@@ -0,0 +1,296 @@
+package helmx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mumoshu/helm-x/pkg/releasetool"
+	"github.com/variantdev/chartify"
+	rspb "k8s.io/helm/pkg/proto/hapi/release"
+)
+
+func TestParseAlreadyExists(t *testing.T) {
+	testcases := []struct {
+		msg      string
+		expected []ResourceRef
+	}{
+		{
+			msg:      `Error: release myapp failed: deployments.apps "myapp" already exists`,
+			expected: []ResourceRef{{Kind: "deployments.apps", Namespace: "default", Name: "myapp"}},
+		},
+		{
+			// Helm 3.0 and 3.1 can't import existing resources
+			msg:      `Error: rendered manifests contain a resource that already exists. Unable to continue with install: existing resource conflict: kind: ConfigMap, namespace: foo, name: myapp`,
+			expected: nil,
+		},
+		{
+			msg:      `Error: rendered manifests contain a resource that already exists. Unable to continue with install: existing resource conflict: namespace: foo, name: myapp, existing_kind: apps/v1, Kind=Deployment, new_kind: apps/v1, Kind=Deployment`,
+			expected: nil,
+		},
+		{
+			msg:      `Error: rendered manifests contain a resource that already exists. Unable to continue with install: Service "myapp" in namespace "foo" exists and cannot be imported into the current release: invalid ownership metadata`,
+			expected: []ResourceRef{{Kind: "Service", Namespace: "foo", Name: "myapp"}},
+		},
+		{
+			msg:      `Error: UPGRADE FAILED: timed out waiting for the condition`,
+			expected: nil,
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		actual := ParseAlreadyExists(tc.msg, "default")
+
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("unexpected result for case %d: expected=%v, got=%v", i, tc.expected, actual)
+		}
+	}
+}
+
+func TestUpgradeWithAutoAdoptionHelm3(t *testing.T) {
+	helm, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer stubKubectl(t)()
+
+	const (
+		helm32Conflict = `Error: rendered manifests contain a resource that already exists. Unable to continue with install: Deployment "myapp" in namespace "prod" exists and cannot be imported into the current release: invalid ownership metadata; ClusterRole "myapp" in namespace "" exists and cannot be imported into the current release: invalid ownership metadata`
+		helm30Conflict = `Error: rendered manifests contain a resource that already exists. Unable to continue with install: existing resource conflict: kind: Deployment, namespace: prod, name: myapp`
+		patch          = `{"metadata":{"annotations":{"meta.helm.sh/release-name":"myapp","meta.helm.sh/release-namespace":"prod"},"labels":{"app.kubernetes.io/managed-by":"Helm"}}}`
+	)
+
+	testcases := []struct {
+		// failures is the stderr of each failed `helm upgrade`
+		failures []string
+
+		err   string
+		calls []string
+		out   string
+	}{
+		{
+			failures: []string{helm32Conflict},
+			calls: []string{
+				"helm upgrade",
+				"kubectl patch Deployment/myapp --type=merge -p " + patch + " -n=prod",
+				"kubectl patch ClusterRole/myapp --type=merge -p " + patch,
+				"helm upgrade",
+			},
+			// Followed by the empty output of the successful `helm upgrade`
+			out: "adopted 2 existing resource(s) into release myapp:\n  prod/Deployment/myapp\n  ClusterRole/myapp\n\n",
+		},
+		{
+			failures: []string{helm32Conflict, helm32Conflict},
+			err:      helm32Conflict,
+			calls: []string{
+				"helm upgrade",
+				"kubectl patch Deployment/myapp --type=merge -p " + patch + " -n=prod",
+				"kubectl patch ClusterRole/myapp --type=merge -p " + patch,
+				"helm upgrade",
+			},
+			out: "adopted 2 existing resource(s) into release myapp:\n  prod/Deployment/myapp\n  ClusterRole/myapp\n",
+		},
+		{
+			// Not retried, as Helm 3.0 and 3.1 can't import the existing resources
+			failures: []string{helm30Conflict},
+			err:      helm30Conflict,
+			calls:    []string{"helm upgrade"},
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		var calls []string
+		var upgrades int
+
+		r := New(HelmBin(helm), UseHelm3(true), Commander(func(cmd string, args []string, stdout, stderr io.Writer, env map[string]string) error {
+			if cmd == "kubectl" {
+				calls = append(calls, "kubectl "+strings.Join(args, " "))
+				return nil
+			}
+
+			calls = append(calls, "helm "+args[0])
+
+			upgrades++
+			if upgrades <= len(tc.failures) {
+				fmt.Fprint(stderr, tc.failures[upgrades-1])
+				return errors.New("exit status 1")
+			}
+
+			return nil
+		}))
+
+		out := &bytes.Buffer{}
+
+		o := UpgradeOpts{
+			ChartifyOpts: &chartify.ChartifyOpts{Namespace: "prod"},
+			ClientOpts:   &ClientOpts{},
+			AutoAdopt:    true,
+			Out:          out,
+		}
+
+		err := r.UpgradeWithAdoption("myapp", "/tmp/chart", o, nil)
+
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+
+		if errMsg != tc.err {
+			t.Errorf("unexpected error for case %d: expected=%q, got=%q", i, tc.err, errMsg)
+		}
+
+		if !reflect.DeepEqual(calls, tc.calls) {
+			t.Errorf("unexpected commands for case %d:\nexpected=%q\ngot=%q", i, tc.calls, calls)
+		}
+
+		if out.String() != tc.out {
+			t.Errorf("unexpected output for case %d:\nexpected=%q\ngot=%q", i, tc.out, out.String())
+		}
+	}
+}
+
+func TestUpgradeWithAutoAdoptionHelm2(t *testing.T) {
+	helm, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer stubKubectl(t)()
+
+	const (
+		helm2Conflict = `Error: release myapp failed: deployments.apps "myapp" already exists`
+		deployment    = `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "myapp", "namespace": "prod"}}`
+		previous      = "---\n# Source: myapp/templates/service.yaml\napiVersion: v1\nkind: Service\nmetadata:\n  name: myapp\n"
+	)
+
+	testcases := []struct {
+		// history is the statuses of the revisions of the release before the upgrade
+		history []rspb.Status_Code
+
+		// revisions is the versions and the statuses of the revisions after the adoption
+		revisions []string
+	}{
+		{
+			revisions: []string{"1 DEPLOYED"},
+		},
+		{
+			// Tiller records the failed install as a FAILED revision
+			history:   []rspb.Status_Code{rspb.Status_FAILED},
+			revisions: []string{"1 FAILED", "2 DEPLOYED"},
+		},
+		{
+			history:   []rspb.Status_Code{rspb.Status_SUPERSEDED, rspb.Status_DEPLOYED},
+			revisions: []string{"1 SUPERSEDED", "2 SUPERSEDED", "3 DEPLOYED"},
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		var calls []string
+		var upgrades int
+
+		r := New(HelmBin(helm), UseHelm3(false), Commander(func(cmd string, args []string, stdout, stderr io.Writer, env map[string]string) error {
+			if cmd == "kubectl" {
+				calls = append(calls, "kubectl "+strings.Join(args, " "))
+				fmt.Fprint(stdout, deployment)
+				return nil
+			}
+
+			// Helm 2 is detected by `helm version`
+			if args[0] == "version" {
+				fmt.Fprint(stdout, "Client: v2.16.1")
+				return nil
+			}
+
+			calls = append(calls, "helm "+args[0])
+
+			upgrades++
+			if upgrades == 1 {
+				fmt.Fprint(stderr, helm2Conflict)
+				return errors.New("exit status 1")
+			}
+
+			return nil
+		}))
+
+		storage := releasetool.NewMemoryReleaseTool()
+		r.releaseStorage = storage
+
+		for j, code := range tc.history {
+			rel, err := releasetool.NewRelease("myapp", "0.1.0", "myapp", "prod", previous, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rel.Version = int32(j + 1)
+			rel.Info.Status.Code = code
+
+			if err := storage.Create(rel); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		out := &bytes.Buffer{}
+
+		o := UpgradeOpts{
+			ChartifyOpts: &chartify.ChartifyOpts{Namespace: "prod"},
+			ClientOpts:   &ClientOpts{TillerStorageBackend: "configmaps"},
+			AutoAdopt:    true,
+			Out:          out,
+		}
+
+		if err := r.UpgradeWithAdoption("myapp", "/tmp/chart", o, nil); err != nil {
+			t.Fatalf("unexpected error for case %d: %v", i, err)
+		}
+
+		expectedCalls := []string{
+			"helm upgrade",
+			"kubectl get -o=json -n=prod deployments.apps/myapp",
+			"helm upgrade",
+		}
+		if !reflect.DeepEqual(calls, expectedCalls) {
+			t.Errorf("unexpected commands for case %d:\nexpected=%q\ngot=%q", i, expectedCalls, calls)
+		}
+
+		expectedOut := "adopted 1 existing resource(s) into release myapp:\n  prod/deployments.apps/myapp\n\n"
+		if out.String() != expectedOut {
+			t.Errorf("unexpected output for case %d:\nexpected=%q\ngot=%q", i, expectedOut, out.String())
+		}
+
+		history, err := storage.History("myapp")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sort.Slice(history, func(a, b int) bool { return history[a].Version < history[b].Version })
+
+		var revisions []string
+		for _, rel := range history {
+			revisions = append(revisions, fmt.Sprintf("%d %s", rel.Version, rel.Info.Status.Code))
+		}
+
+		if !reflect.DeepEqual(revisions, tc.revisions) {
+			t.Errorf("unexpected revisions for case %d:\nexpected=%q\ngot=%q", i, tc.revisions, revisions)
+		}
+
+		// The adopted Deployment is added to the manifest of the latest revision
+		latest := history[len(history)-1].Manifest
+		if len(tc.history) > 0 && !strings.Contains(latest, previous) {
+			t.Errorf("unexpected manifest for case %d: the previous manifest is missing: %q", i, latest)
+		}
+		if !strings.Contains(latest, "kind: Deployment") || !strings.Contains(latest, "name: myapp") {
+			t.Errorf("unexpected manifest for case %d: the adopted resource is missing: %q", i, latest)
+		}
+	}
+}
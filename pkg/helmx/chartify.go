@@ -1,9 +1,45 @@
 package helmx
 
-import "github.com/variantdev/chartify"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/variantdev/chartify"
+)
 
 func (r *Runner) Chartify(release, dirOrChart string, opts ...chartify.ChartifyOption) (string, error) {
 	rr := chartify.New(chartify.HelmBin(r.helmBin), chartify.UseHelm3(r.isHelm3))
 
 	return rr.Chartify(release, dirOrChart, opts...)
 }
+
+// rewriteTemplates calls f with the path and the content of every YAML template in the temporary chart generated by
+// Chartify, and writes the returned content back to the file when it's changed
+func rewriteTemplates(chart string, f func(path, content string) (string, error)) error {
+	return filepath.Walk(filepath.Join(chart, "templates"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml" {
+			return nil
+		}
+
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rewritten, err := f(path, string(bs))
+		if err != nil {
+			return err
+		}
+
+		if rewritten == string(bs) {
+			return nil
+		}
+
+		return ioutil.WriteFile(path, []byte(rewritten), info.Mode())
+	})
+}
@@ -0,0 +1,167 @@
+package helmx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mumoshu/helm-x/pkg/deprecation"
+	"github.com/mumoshu/helm-x/pkg/manifest"
+	"github.com/mumoshu/helm-x/pkg/releasetool"
+	"github.com/mumoshu/helm-x/pkg/validation"
+)
+
+// CheckDeprecatedAPIs finds the resources in the temporary chart generated by Chartify that use the APIs deprecated or
+// removed in KubeVersion, and rewrites them to the supported API versions when ConvertDeprecatedAPIs is set.
+//
+// The deprecated APIs are printed to out as warnings. The APIs removed in KubeVersion fail the check unless they're
+// converted. Does nothing unless either KubeVersion or ConvertDeprecatedAPIs is set.
+func (r *Runner) CheckDeprecatedAPIs(chart string, v *ValidateOpts, out io.Writer) error {
+	if v.KubeVersion == "" && !v.ConvertDeprecatedAPIs {
+		return nil
+	}
+
+	kubeVersion := v.KubeVersion
+	if kubeVersion == "" {
+		kubeVersion = validation.BundledKubeVersion
+	}
+
+	if out == nil {
+		out = os.Stdout
+	}
+
+	var removed []string
+
+	err := rewriteTemplates(chart, func(path, content string) (string, error) {
+		var findings []deprecation.Finding
+
+		if v.ConvertDeprecatedAPIs {
+			converted, fs, err := deprecation.ConvertManifest(content, kubeVersion)
+			if err != nil {
+				return "", err
+			}
+
+			content = converted
+			findings = fs
+		} else {
+			resources, err := manifest.Parse(content, "")
+			if err != nil {
+				return "", err
+			}
+
+			findings = deprecation.Check(resources, kubeVersion)
+		}
+
+		for _, f := range findings {
+			if f.Resource.Source == "" {
+				f.Resource.Source, _ = filepath.Rel(chart, path)
+			}
+
+			switch {
+			case f.Resource.Object["apiVersion"] != f.API.APIVersion:
+				fmt.Fprintf(out, "converted %s/%s in %s from %s to %s\n", f.Resource.Kind, f.Resource.Name, f.Resource.Source, f.API.APIVersion, f.Resource.Object["apiVersion"])
+			case f.Removed:
+				removed = append(removed, f.String())
+			default:
+				fmt.Fprintf(out, "warning: %s\n", f)
+			}
+		}
+
+		return content, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(removed) > 0 {
+		return fmt.Errorf("%d resource(s) use APIs removed in K8s %s. pass --convert-deprecated-apis to convert them:\n%s", len(removed), kubeVersion, strings.Join(removed, "\n"))
+	}
+
+	return nil
+}
+
+// ConvertReleaseOpts is the options for ConvertRelease
+type ConvertReleaseOpts struct {
+	*ClientOpts
+
+	TillerNamespace string
+
+	// KubeVersion is the target K8s version. Defaults to the version of the bundled schemas
+	KubeVersion string
+
+	// DryRun prints the converted manifest instead of storing it
+	DryRun bool
+
+	Out io.Writer
+}
+
+// ConvertRelease rewrites the manifest stored in the latest revision of the release, so that the resources using the
+// APIs deprecated or removed in KubeVersion are recorded with the supported API versions.
+//
+// This is mainly for the releases created by `helm x adopt`, whose manifests are the resources obtained from the
+// cluster in the API versions preferred at the time. Without the rewrite, Tiller fails to upgrade the release once the
+// stored API versions are removed from the cluster. Supported only with Helm 2.
+func (r *Runner) ConvertRelease(release string, o ConvertReleaseOpts) error {
+	if r.IsHelm3() {
+		return fmt.Errorf("converting the stored release is supported only with Helm 2, as it rewrites the release record in the Tiller storage")
+	}
+
+	out := o.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	kubeVersion := o.KubeVersion
+	if kubeVersion == "" {
+		kubeVersion = validation.BundledKubeVersion
+	}
+
+	tillerNs := o.TillerNamespace
+	if tillerNs == "" {
+		tillerNs = getTillerNamespace()
+	}
+
+	var backend string
+	if o.ClientOpts != nil {
+		backend = o.TillerStorageBackend
+	}
+
+	storage, err := releasetool.New(tillerNs, releasetool.Opts{StorageBackend: backend})
+	if err != nil {
+		return err
+	}
+
+	rel, err := storage.GetLatestRelease(release)
+	if err != nil {
+		return err
+	}
+
+	converted, findings, err := deprecation.ConvertManifest(rel.Manifest, kubeVersion)
+	if err != nil {
+		return fmt.Errorf("unable to convert release %s: %v", release, err)
+	}
+
+	for _, f := range findings {
+		fmt.Fprintln(out, f)
+	}
+
+	if converted == rel.Manifest {
+		fmt.Fprintf(out, "release %s has no resources to be converted for K8s %s\n", release, kubeVersion)
+		return nil
+	}
+
+	if o.DryRun {
+		fmt.Fprintf(out, "the manifest of release %s revision %d would be rewritten to:\n%s", release, rel.Version, converted)
+		return nil
+	}
+
+	if err := storage.UpdateManifest(rel, converted); err != nil {
+		return fmt.Errorf("unable to store the converted manifest of release %s: %v", release, err)
+	}
+
+	fmt.Fprintf(out, "rewrote the manifest of release %s revision %d for K8s %s\n", release, rel.Version, kubeVersion)
+
+	return nil
+}
@@ -6,11 +6,13 @@ import (
 	"github.com/mumoshu/helm-x/pkg/util"
 	"io"
 	"os/exec"
+	"strconv"
 )
 
 type DiffOpts struct {
 	*chartify.ChartifyOpts
 	*ClientOpts
+	*ValidateOpts
 
 	Chart string
 
@@ -20,9 +22,77 @@ type DiffOpts struct {
 	DetailedExitcode bool
 	ResetValues      bool
 
+	// Engine is either "helm-diff" to run `helm diff upgrade`, or "native" to use the diff engine built into helm-x
+	Engine string
+
+	// Against is either "release" to compare the desired state with the manifest of the deployed release, or "live"
+	// to compare it with the live objects in the cluster. "live" implies the native diff engine
+	Against string
+
+	// ThreeWay reports the desired, the last-applied and the live states of each resource, so that both drifts and
+	// pending changes show up. Implies the native diff engine
+	ThreeWay bool
+
+	// IncludeHooks compares the rendered hooks with the ones stored in the deployed release, too.
+	// Implies the native diff engine
+	IncludeHooks bool
+
+	// Context is the number of unchanged lines shown around each change. Defaults to 3
+	Context int
+
+	// NoColor disables colorizing the diff output
+	NoColor bool
+
+	// Output is either "text" to print the diff in the unified diff format, "json" or "yaml" to emit the
+	// machine-readable list of the changes, or "markdown" or "html" to write the report for pull request comments.
+	// Anything other than "text" implies the native diff engine
+	Output string
+
+	// ReportFile is the path to the file the diff is written to, instead of Out. Implies the native diff engine
+	ReportFile string
+
+	// Ignore is the list of the rules in the `KIND:PATH` format, like `Deployment:spec.replicas`, to remove the fields
+	// from both sides before comparing. Implies the native diff engine
+	Ignore []string
+
+	// IgnoreFile is the path to the YAML file containing the ignore rules. Implies the native diff engine
+	IgnoreFile string
+
+	// PinDigests is the path to the file mapping image tags to digests, which the rendered images are pinned to
+	PinDigests string
+
+	// Notify is the options for notifying the outcome to webhooks. Used only by the command line
+	Notify *NotifyOpts
+
 	Out io.Writer
 }
 
+const (
+	DiffEngineHelmDiff = "helm-diff"
+	DiffEngineNative   = "native"
+)
+
+const (
+	DiffAgainstRelease = "release"
+	DiffAgainstLive    = "live"
+)
+
+const (
+	DiffOutputText     = "text"
+	DiffOutputJSON     = "json"
+	DiffOutputYAML     = "yaml"
+	DiffOutputMarkdown = "markdown"
+	DiffOutputHTML     = "html"
+)
+
+func validateDiffOutput(output string) error {
+	switch output {
+	case "", DiffOutputText, DiffOutputJSON, DiffOutputYAML, DiffOutputMarkdown, DiffOutputHTML:
+		return nil
+	}
+	return fmt.Errorf("unsupported diff output \"%s\": must be one of %s, %s, %s, %s or %s", output, DiffOutputText, DiffOutputJSON, DiffOutputYAML, DiffOutputMarkdown, DiffOutputHTML)
+}
+
 /*func (o DiffOpts) GetSetValues() []string {
 	return o.SetValues
 }
@@ -81,6 +151,17 @@ func WithDiffOpts(opts diffOptsProvider) DiffOption {
 	return &diffOptsSetter{o: opts}
 }*/
 
+func (o *DiffOpts) context() int {
+	return contextOrDefault(o.Context)
+}
+
+func contextOrDefault(context int) int {
+	if context == 0 {
+		return 3
+	}
+	return context
+}
+
 type DiffOption interface {
 	SetDiffOption(*DiffOpts) error
 }
@@ -100,8 +181,50 @@ func (r *Runner) Diff(release, chart string, opts ...DiffOption) (bool, error) {
 		}
 	}
 
+	switch o.Against {
+	case "", DiffAgainstRelease:
+	case DiffAgainstLive:
+		o.Engine = DiffEngineNative
+	default:
+		return false, fmt.Errorf("unsupported diff target \"%s\": must be either %s or %s", o.Against, DiffAgainstRelease, DiffAgainstLive)
+	}
+
+	if o.ThreeWay {
+		o.Engine = DiffEngineNative
+	}
+
+	if o.IncludeHooks {
+		if o.Against == DiffAgainstLive || o.ThreeWay {
+			return false, fmt.Errorf("--include-hooks can only be used with --against %s", DiffAgainstRelease)
+		}
+		o.Engine = DiffEngineNative
+	}
+
+	if len(o.Ignore) > 0 || o.IgnoreFile != "" || o.ReportFile != "" {
+		o.Engine = DiffEngineNative
+	}
+
+	if err := validateDiffOutput(o.Output); err != nil {
+		return false, err
+	}
+
+	if o.Output != "" && o.Output != DiffOutputText {
+		if o.ThreeWay {
+			return false, fmt.Errorf("--output %s can't be used with --three-way", o.Output)
+		}
+		o.Engine = DiffEngineNative
+	}
+
+	switch o.Engine {
+	case "", DiffEngineHelmDiff:
+	case DiffEngineNative:
+		return r.nativeDiff(release, chart, o)
+	default:
+		return false, fmt.Errorf("unsupported diff engine \"%s\": must be either %s or %s", o.Engine, DiffEngineHelmDiff, DiffEngineNative)
+	}
+
 	var additionalFlags string
-	additionalFlags += util.CreateFlagChain("context", []string{"3"})
+	additionalFlags += util.CreateFlagChain("context", []string{strconv.Itoa(o.context())})
 	if len(o.SetValues) > 0 {
 		additionalFlags += util.CreateFlagChain("set", o.SetValues)
 	}
@@ -136,6 +259,9 @@ func (r *Runner) Diff(release, chart string, opts ...DiffOption) (bool, error) {
 	if o.DetailedExitcode {
 		additionalFlags += util.CreateFlagChain("detailed-exitcode", []string{""})
 	}
+	if o.NoColor {
+		additionalFlags += util.CreateFlagChain("no-color", []string{""})
+	}
 
 	command := fmt.Sprintf("%s diff upgrade %s %s%s", r.HelmBin(), release, chart, additionalFlags)
 	if err := r.DeprecatedExec(command); err != nil {
@@ -0,0 +1,121 @@
+package helmx
+
+import (
+	"io"
+	"os"
+
+	"github.com/variantdev/chartify"
+	"k8s.io/klog"
+
+	"github.com/mumoshu/helm-x/pkg/diff"
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+// DiffLocalOpts is the options for DiffLocal
+type DiffLocalOpts struct {
+	// A and B are the options used to chartify and render the sources A and B respectively
+	A *chartify.ChartifyOpts
+	B *chartify.ChartifyOpts
+
+	// Release is the release name passed to `helm template`
+	Release string
+
+	DetailedExitcode bool
+
+	Context    int
+	NoColor    bool
+	Output     string
+	Ignore     []string
+	IgnoreFile string
+	ReportFile string
+
+	Out io.Writer
+}
+
+// DiffLocal renders the two sources each with its own options, and compares the results resource by resource.
+//
+// A source is a directory containing manifests, a kustomization, a local or remote chart, or a directory or chart at
+// a git ref in the `git:REF:PATH` format. Unlike Diff, this never accesses the cluster nor Tiller.
+// It returns true when changes are detected and DetailedExitcode is set.
+func (r *Runner) DiffLocal(srcA, srcB string, o *DiffLocalOpts) (bool, error) {
+	if err := validateDiffOutput(o.Output); err != nil {
+		return false, err
+	}
+
+	release := o.Release
+	if release == "" {
+		release = "release-name"
+	}
+
+	a, err := r.renderSource(release, srcA, o.A)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := r.renderSource(release, srcB, o.B)
+	if err != nil {
+		return false, err
+	}
+
+	ignorer, err := newIgnorer(o.Ignore, o.IgnoreFile)
+	if err != nil {
+		return false, err
+	}
+
+	changes, err := diff.Resources(a, b, diff.Opts{SuppressSecrets: true, Ignore: ignorer})
+	if err != nil {
+		return false, err
+	}
+
+	out, closeOut, err := diffOutput(o.Out, o.ReportFile)
+	if err != nil {
+		return false, err
+	}
+	defer closeOut()
+
+	printOpts := diff.PrintOpts{Context: contextOrDefault(o.Context), NoColor: o.NoColor}
+
+	if err := printChanges(out, changes, printOpts, o.Output, ignorer.Suppressed); err != nil {
+		return false, err
+	}
+
+	return len(changes) > 0 && o.DetailedExitcode, nil
+}
+
+// renderSource chartifies and renders the source into resources
+func (r *Runner) renderSource(release, src string, o *chartify.ChartifyOpts) ([]*manifest.Resource, error) {
+	dir := src
+
+	if IsGitSource(src) {
+		path, tempDir, err := r.CheckoutGitSource(src)
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tempDir)
+
+		dir = path
+	}
+
+	chart, err := r.Chartify(release, dir, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Debug {
+		klog.Infof("helm chart for %s has been written to %s for you to see. please remove it afterwards", src, chart)
+	} else {
+		defer os.RemoveAll(chart)
+	}
+
+	rendered, err := r.Template(release, chart, o)
+	if err != nil {
+		return nil, err
+	}
+
+	ns := o.Namespace
+	if ns == "" {
+		ns = "default"
+	}
+
+	return manifest.Parse(rendered, ns)
+}
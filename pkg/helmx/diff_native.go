@@ -0,0 +1,351 @@
+package helmx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mumoshu/helm-x/pkg/diff"
+	"github.com/mumoshu/helm-x/pkg/manifest"
+	"github.com/mumoshu/helm-x/pkg/releasetool"
+	rspb "k8s.io/helm/pkg/proto/hapi/release"
+)
+
+// nativeDiff renders the chart with `helm template`, and compares the result with the manifest of the deployed release
+// or the live objects resource by resource, without relying on the helm-diff plugin.
+func (r *Runner) nativeDiff(release, chart string, o *DiffOpts) (bool, error) {
+	desiredManifest, err := r.Template(release, chart, o.ChartifyOpts)
+	if err != nil {
+		return false, err
+	}
+
+	ns := o.Namespace
+	if ns == "" {
+		ns = "default"
+	}
+
+	desired, err := manifest.Parse(desiredManifest, ns)
+	if err != nil {
+		return false, err
+	}
+
+	// Hooks are never stored in the release manifest, so they must be excluded to not be shown as added
+	desired, desiredHooks := manifest.SplitHooks(desired)
+
+	var current []*manifest.Resource
+
+	if o.Against != DiffAgainstLive || o.ThreeWay {
+		deployedManifest, deployed, err := r.DeployedManifest(release, o)
+		if err != nil {
+			return false, err
+		}
+
+		if !deployed && !o.AllowUnreleased {
+			return false, fmt.Errorf("release %s has not been deployed yet. specify --allow-unreleased to diff against an empty release", release)
+		}
+
+		current, err = manifest.Parse(deployedManifest, ns)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	out, closeOut, err := diffOutput(o.Out, o.ReportFile)
+	if err != nil {
+		return false, err
+	}
+	defer closeOut()
+
+	ignorer, err := newIgnorer(o.Ignore, o.IgnoreFile)
+	if err != nil {
+		return false, err
+	}
+
+	diffOpts := diff.Opts{SuppressSecrets: true, Ignore: ignorer}
+	printOpts := diff.PrintOpts{Context: o.context(), NoColor: o.NoColor}
+
+	var changed bool
+
+	switch {
+	case o.ThreeWay:
+		live, err := r.getLiveResources(ns, desired, current)
+		if err != nil {
+			return false, err
+		}
+
+		changes, err := diff.ThreeWay(current, desired, live, diffOpts)
+		if err != nil {
+			return false, err
+		}
+
+		if err := diff.PrintThreeWay(out, changes, printOpts); err != nil {
+			return false, err
+		}
+
+		for _, c := range changes {
+			if c.Pending != nil {
+				changed = true
+			}
+		}
+
+		if err := printSuppressed(out, ignorer.Suppressed); err != nil {
+			return false, err
+		}
+	case o.Against == DiffAgainstLive:
+		live, err := r.getLiveResources(ns, desired)
+		if err != nil {
+			return false, err
+		}
+
+		changes, err := diff.Resources(live, desired, diffOpts)
+		if err != nil {
+			return false, err
+		}
+
+		if err := printChanges(out, changes, printOpts, o.Output, ignorer.Suppressed); err != nil {
+			return false, err
+		}
+
+		changed = len(changes) > 0
+	default:
+		changes, err := diff.Resources(current, desired, diffOpts)
+		if err != nil {
+			return false, err
+		}
+
+		if o.IncludeHooks {
+			hookChanges, err := r.diffHooks(release, ns, desiredHooks, o, diffOpts)
+			if err != nil {
+				return false, err
+			}
+
+			changes = append(changes, hookChanges...)
+		}
+
+		if err := printChanges(out, changes, printOpts, o.Output, ignorer.Suppressed); err != nil {
+			return false, err
+		}
+
+		changed = len(changes) > 0
+	}
+
+	return changed && o.DetailedExitcode, nil
+}
+
+// diffHooks compares the rendered hooks with the ones stored in the deployed release
+func (r *Runner) diffHooks(release, ns string, desired []*manifest.Resource, o *DiffOpts, diffOpts diff.Opts) ([]*diff.Change, error) {
+	deployedHooks, _, err := r.DeployedHooks(release, o)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := manifest.Parse(deployedHooks, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	return diff.Resources(current, desired, diffOpts)
+}
+
+// newIgnorer returns the ignorer built from the ignore rules in the `KIND:PATH` format and the rules file
+func newIgnorer(rules []string, file string) (*diff.Ignorer, error) {
+	ignorer := &diff.Ignorer{}
+
+	for _, r := range rules {
+		rule, err := diff.ParseIgnoreRule(r)
+		if err != nil {
+			return nil, err
+		}
+		ignorer.Rules = append(ignorer.Rules, rule)
+	}
+
+	if file != "" {
+		rules, err := diff.LoadIgnoreRules(file)
+		if err != nil {
+			return nil, err
+		}
+		ignorer.Rules = append(ignorer.Rules, rules...)
+	}
+
+	return ignorer, nil
+}
+
+// diffOutput returns the writer the diff is written to, that is the report file if any, or out, or STDOUT.
+// The returned func closes the report file
+func diffOutput(out io.Writer, reportFile string) (io.Writer, func(), error) {
+	if reportFile != "" {
+		f, err := os.Create(reportFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return f, func() { f.Close() }, nil
+	}
+
+	if out == nil {
+		out = os.Stdout
+	}
+
+	return out, func() {}, nil
+}
+
+// printChanges writes the changes to w in the output format
+func printChanges(w io.Writer, changes []*diff.Change, opts diff.PrintOpts, output string, suppressed int) error {
+	switch output {
+	case DiffOutputMarkdown:
+		return diff.PrintMarkdown(w, changes, suppressed, opts)
+	case DiffOutputHTML:
+		return diff.PrintHTML(w, changes, suppressed, opts)
+	case DiffOutputJSON, DiffOutputYAML:
+		report := diff.NewReport(changes)
+		report.Summary.Suppressed = suppressed
+		if output == DiffOutputJSON {
+			return report.WriteJSON(w)
+		}
+		return report.WriteYAML(w)
+	}
+
+	if err := diff.Print(w, changes, opts); err != nil {
+		return err
+	}
+
+	return printSuppressed(w, suppressed)
+}
+
+func printSuppressed(w io.Writer, suppressed int) error {
+	if suppressed == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "%d change(s) suppressed by ignore rules\n", suppressed)
+	return err
+}
+
+// getLiveResources fetches the live objects for the resources from the cluster.
+//
+// The live objects are sanitized with `export`, and fields that are set by none of the corresponding resources are
+// pruned, so that fields defaulted by the API server or populated by controllers don't show up as changes.
+// Resources missing in the cluster are omitted from the result.
+func (r *Runner) getLiveResources(ns string, resourceSets ...[]*manifest.Resource) ([]*manifest.Resource, error) {
+	templates := map[string][]map[string]interface{}{}
+
+	var refs []ResourceRef
+
+	for _, resources := range resourceSets {
+		for _, res := range resources {
+			key := res.Key()
+			if _, ok := templates[key]; !ok {
+				refs = append(refs, ResourceRef{Kind: kubectlType(res), Namespace: res.Namespace, Name: res.Name})
+			}
+			templates[key] = append(templates[key], res.Object)
+		}
+	}
+
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	items, err := r.getResourcesByRefs(refs, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var live []*manifest.Resource
+
+	for _, item := range items {
+		res, err := manifest.FromObject(item, ns)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Object = diff.Prune(res.Object, templates[res.Key()]...)
+
+		live = append(live, res)
+	}
+
+	return live, nil
+}
+
+// kubectlType returns the fully-qualified type of the resource like `Deployment.v1.apps`, so that `kubectl get`
+// returns the object in the same API version as the resource
+func kubectlType(res *manifest.Resource) string {
+	items := strings.SplitN(res.APIVersion, "/", 2)
+	if len(items) != 2 {
+		return res.Kind
+	}
+	return fmt.Sprintf("%s.%s.%s", res.Kind, items[1], items[0])
+}
+
+// DeployedManifest returns the manifest of the currently deployed revision of the release.
+// The second return value is false when the release has not been deployed yet.
+func (r *Runner) DeployedManifest(release string, o *DiffOpts) (string, bool, error) {
+	if r.IsHelm3() {
+		return r.helm3Get("manifest", release, o)
+	}
+
+	rel, err := r.getDeployedRelease(release, o)
+	if rel == nil || err != nil {
+		return "", false, err
+	}
+
+	return rel.Manifest, true, nil
+}
+
+// DeployedHooks returns the manifests of the hooks of the currently deployed revision of the release, each with the
+// `# Source:` comment like `helm template` outputs.
+// The second return value is false when the release has not been deployed yet.
+func (r *Runner) DeployedHooks(release string, o *DiffOpts) (string, bool, error) {
+	if r.IsHelm3() {
+		return r.helm3Get("hooks", release, o)
+	}
+
+	rel, err := r.getDeployedRelease(release, o)
+	if rel == nil || err != nil {
+		return "", false, err
+	}
+
+	var manifests []string
+	for _, h := range rel.Hooks {
+		manifests = append(manifests, fmt.Sprintf("---\n# Source: %s\n%s", h.Path, h.Manifest))
+	}
+
+	return strings.Join(manifests, "\n"), true, nil
+}
+
+// helm3Get runs `helm get manifest|hooks` for the release
+func (r *Runner) helm3Get(what, release string, o *DiffOpts) (string, bool, error) {
+	// Helm 3 stores releases in its own format, which can't be read by releasetool
+	args := []string{"get", what, release}
+	if o.Namespace != "" {
+		args = append(args, "--namespace", o.Namespace)
+	}
+	if o.KubeContext != "" {
+		args = append(args, "--kube-context", o.KubeContext)
+	}
+
+	stdout, stderr, err := r.CaptureBytes(r.HelmBin(), args)
+	if err != nil {
+		if strings.Contains(string(stderr), "not found") {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("%v: %s", err, string(stderr))
+	}
+
+	return string(stdout), true, nil
+}
+
+// getDeployedRelease returns the currently deployed revision of the release stored by Tiller, or nil if not deployed yet
+func (r *Runner) getDeployedRelease(release string, o *DiffOpts) (*rspb.Release, error) {
+	storage, err := releasetool.New(o.TillerNamespace, releasetool.Opts{StorageBackend: o.TillerStorageBackend})
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := storage.GetDeployedRelease(release)
+	if releasetool.IsNotDeployed(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return rel, nil
+}
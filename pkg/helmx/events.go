@@ -0,0 +1,268 @@
+package helmx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+)
+
+// eventWatcher polls the events of the resources in a release with kubectl, and prints the new ones as they arrive.
+//
+// Besides the resources themselves, the events of the pods, the ReplicaSets and the Jobs named after the workloads are
+// watched, as most of the failures of rollouts like FailedScheduling and BackOff are reported on them.
+type eventWatcher struct {
+	r *Runner
+
+	// objects maps each namespace to the kind and the name of the resources in it
+	objects map[string]map[string]bool
+
+	// owners maps each namespace to the names of the workloads in it
+	owners map[string][]string
+
+	// seen maps the UID of each event to the count of the occurrences already observed
+	seen map[string]int64
+
+	// warnings maps the UID of each warning event to its last formatted line, in the order of the first occurrences
+	warnings     map[string]string
+	warningOrder []string
+
+	out     io.Writer
+	noColor bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// syncWriter serializes the writes from the event watcher and the upgrade running concurrently
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+func newEventWatcher(r *Runner, resources []*manifest.Resource, out io.Writer, noColor bool) *eventWatcher {
+	w := &eventWatcher{
+		r:        r,
+		objects:  map[string]map[string]bool{},
+		owners:   map[string][]string{},
+		seen:     map[string]int64{},
+		warnings: map[string]string{},
+		out:      out,
+		noColor:  noColor,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	for _, res := range resources {
+		if w.objects[res.Namespace] == nil {
+			w.objects[res.Namespace] = map[string]bool{}
+		}
+		w.objects[res.Namespace][res.Kind+"/"+res.Name] = true
+
+		switch res.Kind {
+		case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job", "CronJob":
+			w.owners[res.Namespace] = append(w.owners[res.Namespace], res.Name)
+		}
+	}
+
+	return w
+}
+
+// watchEvents starts printing the events of the resources in the manifest of the release to out until the returned
+// function is called. The function prints the summary of the warning events.
+// The events occurred before the call are ignored
+func (r *Runner) watchEvents(release, m string, o UpgradeOpts, out io.Writer) (func(), error) {
+	ns := o.Namespace
+	if ns == "" {
+		ns = "default"
+	}
+
+	// Only the cluster-scoped resources are left without namespaces
+	resources, err := manifest.Parse(m, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newEventWatcher(r, resources, out, o.NoColor)
+
+	// Take the snapshot of the existing events, so that only the new ones are printed
+	w.observe(w.poll(), false)
+
+	go func() {
+		defer close(w.done)
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-time.After(waitInterval):
+				w.observe(w.poll(), true)
+			}
+		}
+	}()
+
+	return func() {
+		close(w.stop)
+		<-w.done
+
+		w.observe(w.poll(), true)
+		w.printSummary(release)
+	}, nil
+}
+
+// WatchEvents starts printing the events of the resources in m, the manifest rendered for the release, to o.Out,
+// until the returned function is called to print the summary of the warning events.
+// It is started once per apply, so that the retries of the upgrade like the one done by AutoAdopt are covered by the
+// same watcher. The returned writer must be used for the rest of the output, as the events are written concurrently
+func (r *Runner) WatchEvents(release, m string, o UpgradeOpts) (io.Writer, func(), error) {
+	out := o.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	sw := &syncWriter{w: out}
+
+	stop, err := r.watchEvents(release, m, o, sw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sw, stop, nil
+}
+
+// poll returns the events in all the namespaces of the watched resources. Failures are logged and ignored, so that
+// they don't fail the upgrade
+func (w *eventWatcher) poll() []map[string]interface{} {
+	var namespaces []string
+	for ns := range w.objects {
+		// Cluster-scoped resources have no namespace to get the events from, and getting them without the namespace
+		// would return the events in the namespace of the current context instead
+		if ns == "" {
+			continue
+		}
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	var events []map[string]interface{}
+
+	for _, ns := range namespaces {
+		items, err := w.r.getObjects(ns, []string{"events"}, false)
+		if err != nil {
+			klog.V(1).Infof("unable to get events in namespace %q: %v", ns, err)
+			continue
+		}
+		events = append(events, items...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTimestamp(events[i]) < eventTimestamp(events[j])
+	})
+
+	return events
+}
+
+// observe prints the events of the watched resources that are new or occurred again since the last observation,
+// and records the warnings for the summary. Nothing is printed when print is false
+func (w *eventWatcher) observe(events []map[string]interface{}, print bool) {
+	for _, e := range events {
+		involved, _ := e["involvedObject"].(map[string]interface{})
+		kind, _ := involved["kind"].(string)
+		name, _ := involved["name"].(string)
+		ns, _ := involved["namespace"].(string)
+
+		if !w.watches(ns, kind, name) {
+			continue
+		}
+
+		metadata, _ := e["metadata"].(map[string]interface{})
+		uid := fmt.Sprint(metadata["uid"])
+		count := intFieldOr(e, 1, "count")
+
+		if prev, ok := w.seen[uid]; ok && prev >= count {
+			continue
+		}
+		w.seen[uid] = count
+
+		if !print {
+			continue
+		}
+
+		line := formatEvent(e, kind, name, count)
+
+		color := colorGreen
+		if e["type"] == "Warning" {
+			color = colorYellow
+
+			if _, ok := w.warnings[uid]; !ok {
+				w.warningOrder = append(w.warningOrder, uid)
+			}
+			w.warnings[uid] = line
+		}
+
+		if !w.noColor {
+			line = color + line + colorReset
+		}
+
+		fmt.Fprintln(w.out, line)
+	}
+}
+
+// watches returns true when the event of the object is of a resource in the release, or a pod, a ReplicaSet or a Job
+// named after one of the workloads
+func (w *eventWatcher) watches(ns, kind, name string) bool {
+	for _, n := range []string{ns, ""} {
+		if w.objects[n][kind+"/"+name] {
+			return true
+		}
+
+		switch kind {
+		case "Pod", "ReplicaSet", "Job":
+			for _, owner := range w.owners[n] {
+				if strings.HasPrefix(name, owner+"-") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func formatEvent(e map[string]interface{}, kind, name string, count int64) string {
+	line := fmt.Sprintf("%v %s/%s %v: %v", e["type"], kind, name, e["reason"], strings.TrimSpace(fmt.Sprint(e["message"])))
+	if count > 1 {
+		line += fmt.Sprintf(" (x%d)", count)
+	}
+	return line
+}
+
+func (w *eventWatcher) printSummary(release string) {
+	if len(w.warningOrder) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w.out, "%d warning event(s) occurred during the upgrade of release %s:\n", len(w.warningOrder), release)
+
+	for _, uid := range w.warningOrder {
+		fmt.Fprintf(w.out, "  %s\n", w.warnings[uid])
+	}
+}
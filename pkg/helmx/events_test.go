@@ -0,0 +1,107 @@
+package helmx
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+func testEvent(uid, typ, kind, name, reason, message string, count int) map[string]interface{} {
+	return map[string]interface{}{
+		"metadata":       map[string]interface{}{"uid": uid},
+		"involvedObject": map[string]interface{}{"kind": kind, "name": name, "namespace": "default"},
+		"type":           typ,
+		"reason":         reason,
+		"message":        message,
+		"count":          count,
+	}
+}
+
+func TestEventWatcher(t *testing.T) {
+	resources, err := manifest.Parse(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+`, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+
+	w := newEventWatcher(nil, resources, out, true)
+
+	w.observe([]map[string]interface{}{
+		testEvent("1", "Normal", "Deployment", "app", "ScalingReplicaSet", "Scaled up replica set app-5d9c to 1", 1),
+	}, false)
+
+	w.observe([]map[string]interface{}{
+		testEvent("1", "Normal", "Deployment", "app", "ScalingReplicaSet", "Scaled up replica set app-5d9c to 1", 1),
+		testEvent("2", "Normal", "Deployment", "app", "ScalingReplicaSet", "Scaled up replica set app-7f8b to 1", 1),
+		testEvent("3", "Warning", "Pod", "app-7f8b-x2x9z", "FailedScheduling", "0/3 nodes are available: 3 Insufficient cpu.", 1),
+		testEvent("4", "Warning", "Pod", "other-7f8b-abcde", "BackOff", "Back-off restarting failed container", 1),
+	}, true)
+
+	w.observe([]map[string]interface{}{
+		testEvent("3", "Warning", "Pod", "app-7f8b-x2x9z", "FailedScheduling", "0/3 nodes are available: 3 Insufficient cpu.", 3),
+		testEvent("5", "Normal", "Service", "app", "EnsuringLoadBalancer", "Ensuring load balancer", 1),
+	}, true)
+
+	w.printSummary("myapp")
+
+	expected := `Normal Deployment/app ScalingReplicaSet: Scaled up replica set app-7f8b to 1
+Warning Pod/app-7f8b-x2x9z FailedScheduling: 0/3 nodes are available: 3 Insufficient cpu.
+Warning Pod/app-7f8b-x2x9z FailedScheduling: 0/3 nodes are available: 3 Insufficient cpu. (x3)
+Normal Service/app EnsuringLoadBalancer: Ensuring load balancer
+1 warning event(s) occurred during the upgrade of release myapp:
+  Warning Pod/app-7f8b-x2x9z FailedScheduling: 0/3 nodes are available: 3 Insufficient cpu. (x3)
+`
+
+	if actual := out.String(); actual != expected {
+		t.Errorf("unexpected output:\nexpected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestEventWatcherPollSkipsClusterScopedResources(t *testing.T) {
+	defer stubKubectl(t)()
+
+	resources, err := manifest.Parse(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: app
+`, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+
+	r := New(Commander(func(cmd string, args []string, stdout, stderr io.Writer, env map[string]string) error {
+		calls = append(calls, cmd+" "+strings.Join(args, " "))
+		return nil
+	}))
+
+	w := newEventWatcher(r, resources, &bytes.Buffer{}, true)
+
+	w.poll()
+
+	// The events of the ClusterRole aren't fetched from the namespace of the current context
+	expected := []string{"kubectl get -o=json -n=default events"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("unexpected commands:\nexpected=%q\ngot=%q", expected, calls)
+	}
+}
@@ -0,0 +1,206 @@
+package helmx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ExportChart fetches the live resources and writes them as an editable helm chart into the directory.
+//
+// Each resource is written to its own template file named like `<name>.<kind>.yaml`, the same as the Source paths
+// recorded by `Adopt`. Container images and replica counts are extracted into values.yaml, so that they can be
+// overridden like `--set deployment.default.myapp.replicas=3`.
+//
+// It returns the number of the resources written into the chart.
+func (r *Runner) ExportChart(chartName string, resources []string, dir string, pathOptions *clientcmd.PathOptions, opts ...AdoptOption) (int, error) {
+	o := &AdoptOpts{}
+	for i := range opts {
+		if err := opts[i].SetAdoptOption(o); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "Chart.yaml")); err == nil {
+		return 0, fmt.Errorf("unable to export chart: %s already contains Chart.yaml", dir)
+	}
+
+	ns := namespaceOrDefault(o.Namespace, pathOptions)
+
+	refs, err := parseResourceRefs(resources, ns)
+	if err != nil {
+		return 0, err
+	}
+
+	items, err := r.getResourcesByRefs(refs, false)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(items) == 0 {
+		return 0, fmt.Errorf("no resources to be exported")
+	}
+
+	templatesDir := filepath.Join(dir, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		return 0, err
+	}
+
+	values := map[string]interface{}{}
+
+	for _, item := range items {
+		placeholders := parameterize(item, values)
+
+		yamlData, err := YamlMarshal(item)
+		if err != nil {
+			return 0, err
+		}
+
+		// Anything that looks like a go template in the live object must be rendered verbatim
+		template := strings.Replace(string(yamlData), "{{", `{{ "{{" }}`, -1)
+
+		for placeholder, expr := range placeholders {
+			template = strings.Replace(template, placeholder, expr, -1)
+		}
+
+		file := filepath.Join(templatesDir, filepath.FromSlash(templatePath(item, ns)))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return 0, err
+		}
+
+		if err := ioutil.WriteFile(file, []byte(template), 0644); err != nil {
+			return 0, err
+		}
+	}
+
+	valuesYaml, err := YamlMarshal(values)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "values.yaml"), valuesYaml, 0644); err != nil {
+		return 0, err
+	}
+
+	chartYaml := fmt.Sprintf("apiVersion: v1\nname: %s\nversion: 0.1.0\nappVersion: 0.1.0\ndescription: Exported from the namespace %s by helm-x\n", chartName, ns)
+	if err := ioutil.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte(chartYaml), 0644); err != nil {
+		return 0, err
+	}
+
+	return len(items), nil
+}
+
+// podSpecPath returns the path to the pod spec within the workload of the kind, or nil if the kind has no pod spec
+func podSpecPath(kind string) []string {
+	switch kind {
+	case "Pod":
+		return []string{"spec"}
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job":
+		return []string{"spec", "template", "spec"}
+	case "CronJob":
+		return []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	}
+	return nil
+}
+
+func nestedMap(obj map[string]interface{}, path ...string) (map[string]interface{}, bool) {
+	cur := obj
+	for _, p := range path {
+		next, ok := cur[p].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		cur = next
+	}
+	return cur, true
+}
+
+// parameterize replaces replica counts and container images in the item with placeholders and records the original
+// values into values, keyed by the lower-cased kind, the namespace and the name of the item, so that the resources of
+// the same kind and name in different namespaces don't overwrite each other.
+//
+// It returns the map from each placeholder to the template expression that should replace it.
+func parameterize(item map[string]interface{}, values map[string]interface{}) map[string]string {
+	placeholders := map[string]string{}
+
+	kind, _ := item["kind"].(string)
+	metadata, _ := item["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	ns, _ := metadata["namespace"].(string)
+
+	kindKey := strings.ToLower(kind)
+
+	resourceValues := map[string]interface{}{}
+
+	ref := func(keys ...string) string {
+		quoted := []string{fmt.Sprintf("%q", kindKey), fmt.Sprintf("%q", ns), fmt.Sprintf("%q", name)}
+		for _, k := range keys {
+			quoted = append(quoted, fmt.Sprintf("%q", k))
+		}
+		return fmt.Sprintf("{{ index .Values %s }}", strings.Join(quoted, " "))
+	}
+
+	newPlaceholder := func() string {
+		return fmt.Sprintf("__helmx_export_%s_%s_%s_%d__", kindKey, ns, name, len(placeholders))
+	}
+
+	if spec, ok := item["spec"].(map[string]interface{}); ok && kind != "Pod" {
+		if replicas, ok := spec["replicas"]; ok {
+			resourceValues["replicas"] = replicas
+
+			p := newPlaceholder()
+			spec["replicas"] = p
+			placeholders[p] = ref("replicas")
+		}
+	}
+
+	if path := podSpecPath(kind); path != nil {
+		if podSpec, ok := nestedMap(item, path...); ok {
+			images := map[string]interface{}{}
+
+			for _, field := range []string{"initContainers", "containers"} {
+				containers, _ := podSpec[field].([]interface{})
+				for _, c := range containers {
+					container, ok := c.(map[string]interface{})
+					if !ok {
+						continue
+					}
+					cname, _ := container["name"].(string)
+					image, ok := container["image"].(string)
+					if !ok || cname == "" {
+						continue
+					}
+					images[cname] = image
+
+					p := newPlaceholder()
+					container["image"] = p
+					placeholders[p] = fmt.Sprintf(`"%s"`, ref("images", cname))
+				}
+			}
+
+			if len(images) > 0 {
+				resourceValues["images"] = images
+			}
+		}
+	}
+
+	if len(resourceValues) > 0 {
+		kindValues, ok := values[kindKey].(map[string]interface{})
+		if !ok {
+			kindValues = map[string]interface{}{}
+			values[kindKey] = kindValues
+		}
+		nsValues, ok := kindValues[ns].(map[string]interface{})
+		if !ok {
+			nsValues = map[string]interface{}{}
+			kindValues[ns] = nsValues
+		}
+		nsValues[name] = resourceValues
+	}
+
+	return placeholders
+}
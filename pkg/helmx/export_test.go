@@ -0,0 +1,70 @@
+package helmx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testDeployment(ns, image string) map[string]interface{} {
+	return map[string]interface{}{
+		"kind": "Deployment",
+		"metadata": map[string]interface{}{
+			"name":              "myapp",
+			"namespace":         ns,
+			"creationTimestamp": "2020-01-01T00:00:00Z",
+			"managedFields":     []interface{}{map[string]interface{}{"manager": "kubectl"}},
+			"annotations": map[string]interface{}{
+				lastAppliedAnnotation: `{"kind":"Deployment"}`,
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas": 2,
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "app", "image": image},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestExportParameterize(t *testing.T) {
+	values := map[string]interface{}{}
+
+	var placeholders []map[string]string
+
+	for _, item := range []map[string]interface{}{
+		export(testDeployment("a", "myapp:1")),
+		export(testDeployment("b", "myapp:2")),
+	} {
+		metadata := item["metadata"].(map[string]interface{})
+		for _, f := range []string{"creationTimestamp", "managedFields", "annotations"} {
+			if _, ok := metadata[f]; ok {
+				t.Errorf("unexpected metadata.%s in the exported object", f)
+			}
+		}
+
+		placeholders = append(placeholders, parameterize(item, values))
+	}
+
+	expected := map[string]interface{}{
+		"deployment": map[string]interface{}{
+			"a": map[string]interface{}{
+				"myapp": map[string]interface{}{"replicas": 2, "images": map[string]interface{}{"app": "myapp:1"}},
+			},
+			"b": map[string]interface{}{
+				"myapp": map[string]interface{}{"replicas": 2, "images": map[string]interface{}{"app": "myapp:2"}},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("unexpected values:\nexpected=%v\ngot=%v", expected, values)
+	}
+
+	if expr := placeholders[1]["__helmx_export_deployment_b_myapp_1__"]; expr != `"{{ index .Values "deployment" "b" "myapp" "images" "app" }}"` {
+		t.Errorf("unexpected template expression for the image: %s", expr)
+	}
+}
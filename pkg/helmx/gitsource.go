@@ -0,0 +1,115 @@
+package helmx
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gitSourcePrefix is the prefix of the source that refers to the directory or chart at the git ref, in the format of
+// `git:REF:PATH` like `git:origin/master:overlays/production`
+const gitSourcePrefix = "git:"
+
+// IsGitSource returns true when the source is in the format of `git:REF:PATH`
+func IsGitSource(src string) bool {
+	return strings.HasPrefix(src, gitSourcePrefix)
+}
+
+// CheckoutGitSource extracts the whole tree at the ref of the source in the `git:REF:PATH` format into a temporary
+// directory with `git archive`, without touching the working tree.
+//
+// The whole tree is extracted so that kustomizations can refer to bases in parent directories.
+// PATH is relative to the current directory, and defaults to it. It returns the path to PATH within the extracted
+// tree, and the temporary directory that should be removed by the caller afterwards.
+func (r *Runner) CheckoutGitSource(src string) (string, string, error) {
+	items := strings.SplitN(strings.TrimPrefix(src, gitSourcePrefix), ":", 2)
+
+	ref := items[0]
+	if ref == "" {
+		return "", "", fmt.Errorf("invalid source \"%s\": must be in the format of git:REF:PATH", src)
+	}
+
+	path := "."
+	if len(items) == 2 && items[1] != "" {
+		path = items[1]
+	}
+
+	toplevel, _, err := r.CaptureBytes("git", []string{"rev-parse", "--show-toplevel"})
+	if err != nil {
+		return "", "", fmt.Errorf("unable to checkout %s: %v", src, err)
+	}
+
+	prefix, _, err := r.CaptureBytes("git", []string{"rev-parse", "--show-prefix"})
+	if err != nil {
+		return "", "", fmt.Errorf("unable to checkout %s: %v", src, err)
+	}
+
+	archive, stderr, err := r.CaptureBytes("git", []string{"-C", strings.TrimSpace(string(toplevel)), "archive", "--format=tar", ref})
+	if err != nil {
+		return "", "", fmt.Errorf("unable to checkout %s: %v: %s", src, err, string(stderr))
+	}
+
+	tempDir, err := ioutil.TempDir("", "helm-x-git")
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := untar(bytes.NewReader(archive), tempDir); err != nil {
+		os.RemoveAll(tempDir)
+		return "", "", fmt.Errorf("unable to checkout %s: %v", src, err)
+	}
+
+	return filepath.Join(tempDir, strings.TrimSpace(string(prefix)), path), tempDir, nil
+}
+
+func untar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, h.Name)
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("illegal path in archive: %s", h.Name)
+		}
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(h.Mode))
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(h.Linkname, path); err != nil {
+				return err
+			}
+		}
+	}
+}
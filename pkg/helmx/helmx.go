@@ -44,6 +44,10 @@ type ClientOpts struct {
 	TillerStorageBackend string
 }
 
+// lastAppliedAnnotation is the annotation `kubectl apply` records the applied object into
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// export removes the fields managed by the cluster from the live object, so that it can be stored and applied as-is
 func export(item map[string]interface{}) map[string]interface{} {
 	metadata := item["metadata"].(map[string]interface{})
 	if generateName, ok := metadata["generateName"]; ok {
@@ -55,6 +59,15 @@ func export(item map[string]interface{}) map[string]interface{} {
 	delete(metadata, "resourceVersion")
 	delete(metadata, "selfLink")
 	delete(metadata, "uid")
+	delete(metadata, "creationTimestamp")
+	delete(metadata, "managedFields")
+
+	if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+		delete(annotations, lastAppliedAnnotation)
+		if len(annotations) == 0 {
+			delete(metadata, "annotations")
+		}
+	}
 
 	item["metadata"] = metadata
 
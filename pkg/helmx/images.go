@@ -0,0 +1,61 @@
+package helmx
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/variantdev/chartify"
+
+	"github.com/mumoshu/helm-x/pkg/images"
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+// Images renders the chart and returns the images of all the containers and init containers, including hooks and the
+// sidecars added by injectors
+func (r *Runner) Images(release, chart string, o *chartify.ChartifyOpts) ([]images.Image, error) {
+	m, err := r.Template(release, chart, o)
+	if err != nil {
+		return nil, err
+	}
+
+	ns := o.Namespace
+	if ns == "" {
+		ns = "default"
+	}
+
+	resources, err := manifest.Parse(m, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	return images.List(resources), nil
+}
+
+// PinDigests rewrites the image tags in the temporary chart generated by Chartify to the digests found in the mapping
+// file, so that the release deploys exactly the images that were scanned and signed off.
+//
+// Every rewritten image is printed to out. The images missing in the mapping are left as-is.
+func (r *Runner) PinDigests(chart, digestsFile string, out io.Writer) error {
+	digests, err := images.LoadDigests(digestsFile)
+	if err != nil {
+		return err
+	}
+
+	if out == nil {
+		out = os.Stdout
+	}
+
+	return rewriteTemplates(chart, func(_, content string) (string, error) {
+		pinned, pinnings, err := images.PinManifest(content, digests)
+		if err != nil {
+			return "", err
+		}
+
+		for _, p := range pinnings {
+			fmt.Fprintln(out, p)
+		}
+
+		return pinned, nil
+	})
+}
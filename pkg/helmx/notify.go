@@ -0,0 +1,166 @@
+package helmx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/variantdev/chartify"
+
+	"github.com/mumoshu/helm-x/pkg/diff"
+	"github.com/mumoshu/helm-x/pkg/manifest"
+	"github.com/mumoshu/helm-x/pkg/notify"
+)
+
+// NotifyOpts is the options for sending the outcomes of apply, diff and rollback to webhooks
+type NotifyOpts struct {
+	// Webhooks is the list of the URLs the notifications are posted to in JSON
+	Webhooks []string
+
+	// SlackWebhooks is the list of the URLs of Slack incoming webhooks
+	SlackWebhooks []string
+
+	// ConfigFile is the path to the YAML file containing the sinks, loaded in addition to the above
+	ConfigFile string
+
+	// Timeout is the timeout of each request to the sinks
+	Timeout time.Duration
+
+	// Retries is the number of times to retry the requests failed with network errors, 429 or 5xx responses
+	Retries int
+}
+
+// Notifier returns the notifier for the sinks, or nil when none is configured
+func (o *NotifyOpts) Notifier() (*notify.Notifier, error) {
+	if o == nil {
+		return nil, nil
+	}
+
+	var c notify.Config
+
+	if o.ConfigFile != "" {
+		loaded, err := notify.LoadConfig(o.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		c = *loaded
+	}
+
+	for _, u := range o.Webhooks {
+		c.Sinks = append(c.Sinks, notify.Sink{Type: notify.SinkWebhook, URL: u})
+	}
+
+	for _, u := range o.SlackWebhooks {
+		c.Sinks = append(c.Sinks, notify.Sink{Type: notify.SinkSlack, URL: u})
+	}
+
+	if len(c.Sinks) == 0 {
+		return nil, nil
+	}
+
+	// The flags override the config file only when explicitly set, as the defaults are zero
+	if o.Timeout != 0 {
+		c.Timeout = o.Timeout
+	}
+
+	if o.Retries != 0 {
+		c.Retries = o.Retries
+	}
+
+	return notify.NewNotifier(c)
+}
+
+// NewNotification returns the notification of the command on the release rendered from source into the temporary
+// chart, started now
+func (r *Runner) NewNotification(command, release, source, chart string, o *chartify.ChartifyOpts, c *ClientOpts) *notify.Notification {
+	n := notify.New(command, release)
+
+	n.Source = source
+
+	if o != nil {
+		n.Namespace = o.Namespace
+		n.ChartVersion = o.ChartVersion
+	}
+
+	if c != nil {
+		n.KubeContext = c.KubeContext
+	}
+
+	// The version in the temporary chart is the one actually deployed, even when --version is omitted
+	if _, version, err := chartMetadata(chart); err == nil && version != "" {
+		n.ChartVersion = version
+	}
+
+	return n
+}
+
+// Notify completes the notification with err, which is the outcome of the command, and sends it to the sinks.
+// Failures to notify are printed to out as warnings, so that they never fail the command itself.
+func (r *Runner) Notify(notifier *notify.Notifier, n *notify.Notification, err error, out io.Writer) {
+	if notifier == nil {
+		return
+	}
+
+	if out == nil {
+		out = os.Stderr
+	}
+
+	n.Complete(err)
+
+	if err := notifier.Notify(n); err != nil {
+		fmt.Fprintf(out, "warning: %v\n", err)
+	}
+}
+
+// DiffSummary returns the number of the resources the temporary chart adds, changes and removes from the deployed
+// release. Hooks are not taken into account, as the summary is for notifications. The ignore rules of the diff are
+// applied before counting, so that the summary agrees with the printed diff and the exit code
+func (r *Runner) DiffSummary(release, chart string, o *DiffOpts) (*diff.Summary, error) {
+	desiredManifest, err := r.Template(release, chart, o.ChartifyOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ManifestDiffSummary(release, desiredManifest, o)
+}
+
+// ManifestDiffSummary is DiffSummary for the manifest already rendered from the temporary chart
+func (r *Runner) ManifestDiffSummary(release, desiredManifest string, o *DiffOpts) (*diff.Summary, error) {
+	ns := o.Namespace
+	if ns == "" {
+		ns = "default"
+	}
+
+	desired, err := manifest.Parse(desiredManifest, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	desired, _ = manifest.SplitHooks(desired)
+
+	deployedManifest, _, err := r.DeployedManifest(release, o)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := manifest.Parse(deployedManifest, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	ignorer, err := newIgnorer(o.Ignore, o.IgnoreFile)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := diff.Resources(current, desired, diff.Opts{SuppressSecrets: true, Ignore: ignorer})
+	if err != nil {
+		return nil, err
+	}
+
+	report := diff.NewReport(changes)
+	report.Summary.Suppressed = ignorer.Suppressed
+
+	return &report.Summary, nil
+}
@@ -0,0 +1,514 @@
+package helmx
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/variantdev/chartify"
+	"gopkg.in/yaml.v3"
+	"k8s.io/helm/pkg/strvals"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	planMetadataFile = "plan.yaml"
+	planValuesFile   = "values.yaml"
+	planManifestFile = "manifest.yaml"
+	planDiffFile     = "diff.txt"
+	planChartDir     = "chart"
+)
+
+type PlanOpts struct {
+	*chartify.ChartifyOpts
+	*ClientOpts
+
+	// File is the path to the plan archive to be written
+	File string
+
+	Out io.Writer
+}
+
+// Plan is the metadata of the plan archive, that is used to verify the plan before applying it
+type Plan struct {
+	Release   string `yaml:"release"`
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// Revision is the deployed revision of the release when the plan was made, or 0 if the release wasn't installed
+	Revision int `yaml:"revision"`
+
+	// Checksum is the SHA256 checksum of the release, the namespace, the revision and all the files in the plan archive
+	// other than plan.yaml.
+	// It only detects accidental corruption and partial edits, as whoever can modify the archive can update it, too
+	Checksum string `yaml:"checksum"`
+
+	CreatedAt string `yaml:"createdAt"`
+
+	dir string
+}
+
+// ChartDir returns the path to the chart extracted from the plan
+func (p *Plan) ChartDir() string {
+	return filepath.Join(p.dir, planChartDir)
+}
+
+// ValuesFile returns the path to the merged values extracted from the plan
+func (p *Plan) ValuesFile() string {
+	return filepath.Join(p.dir, planValuesFile)
+}
+
+// Dir returns the temporary directory the plan has been extracted into, that should be removed by the caller afterwards
+func (p *Plan) Dir() string {
+	return p.dir
+}
+
+type planEntry struct {
+	name string
+	data []byte
+	mode os.FileMode
+}
+
+// Plan saves the chart produced by Chartify, the merged values, the rendered manifest and the diff against the
+// deployed release into the plan archive, along with the checksum of them and the deployed revision of the release.
+//
+// The plan can be applied later with `helm x apply --plan`, which refuses to apply it once the release has changed.
+// The SHA256 checksum of the whole archive is printed, so that the approver can record it out of the archive and
+// verify it like `sha256sum plan.tgz` before applying, as the checksum in the archive can't detect tampering.
+//
+// The archive is readable only by the owner, as the values and the manifest contain secrets.
+func (r *Runner) Plan(release, chart string, o PlanOpts) error {
+	out := o.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	values, err := MergeValues(o.ValuesFiles, o.SetValues)
+	if err != nil {
+		return err
+	}
+
+	valuesFile, err := ioutil.TempFile("", "helm-x-plan-values")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(valuesFile.Name())
+
+	if _, err := valuesFile.Write(values); err != nil {
+		valuesFile.Close()
+		return err
+	}
+
+	if err := valuesFile.Close(); err != nil {
+		return err
+	}
+
+	chartifyOpts := &chartify.ChartifyOpts{
+		Namespace:       o.Namespace,
+		TillerNamespace: o.TillerNamespace,
+		ValuesFiles:     []string{valuesFile.Name()},
+		Debug:           o.Debug,
+	}
+
+	m, err := r.Template(release, chart, chartifyOpts)
+	if err != nil {
+		return err
+	}
+
+	var diff bytes.Buffer
+
+	if _, err := r.Diff(release, chart, &DiffOpts{
+		ChartifyOpts:    chartifyOpts,
+		ClientOpts:      o.ClientOpts,
+		Engine:          DiffEngineNative,
+		AllowUnreleased: true,
+		NoColor:         true,
+		Out:             &diff,
+	}); err != nil {
+		return err
+	}
+
+	revision, err := r.DeployedRevision(release, UpgradeOpts{ChartifyOpts: o.ChartifyOpts, ClientOpts: o.ClientOpts})
+	if err != nil {
+		return err
+	}
+
+	entries, err := readPlanEntries(chart, planChartDir)
+	if err != nil {
+		return err
+	}
+
+	entries = append(entries,
+		planEntry{name: planValuesFile, data: values, mode: 0600},
+		planEntry{name: planManifestFile, data: []byte(m), mode: 0600},
+		planEntry{name: planDiffFile, data: diff.Bytes(), mode: 0600},
+	)
+
+	plan := Plan{
+		Release:   release,
+		Namespace: o.Namespace,
+		Revision:  revision,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	plan.Checksum = planChecksum(plan, entries)
+
+	metadata, err := YamlMarshal(plan)
+	if err != nil {
+		return err
+	}
+
+	entries = append([]planEntry{{name: planMetadataFile, data: metadata, mode: 0644}}, entries...)
+
+	archiveChecksum, err := writePlanArchive(o.File, entries)
+	if err != nil {
+		return err
+	}
+
+	if diff.Len() == 0 {
+		fmt.Fprintf(out, "no changes to release %s\n", release)
+	} else {
+		fmt.Fprint(out, diff.String())
+	}
+
+	fmt.Fprintf(out, "plan for release %s has been saved to %s\n", release, o.File)
+	fmt.Fprintf(out, "the SHA256 checksum of the plan is %s\n", archiveChecksum)
+
+	return nil
+}
+
+// OpenPlan verifies that neither the plan nor the release has changed since the plan was made, and extracts the plan
+// archive into a temporary directory.
+// Nothing is written to the disk until the checksum is verified
+func (r *Runner) OpenPlan(file string, o UpgradeOpts) (*Plan, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read plan %s: %v", file, err)
+	}
+
+	entries, err := readPlanArchive(gz)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read plan %s: %v", file, err)
+	}
+
+	plan, err := r.verifyPlan(file, entries, o)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "helm-x-plan")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writePlanEntries(dir, entries); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	plan.dir = dir
+
+	return plan, nil
+}
+
+func (r *Runner) verifyPlan(file string, entries []planEntry, o UpgradeOpts) (*Plan, error) {
+	var metadata []byte
+	var contents []planEntry
+	for _, e := range entries {
+		if e.name == planMetadataFile {
+			metadata = e.data
+		} else {
+			contents = append(contents, e)
+		}
+	}
+
+	if metadata == nil {
+		return nil, fmt.Errorf("unable to read plan %s: missing %s", file, planMetadataFile)
+	}
+
+	plan := &Plan{}
+	if err := yaml.Unmarshal(metadata, plan); err != nil {
+		return nil, fmt.Errorf("unable to read plan %s: %v", file, err)
+	}
+
+	if sum := planChecksum(*plan, contents); sum != plan.Checksum {
+		return nil, fmt.Errorf("plan %s has been modified since it was made: checksum %s doesn't match %s", file, sum, plan.Checksum)
+	}
+
+	o.ChartifyOpts = &chartify.ChartifyOpts{Namespace: plan.Namespace, TillerNamespace: o.TillerNamespace}
+
+	revision, err := r.DeployedRevision(plan.Release, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if revision != plan.Revision {
+		return nil, fmt.Errorf("release %s has changed since the plan was made: revision %d is deployed while the plan was made against revision %d. please make a new plan", plan.Release, revision, plan.Revision)
+	}
+
+	return plan, nil
+}
+
+// MergeValues merges the values files and the values set on the command line into a single YAML document, in the same
+// way as helm does.
+// The values files can be local files or http(s) URLs like helm accepts. Reading from stdin with `-f -` isn't supported,
+// as the values would have been consumed by the chart generation before being merged
+func MergeValues(valuesFiles, setValues []string) ([]byte, error) {
+	base := map[string]interface{}{}
+
+	for _, f := range valuesFiles {
+		bs, err := readValuesFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		current := map[string]interface{}{}
+		if err := sigsyaml.Unmarshal(bs, &current); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", f, err)
+		}
+
+		base = mergeValues(base, current)
+	}
+
+	for _, v := range setValues {
+		if err := strvals.ParseInto(v, base); err != nil {
+			return nil, fmt.Errorf("failed parsing --set data: %v", err)
+		}
+	}
+
+	return sigsyaml.Marshal(base)
+}
+
+// readValuesFile reads the values file from the local path or the http(s) URL
+func readValuesFile(f string) ([]byte, error) {
+	if f == "-" {
+		return nil, errors.New("reading values from stdin with `-f -` is not supported by plans. please save the values into a file and pass it with -f instead")
+	}
+
+	if u, err := url.ParseRequestURI(f); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		res, err := http.Get(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch values from %s: %v", f, err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			return nil, fmt.Errorf("unable to fetch values from %s: unexpected response %s", f, res.Status)
+		}
+
+		return ioutil.ReadAll(res.Body)
+	}
+
+	return ioutil.ReadFile(f)
+}
+
+// Copied from https://github.com/helm/helm/blob/v2.13.1/cmd/helm/install.go with love
+//
+// Merges source and destination map, preferring values from the source map
+func mergeValues(dest map[string]interface{}, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		// If the key doesn't exist already, then just set the key to that value
+		if _, exists := dest[k]; !exists {
+			dest[k] = v
+			continue
+		}
+		nextMap, ok := v.(map[string]interface{})
+		// If it isn't another map, overwrite the value
+		if !ok {
+			dest[k] = v
+			continue
+		}
+		// Edge case: If the key exists in the destination, but isn't a map
+		destMap, isMap := dest[k].(map[string]interface{})
+		// If the source map has a map for this key, prefer it
+		if !isMap {
+			dest[k] = v
+			continue
+		}
+		// If we got to this point, it is a map in both, so merge them
+		dest[k] = mergeValues(destMap, nextMap)
+	}
+	return dest
+}
+
+// readPlanEntries reads all the regular files in the directory, naming them with the prefix
+func readPlanEntries(dir, prefix string) ([]planEntry, error) {
+	var entries []planEntry
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+		if prefix != "" {
+			name = prefix + "/" + name
+		}
+
+		entries = append(entries, planEntry{name: name, data: data, mode: info.Mode().Perm()})
+
+		return nil
+	})
+
+	return entries, err
+}
+
+// readPlanArchive reads the entries of the plan archive into memory.
+// Only regular files are accepted, and their names must be relative paths within the archive, so that a crafted plan
+// can't write outside of the directory it's extracted into, like through a symlink
+func readPlanArchive(r io.Reader) ([]planEntry, error) {
+	tr := tar.NewReader(r)
+
+	var entries []planEntry
+
+	seen := map[string]bool{}
+
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg, tar.TypeRegA:
+		default:
+			return nil, fmt.Errorf("unexpected entry %s in the archive: only regular files are allowed", h.Name)
+		}
+
+		name := path.Clean(h.Name)
+		if h.Name == "" || path.IsAbs(h.Name) || name == ".." || strings.HasPrefix(name, "../") || strings.Contains(h.Name, "\\") {
+			return nil, fmt.Errorf("illegal path in archive: %s", h.Name)
+		}
+
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate entry %s in the archive", h.Name)
+		}
+		seen[name] = true
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, planEntry{name: name, data: data, mode: os.FileMode(h.Mode).Perm()})
+	}
+}
+
+// writePlanEntries writes the entries read by readPlanArchive into the directory
+func writePlanEntries(dir string, entries []planEntry) error {
+	for _, e := range entries {
+		file := filepath.Join(dir, filepath.FromSlash(e.name))
+
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(file, e.data, e.mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// planChecksum returns the SHA256 checksum of the release, the namespace and the revision the plan is made against, and
+// the names and the contents of the entries regardless of their order.
+// The checksum itself and the creation time are excluded, as they don't change what gets applied
+func planChecksum(plan Plan, entries []planEntry) string {
+	sorted := append([]planEntry{}, entries...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].name < sorted[j].name
+	})
+
+	h := sha256.New()
+
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00", plan.Release, plan.Namespace, plan.Revision)
+
+	for _, e := range sorted {
+		fmt.Fprintf(h, "%s\x00%d\x00", e.name, len(e.data))
+		h.Write(e.data)
+	}
+
+	return fmt.Sprintf("sha256:%x", h.Sum(nil))
+}
+
+// writePlanArchive writes the entries into the archive readable only by the owner, and returns the SHA256 checksum of
+// the archive
+func writePlanArchive(file string, entries []planEntry) (string, error) {
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for _, e := range entries {
+		h := &tar.Header{
+			Name:     e.name,
+			Mode:     int64(e.mode),
+			Size:     int64(len(e.data)),
+			Typeflag: tar.TypeReg,
+		}
+
+		if err := tw.WriteHeader(h); err != nil {
+			return "", err
+		}
+
+		if _, err := tw.Write(e.data); err != nil {
+			return "", err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0600); err != nil {
+		return "", err
+	}
+
+	// WriteFile keeps the mode of the existing file
+	if err := os.Chmod(file, 0600); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(buf.Bytes())), nil
+}
@@ -0,0 +1,212 @@
+package helmx
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestArchive(t *testing.T, file string, headers []*tar.Header) {
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for _, h := range headers {
+		data := []byte("data")
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(data))
+		}
+
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+
+		if h.Typeflag == tar.TypeReg {
+			if _, err := tw.Write(data); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenPlanRejectsIllegalEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helmx-plan-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outside := filepath.Join(dir, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		headers []*tar.Header
+		err     string
+	}{
+		{
+			headers: []*tar.Header{
+				{Name: "chart", Typeflag: tar.TypeSymlink, Linkname: outside, Mode: 0777},
+				{Name: "chart/evil.yaml", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+			err: "unexpected entry chart in the archive: only regular files are allowed",
+		},
+		{
+			headers: []*tar.Header{{Name: "../evil.yaml", Typeflag: tar.TypeReg, Mode: 0644}},
+			err:     "illegal path in archive: ../evil.yaml",
+		},
+		{
+			headers: []*tar.Header{{Name: filepath.Join(outside, "evil.yaml"), Typeflag: tar.TypeReg, Mode: 0644}},
+			err:     "illegal path in archive: " + filepath.Join(outside, "evil.yaml"),
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		file := filepath.Join(dir, "plan.tgz")
+
+		writeTestArchive(t, file, tc.headers)
+
+		_, err := New().OpenPlan(file, UpgradeOpts{})
+		if err == nil || !strings.HasSuffix(err.Error(), tc.err) {
+			t.Errorf("unexpected error for case %d: expected=%q, got=%v", i, tc.err, err)
+		}
+
+		if files, _ := ioutil.ReadDir(outside); len(files) > 0 {
+			t.Errorf("unexpected files written outside of the plan for case %d: %v", i, files)
+		}
+	}
+}
+
+func TestOpenPlanDetectsModifiedMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helmx-plan-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entries := []planEntry{
+		{name: planValuesFile, data: []byte("replicas: 1\n"), mode: 0600},
+		{name: planManifestFile, data: []byte("kind: ConfigMap\n"), mode: 0600},
+	}
+
+	plan := Plan{Release: "myapp", Namespace: "staging", Revision: 3, CreatedAt: "2020-01-01T00:00:00Z"}
+	plan.Checksum = planChecksum(plan, entries)
+
+	testcases := []struct {
+		modify func(p *Plan)
+		err    string
+	}{
+		{modify: func(p *Plan) { p.Release = "other" }, err: "has been modified since it was made"},
+		{modify: func(p *Plan) { p.Namespace = "prod" }, err: "has been modified since it was made"},
+		{modify: func(p *Plan) { p.Revision = 4 }, err: "has been modified since it was made"},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		modified := plan
+		tc.modify(&modified)
+
+		metadata, err := YamlMarshal(modified)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file := filepath.Join(dir, "plan.tgz")
+
+		if _, err := writePlanArchive(file, append([]planEntry{{name: planMetadataFile, data: metadata, mode: 0644}}, entries...)); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = New().OpenPlan(file, UpgradeOpts{})
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("unexpected error for case %d: expected=%q, got=%v", i, tc.err, err)
+		}
+	}
+}
+
+func TestMergeValues(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/values.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "image:\n  tag: v1\nreplicas: 2\n")
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "helmx-values-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "values.yaml")
+	if err := ioutil.WriteFile(local, []byte("image:\n  tag: v2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		files    []string
+		set      []string
+		expected string
+		err      string
+	}{
+		{
+			files:    []string{srv.URL + "/values.yaml", local},
+			set:      []string{"replicas=3"},
+			expected: "image:\n  tag: v2\nreplicas: 3\n",
+		},
+		{
+			files: []string{srv.URL + "/missing.yaml"},
+			err:   "unexpected response 404 Not Found",
+		},
+		{
+			files: []string{"-"},
+			err:   "reading values from stdin with `-f -` is not supported by plans",
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		values, err := MergeValues(tc.files, tc.set)
+
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+
+		if tc.err == "" && err != nil || !strings.Contains(errMsg, tc.err) {
+			t.Errorf("unexpected error for case %d: expected=%q, got=%q", i, tc.err, errMsg)
+		}
+
+		if string(values) != tc.expected {
+			t.Errorf("unexpected values for case %d:\nexpected=%q\ngot=%q", i, tc.expected, string(values))
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package helmx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/variantdev/chartify"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+	"github.com/mumoshu/helm-x/pkg/policy"
+)
+
+// CheckPolicy renders the chart and evaluates the policy in the file against every rendered resource, including hooks.
+//
+// The violations of the `warn` rules are printed to out, and an error listing the violations of the `deny` rules is
+// returned when there's any.
+func (r *Runner) CheckPolicy(release, chart, policyFile string, o *chartify.ChartifyOpts, out io.Writer) error {
+	m, err := r.Template(release, chart, o)
+	if err != nil {
+		return err
+	}
+
+	return r.CheckManifestPolicy(release, m, policyFile, o.Namespace, out)
+}
+
+// CheckManifestPolicy evaluates the policy against the resources in the manifest already rendered for the release,
+// like CheckPolicy does
+func (r *Runner) CheckManifestPolicy(release, m, policyFile, namespace string, out io.Writer) error {
+	p, err := policy.Load(policyFile)
+	if err != nil {
+		return err
+	}
+
+	ns := namespace
+	if ns == "" {
+		ns = "default"
+	}
+
+	resources, err := manifest.Parse(m, ns)
+	if err != nil {
+		return err
+	}
+
+	if out == nil {
+		out = os.Stdout
+	}
+
+	violations := p.Evaluate(resources)
+	for _, v := range violations {
+		if v.Severity == policy.SeverityWarn {
+			fmt.Fprintln(out, v)
+		}
+	}
+
+	denied := policy.Denied(violations)
+	if len(denied) == 0 {
+		return nil
+	}
+
+	var msgs []string
+	for _, v := range denied {
+		msgs = append(msgs, v.String())
+	}
+
+	return fmt.Errorf("release %s violates %d policy rule(s) denied by %s:\n%s", release, len(denied), policyFile, strings.Join(msgs, "\n"))
+}
@@ -0,0 +1,387 @@
+package helmx
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/variantdev/chartify"
+	"gopkg.in/yaml.v3"
+)
+
+// ReleasesFile is the declarative list of the releases that are applied, diffed or rendered together
+type ReleasesFile struct {
+	Releases []ReleaseSpec `yaml:"releases"`
+}
+
+// ReleaseSpec is a release in the releases file, carrying the same options as the flags of `helm x apply`
+type ReleaseSpec struct {
+	Name string `yaml:"name"`
+
+	// Chart is the source of the release, that is anything accepted as DIR_OR_CHART
+	Chart string `yaml:"chart"`
+
+	Namespace string `yaml:"namespace,omitempty"`
+	Version   string `yaml:"version,omitempty"`
+
+	Values                []string `yaml:"values,omitempty"`
+	Set                   []string `yaml:"set,omitempty"`
+	Inject                []string `yaml:"inject,omitempty"`
+	JsonPatches           []string `yaml:"jsonPatches,omitempty"`
+	StrategicMergePatches []string `yaml:"strategicMergePatches,omitempty"`
+	AdhocDependencies     []string `yaml:"adhocDependencies,omitempty"`
+
+	Timeout        string   `yaml:"timeout,omitempty"`
+	Install        *bool    `yaml:"install,omitempty"`
+	ResetValues    bool     `yaml:"resetValues,omitempty"`
+	Adopt          []string `yaml:"adopt,omitempty"`
+	AutoAdopt      bool     `yaml:"autoAdopt,omitempty"`
+	Wait           bool     `yaml:"wait,omitempty"`
+	Atomic         bool     `yaml:"atomic,omitempty"`
+	Tillerless     bool     `yaml:"tillerless,omitempty"`
+	ServerSide     bool     `yaml:"serverSide,omitempty"`
+	ForceConflicts bool     `yaml:"forceConflicts,omitempty"`
+
+	// Needs is the list of the names of the releases that must succeed before this release is processed
+	Needs []string `yaml:"needs,omitempty"`
+}
+
+// IsReleasesFile returns true when the file is a releases file, that is a YAML document with the `releases` key
+func IsReleasesFile(file string) bool {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false
+	}
+
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(bs, &doc); err != nil {
+		return false
+	}
+
+	_, ok := doc["releases"]
+
+	return ok
+}
+
+// LoadReleasesFile reads the releases file, and sorts the releases in the order of their needs.
+//
+// The local paths in the file are relative to the directory containing the file.
+func LoadReleasesFile(file string) (*ReleasesFile, error) {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &ReleasesFile{}
+	if err := yaml.Unmarshal(bs, f); err != nil {
+		return nil, fmt.Errorf("unable to parse releases file %s: %v", file, err)
+	}
+
+	dir := filepath.Dir(file)
+	names := map[string]bool{}
+
+	for i := range f.Releases {
+		rel := &f.Releases[i]
+
+		if rel.Name == "" {
+			return nil, fmt.Errorf("invalid releases file %s: releases[%d]: name is required", file, i)
+		}
+
+		if rel.Chart == "" {
+			return nil, fmt.Errorf("invalid releases file %s: release %s: chart is required", file, rel.Name)
+		}
+
+		if names[rel.Name] {
+			return nil, fmt.Errorf("invalid releases file %s: release %s is defined more than once", file, rel.Name)
+		}
+		names[rel.Name] = true
+
+		// A chart can be a remote one like `stable/mysql`, which is left as-is unless there's a local one at the path
+		if local := resolvePath(dir, rel.Chart); local != rel.Chart {
+			if _, err := os.Stat(local); err == nil {
+				rel.Chart = local
+			}
+		}
+
+		for _, paths := range [][]string{rel.Values, rel.JsonPatches, rel.StrategicMergePatches} {
+			for j := range paths {
+				paths[j] = resolvePath(dir, paths[j])
+			}
+		}
+	}
+
+	sorted, err := SortReleases(f.Releases)
+	if err != nil {
+		return nil, fmt.Errorf("invalid releases file %s: %v", file, err)
+	}
+
+	f.Releases = sorted
+
+	return f, nil
+}
+
+// SortReleases returns the releases sorted so that every release comes after the ones it needs.
+// Independent releases keep their original order. It fails when a release needs an unknown release, or the needs form
+// a cycle.
+func SortReleases(releases []ReleaseSpec) ([]ReleaseSpec, error) {
+	byName := map[string]ReleaseSpec{}
+	for _, rel := range releases {
+		byName[rel.Name] = rel
+	}
+
+	for _, rel := range releases {
+		for _, n := range rel.Needs {
+			if _, ok := byName[n]; !ok {
+				return nil, fmt.Errorf("release %s needs %s, which doesn't exist", rel.Name, n)
+			}
+		}
+	}
+
+	var sorted []ReleaseSpec
+
+	placed := map[string]bool{}
+	remaining := append([]ReleaseSpec{}, releases...)
+
+	for len(remaining) > 0 {
+		var next []ReleaseSpec
+		var progressed bool
+
+		for _, rel := range remaining {
+			ready := true
+			for _, n := range rel.Needs {
+				if !placed[n] {
+					ready = false
+					break
+				}
+			}
+
+			if ready && !progressed {
+				sorted = append(sorted, rel)
+				placed[rel.Name] = true
+				progressed = true
+			} else {
+				next = append(next, rel)
+			}
+		}
+
+		if !progressed {
+			return nil, fmt.Errorf("releases have circular needs: %s", strings.Join(findCycle(remaining[0].Name, byName), " -> "))
+		}
+
+		remaining = next
+	}
+
+	return sorted, nil
+}
+
+// findCycle follows the needs from the release that is known to be in or to lead to a cycle, and returns the cycle
+func findCycle(start string, byName map[string]ReleaseSpec) []string {
+	var path []string
+
+	visited := map[string]int{}
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		if i, ok := visited[name]; ok {
+			if i < 0 {
+				return nil
+			}
+			return append(append([]string{}, path[i:]...), name)
+		}
+
+		visited[name] = len(path)
+		path = append(path, name)
+
+		for _, n := range byName[name].Needs {
+			if cycle := visit(n); cycle != nil {
+				return cycle
+			}
+		}
+
+		path = path[:len(path)-1]
+		visited[name] = -1
+
+		return nil
+	}
+
+	return visit(start)
+}
+
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) || strings.Contains(path, "://") {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// ChartifyOpts returns the options for the release, by appending the ones of the release to the common ones
+func (s ReleaseSpec) ChartifyOpts(common *chartify.ChartifyOpts) *chartify.ChartifyOpts {
+	o := *common
+
+	o.ValuesFiles = append(append([]string{}, common.ValuesFiles...), s.Values...)
+	o.SetValues = append(append([]string{}, common.SetValues...), s.Set...)
+	o.Injects = append(append([]string{}, common.Injects...), s.Inject...)
+	o.JsonPatches = append(append([]string{}, common.JsonPatches...), s.JsonPatches...)
+	o.StrategicMergePatches = append(append([]string{}, common.StrategicMergePatches...), s.StrategicMergePatches...)
+	o.AdhocChartDependencies = append(append([]string{}, common.AdhocChartDependencies...), s.AdhocDependencies...)
+
+	if s.Namespace != "" {
+		o.Namespace = s.Namespace
+	}
+	if s.Version != "" {
+		o.ChartVersion = s.Version
+	}
+
+	return &o
+}
+
+// UpgradeOpts returns the options for the release, by overriding the common ones with the ones of the release
+func (s ReleaseSpec) UpgradeOpts(common UpgradeOpts) *UpgradeOpts {
+	o := common
+
+	o.ChartifyOpts = s.ChartifyOpts(common.ChartifyOpts)
+	o.Adopt = append(append([]string{}, common.Adopt...), s.Adopt...)
+
+	if s.Timeout != "" {
+		o.Timeout = s.Timeout
+	}
+	if s.Install != nil {
+		o.Install = *s.Install
+	}
+
+	o.ResetValues = o.ResetValues || s.ResetValues
+	o.AutoAdopt = o.AutoAdopt || s.AutoAdopt
+	o.Wait = o.Wait || s.Wait
+	o.Atomic = o.Atomic || s.Atomic
+	o.Tillerless = o.Tillerless || s.Tillerless
+	o.ServerSide = o.ServerSide || s.ServerSide
+	o.ForceConflicts = o.ForceConflicts || s.ForceConflicts
+
+	return &o
+}
+
+// ReleaseResult is the result of running a command for a release in the releases file
+type ReleaseResult struct {
+	Release   string
+	Namespace string
+
+	// Status is the short description of the result like "applied", or "failed" when Err is set
+	Status string
+
+	Duration time.Duration
+	Err      error
+}
+
+// RunReleases calls the func for every release, with up to the concurrency of them in parallel.
+//
+// A release is processed only after all the releases it needs succeeded, and is skipped when any of them failed or was
+// skipped. The func returns the status of the release to be shown in the summary. The results are returned in the order
+// of SortReleases regardless of when they finished. Zero or negative concurrency runs all the ready releases in parallel.
+func RunReleases(releases []ReleaseSpec, concurrency int, f func(ReleaseSpec) (string, error)) ([]ReleaseResult, error) {
+	sorted, err := SortReleases(releases)
+	if err != nil {
+		return nil, err
+	}
+
+	if concurrency <= 0 || concurrency > len(sorted) {
+		concurrency = len(sorted)
+	}
+
+	results := make([]ReleaseResult, len(sorted))
+
+	index := map[string]int{}
+	done := map[string]chan struct{}{}
+	for i, rel := range sorted {
+		index[rel.Name] = i
+		done[rel.Name] = make(chan struct{})
+	}
+
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+
+	for i := range sorted {
+		wg.Add(1)
+		go func(i int, rel ReleaseSpec) {
+			defer wg.Done()
+			defer close(done[rel.Name])
+
+			var failed []string
+			for _, n := range rel.Needs {
+				<-done[n]
+
+				if results[index[n]].Err != nil {
+					failed = append(failed, n)
+				}
+			}
+
+			if len(failed) > 0 {
+				results[i] = ReleaseResult{
+					Release:   rel.Name,
+					Namespace: rel.Namespace,
+					Status:    "skipped",
+					Err:       fmt.Errorf("skipped as %s failed", strings.Join(failed, ", ")),
+				}
+				return
+			}
+
+			sem <- struct{}{}
+			results[i] = runRelease(rel, f)
+			<-sem
+		}(i, sorted[i])
+	}
+
+	wg.Wait()
+
+	return results, nil
+}
+
+func runRelease(rel ReleaseSpec, f func(ReleaseSpec) (string, error)) ReleaseResult {
+	start := time.Now()
+
+	status, err := f(rel)
+	if err != nil {
+		status = "failed"
+	}
+
+	return ReleaseResult{
+		Release:   rel.Name,
+		Namespace: rel.Namespace,
+		Status:    status,
+		Duration:  time.Since(start).Round(time.Millisecond),
+		Err:       err,
+	}
+}
+
+// PrintReleaseSummary prints the table of the results, and returns an error when any of the releases failed
+func PrintReleaseSummary(w io.Writer, results []ReleaseResult) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "RELEASE\tNAMESPACE\tSTATUS\tDURATION")
+
+	var failed []string
+
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Release, r.Namespace, r.Status, r.Duration)
+
+		if r.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", r.Release, r.Err))
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d release(s) failed or were skipped:\n%s", len(failed), len(results), strings.Join(failed, "\n"))
+	}
+
+	return nil
+}
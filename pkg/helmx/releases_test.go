@@ -0,0 +1,138 @@
+package helmx
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func releaseNames(releases []ReleaseSpec) []string {
+	var names []string
+	for _, rel := range releases {
+		names = append(names, rel.Name)
+	}
+	return names
+}
+
+func TestSortReleases(t *testing.T) {
+	testcases := []struct {
+		releases []ReleaseSpec
+		expected []string
+		err      string
+	}{
+		{
+			releases: []ReleaseSpec{
+				{Name: "app", Needs: []string{"crs"}},
+				{Name: "crs", Needs: []string{"operator"}},
+				{Name: "operator"},
+				{Name: "other"},
+			},
+			expected: []string{"operator", "crs", "app", "other"},
+		},
+		{
+			releases: []ReleaseSpec{
+				{Name: "a"},
+				{Name: "b", Needs: []string{"a"}},
+				{Name: "c"},
+			},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			releases: []ReleaseSpec{
+				{Name: "a", Needs: []string{"b"}},
+				{Name: "b", Needs: []string{"c"}},
+				{Name: "c", Needs: []string{"a"}},
+				{Name: "d"},
+			},
+			err: "releases have circular needs: a -> b -> c -> a",
+		},
+		{
+			releases: []ReleaseSpec{
+				{Name: "a", Needs: []string{"missing"}},
+			},
+			err: "release a needs missing, which doesn't exist",
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		sorted, err := SortReleases(tc.releases)
+
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("unexpected error for case %d: expected=%q, got=%v", i, tc.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("unexpected error for case %d: %v", i, err)
+		}
+
+		if actual := releaseNames(sorted); !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("unexpected order for case %d: expected=%v, got=%v", i, tc.expected, actual)
+		}
+	}
+}
+
+func TestRunReleases(t *testing.T) {
+	releases := []ReleaseSpec{
+		{Name: "app", Needs: []string{"crs"}},
+		{Name: "crs", Needs: []string{"operator"}},
+		{Name: "operator"},
+		{Name: "broken"},
+		{Name: "dependent", Needs: []string{"broken", "operator"}},
+		{Name: "transitive", Needs: []string{"dependent"}},
+	}
+
+	var mu sync.Mutex
+	var started []string
+
+	results, err := RunReleases(releases, 0, func(rel ReleaseSpec) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, n := range rel.Needs {
+			var found bool
+			for _, s := range started {
+				found = found || s == n
+			}
+			if !found {
+				return "", fmt.Errorf("%s started before %s", rel.Name, n)
+			}
+		}
+
+		started = append(started, rel.Name)
+
+		if rel.Name == "broken" {
+			return "", fmt.Errorf("broken")
+		}
+
+		return "applied", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"operator":   "applied",
+		"crs":        "applied",
+		"app":        "applied",
+		"broken":     "failed",
+		"dependent":  "skipped",
+		"transitive": "skipped",
+	}
+
+	for _, r := range results {
+		if r.Status != expected[r.Release] {
+			t.Errorf("unexpected status of %s: expected=%s, got=%s (%v)", r.Release, expected[r.Release], r.Status, r.Err)
+		}
+	}
+
+	if r := results[len(results)-1]; r.Release != "transitive" || !strings.Contains(r.Err.Error(), "dependent failed") {
+		t.Errorf("unexpected result of transitive: %+v", r)
+	}
+}
@@ -6,40 +6,69 @@ import (
 	"github.com/mumoshu/helm-x/pkg/releasetool"
 	"github.com/mumoshu/helm-x/pkg/util"
 	"io"
+	"os"
 	"strings"
 )
 
 type RenderOpts struct {
 	*chartify.ChartifyOpts
+	*ValidateOpts
 
 	IncludeReleaseConfigmap bool
 	IncludeReleaseSecret    bool
 
+	// PolicyFile is the path to the policy to be checked against the rendered resources
+	PolicyFile string
+
+	// PinDigests is the path to the file mapping image tags to digests, which the rendered images are pinned to
+	PinDigests string
+
 	Out io.Writer
 }
 
-// Render generates K8s manifests for the named release from the chart, and prints the resulting manifests to STDOUT
-func (r *Runner) Render(release, chart string, templateOpts RenderOpts) error {
+// Template renders the chart with `helm template` and returns the resulting K8s manifests
+func (r *Runner) Template(release, chart string, o *chartify.ChartifyOpts) (string, error) {
 	var additionalFlags string
-	additionalFlags += util.CreateFlagChain("set", templateOpts.SetValues)
-	additionalFlags += util.CreateFlagChain("f", templateOpts.ValuesFiles)
-	if templateOpts.Namespace != "" {
-		additionalFlags += util.CreateFlagChain("namespace", []string{templateOpts.Namespace})
+	additionalFlags += util.CreateFlagChain("set", o.SetValues)
+	additionalFlags += util.CreateFlagChain("f", o.ValuesFiles)
+	if o.Namespace != "" {
+		additionalFlags += util.CreateFlagChain("namespace", []string{o.Namespace})
 	}
-	if release != "" {
+	if release != "" && !r.IsHelm3() {
 		additionalFlags += util.CreateFlagChain("name", []string{release})
 	}
-	if templateOpts.Debug {
+	if o.Debug {
 		additionalFlags += util.CreateFlagChain("debug", []string{""})
 	}
-	if templateOpts.ChartVersion != "" {
-		additionalFlags += util.CreateFlagChain("--version", []string{templateOpts.ChartVersion})
+	if o.ChartVersion != "" {
+		additionalFlags += util.CreateFlagChain("version", []string{o.ChartVersion})
 	}
 
 	command := fmt.Sprintf("%s template %s%s", r.HelmBin(), chart, additionalFlags)
+	if r.IsHelm3() && release != "" {
+		// Helm 3 takes the release name as the first positional argument, and has no --name flag
+		command = fmt.Sprintf("%s template %s %s%s", r.HelmBin(), release, chart, additionalFlags)
+	}
 	stdout, stderr, err := r.DeprecatedCaptureBytes(command)
-	if err != nil || len(stderr) != 0 {
-		return fmt.Errorf(string(stderr))
+	if err != nil {
+		if len(stderr) == 0 {
+			return "", err
+		}
+		return "", fmt.Errorf(string(stderr))
+	}
+	// Warnings like the ones for deprecated charts don't make the rendering fail. They are printed to stderr, so
+	// that the rendered manifests in stdout are kept intact
+	printWarnings(os.Stderr, stderr)
+
+	return string(stdout), nil
+}
+
+// Render generates K8s manifests for the named release from the chart, and prints the resulting manifests to Out, or
+// STDOUT if not set
+func (r *Runner) Render(release, chart string, templateOpts RenderOpts) error {
+	stdout, err := r.Template(release, chart, templateOpts.ChartifyOpts)
+	if err != nil {
+		return err
 	}
 
 	var output string
@@ -71,15 +100,20 @@ func (r *Runner) Render(release, chart string, templateOpts RenderOpts) error {
 			releaseManifests = append(releaseManifests, storage.ReleaseToSecret)
 		}
 
-		output, err = releasetool.TurnHelmTemplateToInstall(chartWithoutRepoName, ver, templateOpts.TillerNamespace, release, templateOpts.Namespace, string(stdout), releaseManifests...)
+		output, err = releasetool.TurnHelmTemplateToInstall(chartWithoutRepoName, ver, templateOpts.TillerNamespace, release, templateOpts.Namespace, stdout, releaseManifests...)
 		if err != nil {
 			return err
 		}
 	} else {
-		output = string(stdout)
+		output = stdout
+	}
+
+	out := templateOpts.Out
+	if out == nil {
+		out = os.Stdout
 	}
 
-	fmt.Println(output)
+	fmt.Fprintln(out, output)
 
 	return nil
 }
@@ -0,0 +1,74 @@
+package helmx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/variantdev/chartify"
+)
+
+func TestTemplate(t *testing.T) {
+	helm, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const m = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n"
+
+	testcases := []struct {
+		stderr string
+		exit   error
+
+		manifest string
+		err      string
+	}{
+		{
+			manifest: m,
+		},
+		{
+			// Warnings like the one for deprecated charts don't make the rendering fail
+			stderr:   "WARNING: This chart is deprecated",
+			manifest: m,
+		},
+		{
+			stderr: "Error: template: foo/templates/cm.yaml:4:3: executing \"foo/templates/cm.yaml\"",
+			exit:   errors.New("exit status 1"),
+			err:    "Error: template: foo/templates/cm.yaml:4:3: executing \"foo/templates/cm.yaml\"",
+		},
+		{
+			exit: errors.New("exit status 1"),
+			err:  "exit status 1",
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		r := New(HelmBin(helm), UseHelm3(true), Commander(func(cmd string, args []string, stdout, stderr io.Writer, env map[string]string) error {
+			fmt.Fprint(stderr, tc.stderr)
+			if tc.exit != nil {
+				return tc.exit
+			}
+			fmt.Fprint(stdout, m)
+			return nil
+		}))
+
+		manifest, err := r.Template("foo", "/tmp/chart", &chartify.ChartifyOpts{})
+
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+
+		if errMsg != tc.err {
+			t.Errorf("unexpected error for case %d: expected=%q, got=%q", i, tc.err, errMsg)
+		}
+
+		if manifest != tc.manifest {
+			t.Errorf("unexpected manifest for case %d: expected=%q, got=%q", i, tc.manifest, manifest)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package helmx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+// ResourceRef is a reference to a K8s resource in the `[namespace/]kind/name` form
+type ResourceRef struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// Ref returns the resource reference in the `kind/name` form that is understood by `kubectl get`
+func (r ResourceRef) Ref() string {
+	return fmt.Sprintf("%s/%s", r.Kind, r.Name)
+}
+
+func (r ResourceRef) String() string {
+	if r.Namespace == "" {
+		return r.Ref()
+	}
+	return fmt.Sprintf("%s/%s", r.Namespace, r.Ref())
+}
+
+// ParseResourceRef parses a resource reference like `ns/kind/name` or `kind/name`.
+// defaultNamespace is used when the namespace is omitted. The namespace is always empty for cluster-scoped kinds.
+func ParseResourceRef(ref, defaultNamespace string) (ResourceRef, error) {
+	var r ResourceRef
+
+	items := strings.Split(ref, "/")
+	switch len(items) {
+	case 2:
+		r = ResourceRef{Namespace: defaultNamespace, Kind: items[0], Name: items[1]}
+	case 3:
+		r = ResourceRef{Namespace: items[0], Kind: items[1], Name: items[2]}
+	default:
+		return r, fmt.Errorf("invalid resource reference \"%s\": must be in the form of `ns/kind/name` or `kind/name`", ref)
+	}
+
+	if r.Kind == "" || r.Name == "" {
+		return r, fmt.Errorf("invalid resource reference \"%s\": kind and name must not be empty", ref)
+	}
+
+	if manifest.IsClusterScoped(r.Kind) {
+		r.Namespace = ""
+	}
+
+	return r, nil
+}
+
+// groupByNamespace groups the references by their namespaces, in the order of the namespaces.
+// Cluster-scoped resources are grouped under the empty namespace.
+func groupByNamespace(refs []ResourceRef) ([]string, map[string][]string) {
+	groups := map[string][]string{}
+	for _, r := range refs {
+		groups[r.Namespace] = append(groups[r.Namespace], r.Ref())
+	}
+
+	namespaces := []string{}
+	for ns := range groups {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	return namespaces, groups
+}
+
+// getResourcesByRefs fetches the resources namespace by namespace, and sanitizes them with `export`
+func (r *Runner) getResourcesByRefs(refs []ResourceRef, ignoreNotFound bool) ([]map[string]interface{}, error) {
+	return r.fetchByRefs(refs, ignoreNotFound, r.getResources)
+}
+
+// getObjectsByRefs fetches the resources namespace by namespace as they are, including their statuses
+func (r *Runner) getObjectsByRefs(refs []ResourceRef, ignoreNotFound bool) ([]map[string]interface{}, error) {
+	return r.fetchByRefs(refs, ignoreNotFound, r.getObjects)
+}
+
+type getFunc func(ns string, resources []string, ignoreNotFound bool) ([]map[string]interface{}, error)
+
+func (r *Runner) fetchByRefs(refs []ResourceRef, ignoreNotFound bool, get getFunc) ([]map[string]interface{}, error) {
+	namespaces, groups := groupByNamespace(refs)
+
+	var items []map[string]interface{}
+
+	for _, ns := range namespaces {
+		nsItems, err := get(ns, groups[ns], ignoreNotFound)
+		if err != nil {
+			return nil, err
+		}
+
+		if ns == "" {
+			for _, item := range nsItems {
+				delete(item["metadata"].(map[string]interface{}), "namespace")
+			}
+		}
+
+		items = append(items, nsItems...)
+	}
+
+	return items, nil
+}
+
+func parseResourceRefs(resources []string, defaultNamespace string) ([]ResourceRef, error) {
+	var refs []ResourceRef
+	for _, res := range resources {
+		ref, err := ParseResourceRef(res, defaultNamespace)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// ClusterScopedKinds returns the kinds, resource names and short names of the cluster-scoped resources served by the
+// cluster, including the custom resources like `ClusterIssuer`, from `kubectl api-resources --namespaced=false`
+func (r *Runner) ClusterScopedKinds() ([]string, error) {
+	out, err := r.Run("kubectl", "api-resources", "--namespaced=false", "--request-timeout=10s")
+
+	// kubectl fails when any API group is unavailable, like metrics.k8s.io without metrics-server, after printing the
+	// resources of the other groups
+	if err != nil && strings.TrimSpace(out) == "" {
+		return nil, err
+	}
+
+	return parseAPIResources(out)
+}
+
+// parseAPIResources parses the table printed by `kubectl api-resources` like:
+//
+//	NAME              SHORTNAMES   APIVERSION                 NAMESPACED   KIND
+//	clusterissuers                 cert-manager.io/v1         false        ClusterIssuer
+//	namespaces        ns           v1                         false        Namespace
+//
+// Older kubectl versions print APIGROUP in place of APIVERSION.
+func parseAPIResources(out string) ([]string, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+
+	header := lines[0]
+	if !strings.HasPrefix(header, "NAME") {
+		return nil, fmt.Errorf("unexpected output from kubectl api-resources: %s", header)
+	}
+
+	// SHORTNAMES is the only column that can be empty, so it is cut out by its position in the header
+	shortNamesStart := strings.Index(header, "SHORTNAMES")
+	shortNamesEnd := strings.Index(header, "APIVERSION")
+	if shortNamesEnd < 0 {
+		shortNamesEnd = strings.Index(header, "APIGROUP")
+	}
+
+	var kinds []string
+
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		kinds = append(kinds, fields[0], fields[len(fields)-1])
+
+		if shortNamesStart > 0 && shortNamesEnd > shortNamesStart && len(line) > shortNamesStart {
+			end := shortNamesEnd
+			if end > len(line) {
+				end = len(line)
+			}
+
+			for _, s := range strings.Split(strings.TrimSpace(line[shortNamesStart:end]), ",") {
+				if s != "" {
+					kinds = append(kinds, s)
+				}
+			}
+		}
+	}
+
+	return kinds, nil
+}
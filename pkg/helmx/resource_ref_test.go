@@ -0,0 +1,132 @@
+package helmx
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+func TestParseAPIResources(t *testing.T) {
+	testcases := []struct {
+		out      string
+		expected []string
+	}{
+		{
+			out: `NAME                              SHORTNAMES   APIVERSION                        NAMESPACED   KIND
+clusterissuers                                 cert-manager.io/v1                false        ClusterIssuer
+k8srequiredlabels                              constraints.gatekeeper.sh/v1beta1 false        K8sRequiredLabels
+namespaces                        ns           v1                                false        Namespace
+customresourcedefinitions         crd,crds     apiextensions.k8s.io/v1           false        CustomResourceDefinition
+`,
+			expected: []string{
+				"clusterissuers", "ClusterIssuer",
+				"k8srequiredlabels", "K8sRequiredLabels",
+				"namespaces", "Namespace", "ns",
+				"customresourcedefinitions", "CustomResourceDefinition", "crd", "crds",
+			},
+		},
+		{
+			// kubectl 1.19 and older
+			out: `NAME              SHORTNAMES   APIGROUP          NAMESPACED   KIND
+clusterissuers                 cert-manager.io   false        ClusterIssuer
+nodes             no                             false        Node
+`,
+			expected: []string{
+				"clusterissuers", "ClusterIssuer",
+				"nodes", "Node", "no",
+			},
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		actual, err := parseAPIResources(tc.out)
+		if err != nil {
+			t.Fatalf("unexpected error for case %d: %v", i, err)
+		}
+
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("unexpected result for case %d:\nexpected=%q\ngot=%q", i, tc.expected, actual)
+		}
+	}
+}
+
+func TestParseResourceRefClusterScoped(t *testing.T) {
+	defer manifest.SetScopeResolver(nil)
+
+	var calls int
+
+	manifest.SetScopeResolver(func() ([]string, error) {
+		calls++
+		return []string{"clusterissuers", "ClusterIssuer"}, nil
+	})
+
+	testcases := []struct {
+		ref      string
+		expected ResourceRef
+	}{
+		{ref: "ClusterIssuer/letsencrypt", expected: ResourceRef{Kind: "ClusterIssuer", Name: "letsencrypt"}},
+		{ref: "foo/clusterissuers.cert-manager.io/letsencrypt", expected: ResourceRef{Kind: "clusterissuers.cert-manager.io", Name: "letsencrypt"}},
+		{ref: "Issuer/letsencrypt", expected: ResourceRef{Kind: "Issuer", Namespace: "default", Name: "letsencrypt"}},
+		{ref: "ClusterRole/admin", expected: ResourceRef{Kind: "ClusterRole", Name: "admin"}},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		actual, err := ParseResourceRef(tc.ref, "default")
+		if err != nil {
+			t.Fatalf("unexpected error for case %d: %v", i, err)
+		}
+
+		if actual != tc.expected {
+			t.Errorf("unexpected result for case %d: expected=%v, got=%v", i, tc.expected, actual)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("expected the cluster to be asked once, got %d", calls)
+	}
+
+	// The well-known kinds are used alone when the cluster is unreachable
+	manifest.SetScopeResolver(func() ([]string, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	if ref, _ := ParseResourceRef("ClusterIssuer/letsencrypt", "default"); ref.Namespace != "default" {
+		t.Errorf("unexpected namespace for the unknown kind: %q", ref.Namespace)
+	}
+
+	if ref, _ := ParseResourceRef("ClusterRole/admin", "default"); ref.Namespace != "" {
+		t.Errorf("unexpected namespace for the well-known cluster-scoped kind: %q", ref.Namespace)
+	}
+}
+
+func TestParseClusterScopedCRD(t *testing.T) {
+	resources, err := manifest.Parse(`apiVersion: constraints.gatekeeper.sh/v1beta1
+kind: K8sRequiredLabels
+metadata:
+  name: ns-must-have-owner
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: k8srequiredlabels.constraints.gatekeeper.sh
+spec:
+  group: constraints.gatekeeper.sh
+  scope: Cluster
+  names:
+    kind: K8sRequiredLabels
+    plural: k8srequiredlabels
+`, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ns := resources[0].Namespace; ns != "" {
+		t.Errorf("unexpected namespace for the custom resource of the cluster-scoped CRD: %q", ns)
+	}
+}
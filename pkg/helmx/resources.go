@@ -0,0 +1,179 @@
+package helmx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/variantdev/chartify"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+	"github.com/mumoshu/helm-x/pkg/usage"
+)
+
+const (
+	ResourcesOutputText = "text"
+	ResourcesOutputJSON = "json"
+)
+
+// ResourcesOpts is the options for Resources
+type ResourcesOpts struct {
+	*chartify.ChartifyOpts
+
+	// Nodes is the number of the nodes each DaemonSet runs a pod on. Defaults to 1
+	Nodes int64
+
+	// QuotaFile is the path to the YAML file containing the ResourceQuotas to check the totals against
+	QuotaFile string
+
+	// Output is either "text" to print a table, or "json" to emit the workloads and the totals
+	Output string
+
+	Out io.Writer
+}
+
+type resourcesReport struct {
+	Workloads     []workloadReport `json:"workloads"`
+	Summaries     []usage.Summary  `json:"summaries"`
+	QuotaFailures []string         `json:"quotaFailures,omitempty"`
+}
+
+type workloadReport struct {
+	Kind            string        `json:"kind"`
+	Namespace       string        `json:"namespace,omitempty"`
+	Name            string        `json:"name"`
+	Source          string        `json:"source,omitempty"`
+	Pods            int64         `json:"pods"`
+	Pod             usage.Amounts `json:"pod"`
+	Total           usage.Amounts `json:"total"`
+	MissingRequests []string      `json:"missingRequests,omitempty"`
+}
+
+// Resources renders the chart and reports the CPU and memory requested and limited by the pods of the workloads in
+// total, per namespace and kind, including hooks and the sidecars added by injectors.
+//
+// Containers requesting no CPU or memory are reported as warnings. When QuotaFile is set, the totals are checked against
+// the ResourceQuotas in the file and an error is returned when the release wouldn't fit in them.
+func (r *Runner) Resources(release, chart string, o ResourcesOpts) error {
+	m, err := r.Template(release, chart, o.ChartifyOpts)
+	if err != nil {
+		return err
+	}
+
+	ns := o.Namespace
+	if ns == "" {
+		ns = "default"
+	}
+
+	resources, err := manifest.Parse(m, ns)
+	if err != nil {
+		return err
+	}
+
+	nodes := o.Nodes
+	if nodes == 0 {
+		nodes = 1
+	}
+
+	workloads, err := usage.Workloads(resources, nodes)
+	if err != nil {
+		return err
+	}
+
+	var quotas []usage.Quota
+	if o.QuotaFile != "" {
+		quotas, err = usage.LoadQuotas(o.QuotaFile, ns)
+		if err != nil {
+			return err
+		}
+	}
+
+	out := o.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	report := resourcesReport{Summaries: usage.Summarize(workloads)}
+
+	var warnings []string
+
+	for _, w := range workloads {
+		report.Workloads = append(report.Workloads, workloadReport{
+			Kind:            w.Resource.Kind,
+			Namespace:       w.Resource.Namespace,
+			Name:            w.Resource.Name,
+			Source:          w.Resource.Source,
+			Pods:            w.Pods,
+			Pod:             w.Pod,
+			Total:           w.Total,
+			MissingRequests: w.MissingRequests(),
+		})
+
+		for _, msg := range w.MissingRequests() {
+			warnings = append(warnings, fmt.Sprintf("warning: %s/%s in %s: %s", w.Resource.Kind, w.Resource.Name, w.Resource.Source, msg))
+		}
+	}
+
+	for _, q := range quotas {
+		if q.Scoped {
+			warnings = append(warnings, fmt.Sprintf("warning: %s is skipped, as quotas with scopes aren't supported", q))
+			continue
+		}
+		report.QuotaFailures = append(report.QuotaFailures, q.Check(workloads)...)
+	}
+
+	switch o.Output {
+	case ResourcesOutputJSON:
+		if report.Workloads == nil {
+			report.Workloads = []workloadReport{}
+			report.Summaries = []usage.Summary{}
+		}
+
+		bs, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(out, string(bs))
+	case ResourcesOutputText, "":
+		if err := printSummaries(out, report.Summaries); err != nil {
+			return err
+		}
+
+		for _, w := range warnings {
+			fmt.Fprintln(out, w)
+		}
+	default:
+		return fmt.Errorf("unsupported output format %q: must be either %s or %s", o.Output, ResourcesOutputText, ResourcesOutputJSON)
+	}
+
+	if len(report.QuotaFailures) > 0 {
+		return fmt.Errorf("release %s would fail to fit in the quotas in %s:\n%s", release, o.QuotaFile, strings.Join(report.QuotaFailures, "\n"))
+	}
+
+	return nil
+}
+
+func printSummaries(out io.Writer, summaries []usage.Summary) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "NAMESPACE\tKIND\tWORKLOADS\tPODS\tCPU REQUESTS\tCPU LIMITS\tMEMORY REQUESTS\tMEMORY LIMITS")
+
+	for _, s := range summaries {
+		ns, kind := s.Namespace, s.Kind
+		if kind == "" {
+			kind = "(total)"
+		}
+		if ns == "" {
+			ns = "(all)"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\n", ns, kind, s.Workloads, s.Pods,
+			usage.FormatCPU(s.Total.CPURequests), usage.FormatCPU(s.Total.CPULimits), usage.FormatMemory(s.Total.MemoryRequests), usage.FormatMemory(s.Total.MemoryLimits))
+	}
+
+	return w.Flush()
+}
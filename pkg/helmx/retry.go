@@ -0,0 +1,77 @@
+package helmx
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// transientErrorPatterns match the messages of the helm failures caused by temporary conditions of the cluster or
+// Tiller, which are likely to succeed when retried
+var transientErrorPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`another operation \(install/upgrade/rollback\) is in progress`),
+	regexp.MustCompile(`etcdserver: (leader changed|request timed out|too many requests)`),
+	regexp.MustCompile(`the server was unable to return a response in the time allotted`),
+	regexp.MustCompile(`the server is currently unable to handle the request`),
+	regexp.MustCompile(`Timeout: request did not complete within`),
+	regexp.MustCompile(`Client\.Timeout exceeded|TLS handshake timeout|i/o timeout|context deadline exceeded`),
+	regexp.MustCompile(`connection refused|connection reset by peer|broken pipe|unexpected EOF`),
+	regexp.MustCompile(`http2: server sent GOAWAY|transport is closing|rpc error: code = Unavailable`),
+	regexp.MustCompile(`the object has been modified; please apply your changes to the latest version`),
+	regexp.MustCompile(`\(TooManyRequests\)|\(ServiceUnavailable\)|\(InternalError\)`),
+}
+
+// IsTransient returns true when the helm failure is caused by a temporary condition like an API timeout, an etcd leader
+// change or another operation in progress on the release, rather than the chart or the cluster state
+func IsTransient(msg string) bool {
+	for _, p := range transientErrorPatterns {
+		if p.MatchString(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// sleep is replaced in tests
+var sleep = time.Sleep
+
+// retry runs f, and runs it again up to retries times while it fails with transient errors, waiting for backoff before
+// the first retry and doubling it after each retry. Every failed attempt is logged to out
+func retry(desc string, retries int, backoff time.Duration, out io.Writer, f func() error) error {
+	attempts := retries + 1
+
+	for i := 1; ; i++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+
+		if i >= attempts || !IsTransient(err.Error()) {
+			return err
+		}
+
+		fmt.Fprintf(out, "attempt %d/%d of %s failed with a transient error. retrying in %s: %s\n", i, attempts, desc, backoff, strings.TrimSpace(err.Error()))
+
+		sleep(backoff)
+
+		backoff *= 2
+	}
+}
+
+// printWarnings prints the stderr of the succeeded helm command, like deprecation warnings, instead of failing on it.
+// The lines already marked as warnings like `WARNING: This chart is deprecated` are printed as they are
+func printWarnings(out io.Writer, stderr []byte) {
+	for _, l := range strings.Split(strings.TrimSpace(string(stderr)), "\n") {
+		l = strings.TrimSpace(l)
+
+		switch {
+		case l == "":
+		case strings.HasPrefix(strings.ToLower(l), "warning"):
+			fmt.Fprintln(out, l)
+		default:
+			fmt.Fprintf(out, "warning: %s\n", l)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package helmx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/variantdev/chartify"
+)
+
+func TestIsTransient(t *testing.T) {
+	testcases := []struct {
+		msg      string
+		expected bool
+	}{
+		{msg: `Error: UPGRADE FAILED: another operation (install/upgrade/rollback) is in progress`, expected: true},
+		{msg: `Error: UPGRADE FAILED: etcdserver: leader changed`, expected: true},
+		{msg: `Error: UPGRADE FAILED: Get https://10.0.0.1:443/api/v1/namespaces/default/configmaps: net/http: TLS handshake timeout`, expected: true},
+		{msg: `Error: transport is closing`, expected: true},
+		{msg: `Error: UPGRADE FAILED: Deployment.apps "myapp" is invalid: spec.template.spec.containers[0].image: Required value`, expected: false},
+		{msg: `Error: UPGRADE FAILED: timed out waiting for the condition`, expected: false},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		if actual := IsTransient(tc.msg); actual != tc.expected {
+			t.Errorf("unexpected result for case %d: expected=%v, got=%v", i, tc.expected, actual)
+		}
+	}
+}
+
+func TestUpgradeRetries(t *testing.T) {
+	helm, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sleeps []time.Duration
+	sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	defer func() { sleep = time.Sleep }()
+
+	testcases := []struct {
+		// failures is the stderr of each failed attempt, followed by the succeeded attempt printing warning to stderr
+		failures []string
+		warning  string
+
+		retries  int
+		attempts int
+		err      string
+		out      []string
+		sleeps   []time.Duration
+	}{
+		{
+			failures: []string{"Error: UPGRADE FAILED: etcdserver: leader changed\n", "Error: UPGRADE FAILED: another operation (install/upgrade/rollback) is in progress\n"},
+			retries:  3,
+			attempts: 3,
+			out: []string{
+				"attempt 1/4 of helm upgrade failed with a transient error. retrying in 1s: Error: UPGRADE FAILED: etcdserver: leader changed",
+				"attempt 2/4 of helm upgrade failed with a transient error. retrying in 2s: Error: UPGRADE FAILED: another operation (install/upgrade/rollback) is in progress",
+			},
+			sleeps: []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			failures: []string{"Error: UPGRADE FAILED: etcdserver: leader changed\n", "Error: UPGRADE FAILED: etcdserver: leader changed\n"},
+			retries:  1,
+			attempts: 2,
+			err:      "Error: UPGRADE FAILED: etcdserver: leader changed\n",
+			out:      []string{"attempt 1/2 of helm upgrade failed with a transient error. retrying in 1s: Error: UPGRADE FAILED: etcdserver: leader changed"},
+			sleeps:   []time.Duration{time.Second},
+		},
+		{
+			failures: []string{"Error: UPGRADE FAILED: Deployment.apps \"myapp\" is invalid\n"},
+			retries:  3,
+			attempts: 1,
+			err:      "Error: UPGRADE FAILED: Deployment.apps \"myapp\" is invalid\n",
+		},
+		{
+			warning:  "WARNING: This chart is deprecated\ncoalesce.go:199: warning: destination for env is a table. Ignoring non-table value []\n",
+			attempts: 1,
+			out:      []string{"WARNING: This chart is deprecated", "warning: coalesce.go:199: warning: destination for env is a table. Ignoring non-table value []"},
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		sleeps = nil
+
+		var attempts int
+
+		r := New(HelmBin(helm), UseHelm3(true), Commander(func(cmd string, args []string, stdout, stderr io.Writer, env map[string]string) error {
+			attempts++
+
+			if attempts <= len(tc.failures) {
+				fmt.Fprint(stderr, tc.failures[attempts-1])
+				return errors.New("exit status 1")
+			}
+
+			fmt.Fprint(stderr, tc.warning)
+			return nil
+		}))
+
+		out := &bytes.Buffer{}
+
+		err := r.Upgrade("myapp", "/tmp/chart", UpgradeOpts{ChartifyOpts: &chartify.ChartifyOpts{}, ClientOpts: &ClientOpts{}, Retries: tc.retries, RetryBackoff: time.Second, Out: out})
+
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+
+		if errMsg != tc.err {
+			t.Errorf("unexpected error for case %d: expected=%q, got=%q", i, tc.err, errMsg)
+		}
+
+		if attempts != tc.attempts {
+			t.Errorf("unexpected number of attempts for case %d: expected=%d, got=%d", i, tc.attempts, attempts)
+		}
+
+		var lines []string
+		if s := strings.TrimSpace(out.String()); s != "" {
+			lines = strings.Split(s, "\n")
+		}
+
+		if strings.Join(lines, "\n") != strings.Join(tc.out, "\n") {
+			t.Errorf("unexpected output for case %d:\nexpected=%q\ngot=%q", i, tc.out, lines)
+		}
+
+		if fmt.Sprint(sleeps) != fmt.Sprint(tc.sleeps) {
+			t.Errorf("unexpected backoffs for case %d: expected=%v, got=%v", i, tc.sleeps, sleeps)
+		}
+	}
+}
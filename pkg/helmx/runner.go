@@ -2,6 +2,7 @@ package helmx
 
 import (
 	"github.com/mumoshu/helm-x/pkg/cmdsite"
+	"github.com/mumoshu/helm-x/pkg/releasetool"
 	"io"
 	"os"
 	"os/exec"
@@ -12,6 +13,17 @@ type Runner struct {
 	helmBin   string
 	isHelm3   bool
 	commander *cmdsite.CommandSite
+
+	// releaseStorage replaces the Helm 2 release storage in the tiller namespace in tests
+	releaseStorage *releasetool.ReleaseTool
+}
+
+// releaseTool returns the storage of the Helm 2 releases in the tiller namespace
+func (r *Runner) releaseTool(tillerNs, backend string) (*releasetool.ReleaseTool, error) {
+	if r.releaseStorage != nil {
+		return r.releaseStorage, nil
+	}
+	return releasetool.New(tillerNs, releasetool.Opts{StorageBackend: backend})
 }
 
 type Option func(*Runner) error
@@ -0,0 +1,127 @@
+package helmx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+// FieldManager is the field manager helm-x uses for server-side apply
+const FieldManager = "helm-x"
+
+// FieldConflict is a field that server-side apply refused to take over because it is owned by another field manager
+type FieldConflict struct {
+	Manager string
+	Field   string
+}
+
+func (c FieldConflict) String() string {
+	return fmt.Sprintf("%s (managed by %q)", c.Field, c.Manager)
+}
+
+var (
+	applyFailedPattern = regexp.MustCompile(`^(?:error: )?Apply failed with \d+ conflicts?: `)
+	conflictsPattern   = regexp.MustCompile(`^conflicts? with "([^"]+)"(?: using [^:]+)?:\s*(.*)$`)
+)
+
+// ParseConflicts extracts the field-ownership conflicts from the error output of `kubectl apply --server-side`.
+func ParseConflicts(msg string) []FieldConflict {
+	var conflicts []FieldConflict
+
+	var manager string
+
+	for _, line := range strings.Split(msg, "\n") {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "Please review the fields above") {
+			break
+		}
+
+		line = applyFailedPattern.ReplaceAllString(line, "")
+
+		if m := conflictsPattern.FindStringSubmatch(line); m != nil {
+			manager = m[1]
+			if m[2] != "" {
+				conflicts = append(conflicts, FieldConflict{Manager: manager, Field: m[2]})
+			}
+			continue
+		}
+
+		if manager != "" && strings.HasPrefix(line, "- ") {
+			conflicts = append(conflicts, FieldConflict{Manager: manager, Field: strings.TrimPrefix(line, "- ")})
+		}
+	}
+
+	return conflicts
+}
+
+// serverSideApply applies the resources one by one with server-side apply under the helm-x field manager.
+//
+// It keeps applying the rest of resources on failure, so that all the field-ownership conflicts can be reported at once.
+func (r *Runner) serverSideApply(ns string, resources []*manifest.Resource, forceConflicts bool) error {
+	var failures []string
+
+	for _, res := range resources {
+		y, err := res.Yaml()
+		if err != nil {
+			return err
+		}
+
+		stderr, err := r.serverSideApplyManifest(ns, y, forceConflicts)
+		if err == nil {
+			continue
+		}
+
+		conflicts := ParseConflicts(stderr)
+		if len(conflicts) == 0 {
+			failures = append(failures, fmt.Sprintf("%s: %v: %s", resourceID(res), err, strings.TrimSpace(stderr)))
+			continue
+		}
+
+		lines := []string{fmt.Sprintf("%s: %d conflict(s)", resourceID(res), len(conflicts))}
+		for _, c := range conflicts {
+			lines = append(lines, "  "+c.String())
+		}
+		failures = append(failures, strings.Join(lines, "\n"))
+	}
+
+	if len(failures) > 0 {
+		msg := fmt.Sprintf("server-side apply failed for %d resource(s):\n%s", len(failures), strings.Join(failures, "\n"))
+		if !forceConflicts {
+			msg += "\nrerun with --force-conflicts to take over the conflicting fields"
+		}
+		return fmt.Errorf("%s", msg)
+	}
+
+	return nil
+}
+
+func (r *Runner) serverSideApplyManifest(ns, m string, forceConflicts bool) (string, error) {
+	f, err := ioutil.TempFile("", "helm-x-apply")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(m); err != nil {
+		f.Close()
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	args := []string{"apply", "--server-side", "--field-manager=" + FieldManager, "-n=" + ns, "-f", f.Name()}
+	if forceConflicts {
+		args = append(args, "--force-conflicts")
+	}
+
+	_, stderr, err := r.CaptureBytes("kubectl", args)
+
+	return string(stderr), err
+}
@@ -0,0 +1,46 @@
+package helmx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseConflicts(t *testing.T) {
+	testcases := []struct {
+		msg      string
+		expected []FieldConflict
+	}{
+		{
+			msg: `error: Apply failed with 1 conflict: conflict with "kubectl-client-side-apply" using apps/v1: .spec.replicas
+Please review the fields above--they currently have other managers. Here are the ways you can resolve this warning:
+* If you intend to manage all of these fields, please re-run the apply command with the ` + "`--force-conflicts`" + ` flag.`,
+			expected: []FieldConflict{{Manager: "kubectl-client-side-apply", Field: ".spec.replicas"}},
+		},
+		{
+			msg: `error: Apply failed with 3 conflicts: conflicts with "kubectl-client-side-apply" using apps/v1:
+- .spec.replicas
+- .spec.template.spec.containers[name="nginx"].image
+conflict with "kube-controller-manager": .metadata.annotations.foo
+Please review the fields above--they currently have other managers.`,
+			expected: []FieldConflict{
+				{Manager: "kubectl-client-side-apply", Field: ".spec.replicas"},
+				{Manager: "kubectl-client-side-apply", Field: `.spec.template.spec.containers[name="nginx"].image`},
+				{Manager: "kube-controller-manager", Field: ".metadata.annotations.foo"},
+			},
+		},
+		{
+			msg:      `error: unable to recognize "manifest.yaml": no matches for kind "Foo" in version "example.com/v1"`,
+			expected: nil,
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		actual := ParseConflicts(tc.msg)
+
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("unexpected result for case %d: expected=%v, got=%v", i, tc.expected, actual)
+		}
+	}
+}
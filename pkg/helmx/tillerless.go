@@ -0,0 +1,399 @@
+package helmx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	rspb "k8s.io/helm/pkg/proto/hapi/release"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+	"github.com/mumoshu/helm-x/pkg/releasetool"
+)
+
+// See https://github.com/helm/helm/blob/v2.13.1/pkg/hooks/hooks.go
+const (
+	hookWeightAnnotation       = "helm.sh/hook-weight"
+	hookDeletePolicyAnnotation = "helm.sh/hook-delete-policy"
+
+	hookSucceeded          = "hook-succeeded"
+	hookFailed             = "hook-failed"
+	hookBeforeHookCreation = "before-hook-creation"
+)
+
+// tillerlessUpgrade installs or upgrades the release without Tiller.
+//
+// It renders the chart, records the new revision as pending in the Tiller storage so that the release can still be
+// managed with helm, applies the resources with kubectl in the same order as Tiller does, either client-side or
+// server-side, runs the hooks, marks the revision as deployed or failed, and finally deletes the resources that have
+// been removed since the previous revision.
+func (r *Runner) tillerlessUpgrade(release, chart string, o UpgradeOpts) error {
+	if r.IsHelm3() {
+		if o.ServerSide {
+			return fmt.Errorf("--server-side is supported only with Helm 2, as it writes the release record into the Tiller storage")
+		}
+		return fmt.Errorf("--tillerless is supported only with Helm 2, as Helm 3 has no Tiller")
+	}
+
+	out := o.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	ns := o.Namespace
+	if ns == "" {
+		ns = "default"
+	}
+
+	rendered, err := r.manifestOf(release, chart, o)
+	if err != nil {
+		return err
+	}
+
+	resources, err := manifest.Parse(rendered, ns)
+	if err != nil {
+		return err
+	}
+
+	others, hooks := manifest.SplitHooks(resources)
+	others = manifest.SortByKind(others, manifest.InstallOrder)
+
+	storage, err := r.releaseTool(o.TillerNamespace, o.TillerStorageBackend)
+	if err != nil {
+		return err
+	}
+
+	previous, err := storage.GetDeployedRelease(release)
+	if releasetool.IsNotDeployed(err) {
+		previous = nil
+	} else if err != nil {
+		return err
+	}
+
+	if previous == nil && !o.Install {
+		return fmt.Errorf("release %s has not been deployed yet. specify --install to install it", release)
+	}
+
+	// The descriptions are the same as Tiller's
+	preEvent, postEvent, pending, description := "pre-install", "post-install", rspb.Status_PENDING_INSTALL, "Install complete"
+	pendingDescription := "Initial install underway"
+	if previous != nil {
+		preEvent, postEvent, pending, description = "pre-upgrade", "post-upgrade", rspb.Status_PENDING_UPGRADE, "Upgrade complete"
+		pendingDescription = "Preparing upgrade"
+	}
+
+	chartName, chartVersion, err := chartMetadata(chart)
+	if err != nil {
+		return err
+	}
+
+	rel, err := releasetool.NewRelease(chartName, chartVersion, release, ns, rendered, description)
+	if err != nil {
+		return err
+	}
+
+	if o.DryRun {
+		fmt.Fprintf(out, "the following resources would be applied to release %s:\n", release)
+		for _, res := range others {
+			fmt.Fprintf(out, "  %s\n", res)
+		}
+		return nil
+	}
+
+	seconds, err := strconv.Atoi(o.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout \"%s\": must be a number of seconds: %v", o.Timeout, err)
+	}
+
+	waitOpts := WaitOpts{Namespace: ns, Timeout: time.Duration(seconds) * time.Second, Out: out}
+
+	// Like Tiller, the revision is recorded as pending before anything is applied, and then marked as deployed or
+	// failed, so that `helm ls` and the next upgrade see the outcome
+	rel.Info.Status.Code = pending
+	rel.Info.Description = pendingDescription
+
+	if err := r.writeRelease(storage, rel, o); err != nil {
+		return err
+	}
+
+	deploy := func() error {
+		if err := r.runHooks(hooks, preEvent, ns, o, waitOpts); err != nil {
+			return err
+		}
+
+		if err := r.applyResources(ns, others, o); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "applied %d resource(s) to release %s\n", len(others), release)
+
+		if err := r.runHooks(hooks, postEvent, ns, o, waitOpts); err != nil {
+			return err
+		}
+
+		if o.Wait {
+			return r.waitForResources(others, waitOpts)
+		}
+
+		return nil
+	}
+
+	if err := deploy(); err != nil {
+		rel.Info.Status.Code = rspb.Status_FAILED
+		rel.Info.Description = fmt.Sprintf("Release %q failed: %v", release, err)
+
+		if updateErr := r.updateRelease(rel, o); updateErr != nil {
+			return fmt.Errorf("%v\nunable to mark revision %d of release %s as failed: %v", err, rel.Version, release, updateErr)
+		}
+
+		return err
+	}
+
+	rel.Info.Status.Code = rspb.Status_DEPLOYED
+	rel.Info.Description = description
+
+	if err := r.updateRelease(rel, o); err != nil {
+		return err
+	}
+
+	if previous != nil {
+		if err := storage.Supersede(previous); err != nil {
+			return err
+		}
+
+		if err := r.prune(previous, others, out); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(out, "release %s has been deployed as revision %d\n", release, rel.Version)
+
+	return nil
+}
+
+// chartMetadata returns the name and the version of the chart in the directory
+func chartMetadata(dir string) (string, string, error) {
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if err != nil {
+		return "", "", err
+	}
+
+	var c struct {
+		Name    string `yaml:"name"`
+		Version string `yaml:"version"`
+	}
+
+	if err := yaml.Unmarshal(bs, &c); err != nil {
+		return "", "", fmt.Errorf("unable to parse %s/Chart.yaml: %v", dir, err)
+	}
+
+	return c.Name, c.Version, nil
+}
+
+// applyResources applies the resources with server-side apply if enabled, or client-side `kubectl apply` otherwise
+func (r *Runner) applyResources(ns string, resources []*manifest.Resource, o UpgradeOpts) error {
+	if o.ServerSide {
+		return r.serverSideApply(ns, resources, o.ForceConflicts)
+	}
+	return r.kubectlApply(ns, resources)
+}
+
+// kubectlApply applies the resources in the order with `kubectl apply`
+func (r *Runner) kubectlApply(ns string, resources []*manifest.Resource) error {
+	if len(resources) == 0 {
+		return nil
+	}
+
+	var docs []string
+	for _, res := range resources {
+		y, err := res.Yaml()
+		if err != nil {
+			return err
+		}
+		docs = append(docs, y)
+	}
+
+	return r.kubectlApplyManifest(ns, strings.Join(docs, "---\n"))
+}
+
+func (r *Runner) kubectlApplyManifest(ns, m string) error {
+	f, err := ioutil.TempFile("", "helm-x-apply")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(m); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if out, err := r.Run("kubectl", "apply", "-n="+ns, "-f", f.Name()); err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+
+	return nil
+}
+
+// kubectlDelete deletes the resources, ignoring the ones that don't exist
+func (r *Runner) kubectlDelete(resources []*manifest.Resource) error {
+	var refs []ResourceRef
+	for _, res := range resources {
+		refs = append(refs, ResourceRef{Kind: kubectlType(res), Namespace: res.Namespace, Name: res.Name})
+	}
+
+	namespaces, groups := groupByNamespace(refs)
+
+	for _, ns := range namespaces {
+		args := []string{"delete", "--ignore-not-found"}
+		if ns != "" {
+			args = append(args, "-n="+ns)
+		}
+		args = append(args, groups[ns]...)
+
+		if out, err := r.Run("kubectl", args...); err != nil {
+			return fmt.Errorf("%v: %s", err, out)
+		}
+	}
+
+	return nil
+}
+
+// runHooks runs the hooks for the event in the order of their weights, like Tiller does.
+// Jobs are waited until they complete, and the hooks are deleted according to their delete policies
+func (r *Runner) runHooks(hooks []*manifest.Resource, event, ns string, upOpts UpgradeOpts, o WaitOpts) error {
+	var targets []*manifest.Resource
+	for _, h := range hooks {
+		for _, e := range h.HookEvents() {
+			if e == event {
+				targets = append(targets, h)
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(targets, func(i, j int) bool {
+		wi, _ := strconv.Atoi(targets[i].Annotation(hookWeightAnnotation))
+		wj, _ := strconv.Atoi(targets[j].Annotation(hookWeightAnnotation))
+		if wi != wj {
+			return wi < wj
+		}
+		return targets[i].Name < targets[j].Name
+	})
+
+	for _, h := range targets {
+		policies := map[string]bool{}
+		for _, p := range strings.Split(h.Annotation(hookDeletePolicyAnnotation), ",") {
+			policies[strings.TrimSpace(p)] = true
+		}
+
+		if policies[hookBeforeHookCreation] {
+			if err := r.kubectlDelete([]*manifest.Resource{h}); err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(o.Out, "running %s hook %s\n", event, resourceID(h))
+
+		err := r.applyResources(ns, []*manifest.Resource{h}, upOpts)
+		if err == nil {
+			err = r.waitForResources([]*manifest.Resource{h}, o)
+		}
+
+		if err != nil {
+			if policies[hookFailed] {
+				if delErr := r.kubectlDelete([]*manifest.Resource{h}); delErr != nil {
+					return fmt.Errorf("%s hook %s failed: %v\nunable to delete the hook: %v", event, resourceID(h), err, delErr)
+				}
+			}
+			return fmt.Errorf("%s hook %s failed: %v", event, resourceID(h), err)
+		}
+
+		if policies[hookSucceeded] {
+			if err := r.kubectlDelete([]*manifest.Resource{h}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeRelease writes the release record into the Tiller storage as the new revision of the release
+func (r *Runner) writeRelease(storage *releasetool.ReleaseTool, rel *rspb.Release, o UpgradeOpts) error {
+	if _, err := storage.BumpVersion(rel); err != nil {
+		return err
+	}
+
+	return r.updateRelease(rel, o)
+}
+
+// updateRelease writes the revision of the release into the Tiller storage as it is, as a ConfigMap or a Secret
+// depending on the backend. It is used to update the status of the revision written by writeRelease
+func (r *Runner) updateRelease(rel *rspb.Release, o UpgradeOpts) error {
+	toObject := releasetool.ConfigMapOf
+	if o.TillerStorageBackend == "secrets" {
+		toObject = releasetool.SecretOf
+	}
+
+	obj, err := toObject(rel, o.TillerNamespace)
+	if err != nil {
+		return err
+	}
+
+	bs, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	return r.kubectlApplyManifest(o.TillerNamespace, string(bs))
+}
+
+// prune deletes the resources in the previous revision of the release that no longer exist in the current one
+func (r *Runner) prune(previous *rspb.Release, current []*manifest.Resource, out io.Writer) error {
+	old, err := manifest.Parse(previous.Manifest, previous.Namespace)
+	if err != nil {
+		return err
+	}
+
+	exists := map[string]bool{}
+	for _, res := range current {
+		exists[resourceKey(res)] = true
+	}
+
+	var removed []*manifest.Resource
+	for _, res := range old {
+		if !exists[resourceKey(res)] {
+			removed = append(removed, res)
+		}
+	}
+
+	if len(removed) == 0 {
+		return nil
+	}
+
+	removed = manifest.SortByKind(removed, manifest.UninstallOrder)
+
+	if err := r.kubectlDelete(removed); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "pruned %d resource(s) removed since revision %d:\n", len(removed), previous.Version)
+	for _, res := range removed {
+		fmt.Fprintf(out, "  %s\n", res)
+	}
+
+	return nil
+}
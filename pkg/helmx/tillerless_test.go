@@ -0,0 +1,128 @@
+package helmx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mumoshu/helm-x/pkg/releasetool"
+	"github.com/variantdev/chartify"
+)
+
+func TestTillerlessUpgradeRecordsStatus(t *testing.T) {
+	helm, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer stubKubectl(t)()
+
+	chart, err := ioutil.TempDir("", "helmx-tillerless-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(chart)
+
+	if err := ioutil.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte("name: myapp\nversion: 0.1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const m = `---
+# Source: myapp/templates/cm.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myapp
+`
+
+	testcases := []struct {
+		applyErr error
+
+		err string
+
+		// statuses are the statuses of the release record in the order they are written
+		statuses []string
+	}{
+		{
+			statuses: []string{"1 PENDING_INSTALL", "1 DEPLOYED"},
+		},
+		{
+			applyErr: errors.New("exit status 1"),
+			err:      "exit status 1: ",
+			statuses: []string{"1 PENDING_INSTALL", "1 FAILED"},
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		var statuses []string
+
+		r := New(HelmBin(helm), UseHelm3(false), Commander(func(cmd string, args []string, stdout, stderr io.Writer, env map[string]string) error {
+			switch args[0] {
+			case "version":
+				// Helm 2 is detected by `helm version`
+				fmt.Fprint(stdout, "Client: v2.16.1")
+				return nil
+			case "template":
+				fmt.Fprint(stdout, m)
+				return nil
+			}
+
+			if cmd != "kubectl" || args[0] != "apply" {
+				return nil
+			}
+
+			bs, err := ioutil.ReadFile(args[len(args)-1])
+			if err != nil {
+				return err
+			}
+
+			var obj struct {
+				Metadata struct {
+					Labels map[string]string `json:"labels"`
+				} `json:"metadata"`
+			}
+
+			// Only the release record is written in JSON
+			if json.Unmarshal(bs, &obj) != nil || obj.Metadata.Labels["OWNER"] != "TILLER" {
+				return tc.applyErr
+			}
+
+			statuses = append(statuses, obj.Metadata.Labels["VERSION"]+" "+obj.Metadata.Labels["STATUS"])
+
+			return nil
+		}))
+
+		r.releaseStorage = releasetool.NewMemoryReleaseTool()
+
+		o := UpgradeOpts{
+			ChartifyOpts: &chartify.ChartifyOpts{Namespace: "prod"},
+			ClientOpts:   &ClientOpts{TillerStorageBackend: "configmaps"},
+			Install:      true,
+			Timeout:      "300",
+			Out:          ioutil.Discard,
+		}
+
+		err := r.tillerlessUpgrade("myapp", chart, o)
+
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+
+		if errMsg != tc.err {
+			t.Errorf("unexpected error for case %d: expected=%q, got=%q", i, tc.err, errMsg)
+		}
+
+		if !reflect.DeepEqual(statuses, tc.statuses) {
+			t.Errorf("unexpected statuses for case %d:\nexpected=%q\ngot=%q", i, tc.statuses, statuses)
+		}
+	}
+}
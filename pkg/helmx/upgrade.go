@@ -1,15 +1,20 @@
 package helmx
 
 import (
+	"errors"
 	"fmt"
 	"github.com/variantdev/chartify"
 	"github.com/mumoshu/helm-x/pkg/util"
 	"io"
+	"os"
+	"strconv"
+	"time"
 )
 
 type UpgradeOpts struct {
 	*chartify.ChartifyOpts
 	*ClientOpts
+	*ValidateOpts
 
 	Timeout string
 	Install bool
@@ -21,10 +26,79 @@ type UpgradeOpts struct {
 
 	Adopt []string
 
+	// Wait waits until all the workloads in the release get ready after the upgrade, for up to Timeout seconds
+	Wait bool
+
+	// Atomic rolls the release back to the previous deployed revision when the upgrade or the wait fails, or uninstalls
+	// it on the first install
+	Atomic bool
+
+	// Tillerless applies the resources with kubectl and writes the release record by itself, without Tiller.
+	// Supported only with Helm 2
+	Tillerless bool
+
+	// ServerSide applies the resources with server-side apply under the helm-x field manager, and then writes the release
+	// record like Tillerless does
+	ServerSide bool
+
+	// ForceConflicts makes server-side apply take over the fields owned by other field managers
+	ForceConflicts bool
+
+	// PolicyFile is the path to the policy to be checked against the rendered resources before the upgrade
+	PolicyFile string
+
+	// PinDigests is the path to the file mapping image tags to digests, which the rendered images are pinned to
+	PinDigests string
+
+	// AutoAdopt adopts existing resources that made the upgrade fail with "already exists" and retries the upgrade once
+	AutoAdopt bool
+
+	// Retries is the number of times `helm upgrade` is retried on transient failures like API timeouts
+	Retries int
+
+	// RetryBackoff is the wait before the first retry, doubled after each retry
+	RetryBackoff time.Duration
+
+	// WatchEvents prints the events of the resources in the release as they arrive during the upgrade and the wait,
+	// followed by the summary of the warning events
+	WatchEvents bool
+
+	// NoColor disables colorizing the events printed with WatchEvents
+	NoColor bool
+
+	// Notify is the options for notifying the outcome to webhooks. Used only by the command line
+	Notify *NotifyOpts
+
+	// Manifest is the manifest already rendered from the chart with the options. When set, it is used to know the
+	// resources in the release instead of rendering the chart again. Optional
+	Manifest string
+
 	Out io.Writer
 }
 
+// CheckOptions returns an error for the combination of the options that can't work together.
+//
+// Atomic can't be used with Tillerless or ServerSide, as the rollback relies on Tiller that those options avoid.
+// With Helm 3, Atomic can't be used with AutoAdopt either, as `helm uninstall` and `helm rollback` would delete or
+// revert the resources adopted into the release
+func (o *UpgradeOpts) CheckOptions(helm3 bool) error {
+	if o.Atomic && (o.Tillerless || o.ServerSide) {
+		return errors.New("--atomic can't be used with --tillerless or --server-side, as the rollback relies on tiller")
+	}
+	if o.Atomic && o.AutoAdopt && helm3 {
+		return errors.New("--atomic can't be used with --auto-adopt on helm 3, as the rollback would delete or revert the adopted resources")
+	}
+	return nil
+}
+
+// Upgrade runs `helm upgrade`, or applies the resources by itself with Tillerless or ServerSide, and waits for the
+// resources to be ready with Wait. The events are not watched here but by the caller with WatchEvents, as the upgrade
+// can be retried
 func (r *Runner) Upgrade(release, chart string, o UpgradeOpts) error {
+	if o.Tillerless || o.ServerSide {
+		return r.tillerlessUpgrade(release, chart, o)
+	}
+
 	var additionalFlags string
 	additionalFlags += util.CreateFlagChain("set", o.SetValues)
 	additionalFlags += util.CreateFlagChain("f", o.ValuesFiles)
@@ -61,12 +135,64 @@ func (r *Runner) Upgrade(release, chart string, o UpgradeOpts) error {
 		additionalFlags += util.CreateFlagChain("tls-key", []string{o.TLSKey})
 	}
 
+	out := o.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
 	command := fmt.Sprintf("%s upgrade %s %s%s", r.HelmBin(), release, chart, additionalFlags)
-	stdout, stderr, err := r.DeprecatedCaptureBytes(command)
-	if err != nil || len(stderr) != 0 {
-		return fmt.Errorf(string(stderr))
+	err := retry("helm upgrade", o.Retries, o.RetryBackoff, out, func() error {
+		stdout, stderr, err := r.DeprecatedCaptureBytes(command)
+		if err != nil {
+			if len(stderr) == 0 {
+				return err
+			}
+			return errors.New(string(stderr))
+		}
+		printWarnings(out, stderr)
+		fmt.Fprintln(out, string(stdout))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if o.Wait && !o.DryRun {
+		return r.waitForRelease(release, chart, o)
 	}
-	fmt.Println(string(stdout))
 
 	return nil
 }
+
+// manifestOf returns o.Manifest if set, or renders the chart otherwise
+func (r *Runner) manifestOf(release, chart string, o UpgradeOpts) (string, error) {
+	if o.Manifest != "" {
+		return o.Manifest, nil
+	}
+	return r.Template(release, chart, o.ChartifyOpts)
+}
+
+// waitForRelease waits for the resources in the release to be ready. The chart is rendered again to know the
+// resources unless o.Manifest is set
+func (r *Runner) waitForRelease(release, chart string, o UpgradeOpts) error {
+	m, err := r.manifestOf(release, chart, o)
+	if err != nil {
+		return err
+	}
+
+	seconds, err := strconv.Atoi(o.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout \"%s\": must be a number of seconds: %v", o.Timeout, err)
+	}
+
+	out := o.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	return r.WaitForReady(m, WaitOpts{
+		Namespace: o.Namespace,
+		Timeout:   time.Duration(seconds) * time.Second,
+		Out:       out,
+	})
+}
@@ -0,0 +1,76 @@
+package helmx
+
+import (
+	"github.com/variantdev/chartify"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+	"github.com/mumoshu/helm-x/pkg/validation"
+)
+
+// ValidateOpts configures the validation of the rendered resources against the OpenAPI schemas and the deprecated APIs
+type ValidateOpts struct {
+	// Validate checks the rendered resources against the OpenAPI schemas of KubeVersion and the CRDs
+	Validate bool
+
+	// KubeVersion is the target K8s version like `1.13`, which also enables the check of the deprecated APIs.
+	// Defaults to the version of the bundled schemas
+	KubeVersion string
+
+	// SchemaDir is the directory containing `<KubeVersion>/swagger.json` or `swagger.json`. The bundled schemas are used
+	// when omitted
+	SchemaDir string
+
+	// CRDDir is the directory containing the CRDs whose custom resources are rendered but the CRDs aren't
+	CRDDir string
+
+	// IgnoreMissingSchemas skips the resources of the kinds without schemas, instead of failing on them
+	IgnoreMissingSchemas bool
+
+	// ConvertDeprecatedAPIs rewrites the resources using the APIs deprecated or removed in KubeVersion to the supported
+	// API versions
+	ConvertDeprecatedAPIs bool
+}
+
+// ValidateRelease renders the chart and validates every rendered resource including hooks against the schemas.
+//
+// The schemas of the CRDs in the rendered resources and CRDDir are added to the ones of K8s, so that the custom
+// resources are validated, too. The returned error lists all the invalid resources along with their source templates.
+func (r *Runner) ValidateRelease(release, chart string, o *chartify.ChartifyOpts, v *ValidateOpts) error {
+	m, err := r.Template(release, chart, o)
+	if err != nil {
+		return err
+	}
+
+	return r.ValidateManifest(m, o.Namespace, v)
+}
+
+// ValidateManifest validates the resources in the manifest already rendered for the release like ValidateRelease does.
+// Resources without namespaces are validated as the ones in namespace, or "default" if empty
+func (r *Runner) ValidateManifest(m, namespace string, v *ValidateOpts) error {
+	schemas, err := validation.Load(v.SchemaDir, v.KubeVersion)
+	if err != nil {
+		return err
+	}
+
+	if v.CRDDir != "" {
+		if err := schemas.LoadCRDDir(v.CRDDir); err != nil {
+			return err
+		}
+	}
+
+	ns := namespace
+	if ns == "" {
+		ns = "default"
+	}
+
+	resources, err := manifest.Parse(m, ns)
+	if err != nil {
+		return err
+	}
+
+	if err := schemas.AddCRDs(resources); err != nil {
+		return err
+	}
+
+	return schemas.ValidateResources(resources, v.IgnoreMissingSchemas)
+}
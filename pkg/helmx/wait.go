@@ -0,0 +1,355 @@
+package helmx
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+// waitInterval is the interval between the polls of the statuses of the resources being waited
+const waitInterval = 2 * time.Second
+
+// WaitOpts is the options for WaitForReady
+type WaitOpts struct {
+	// Namespace is the namespace of the namespaced resources without `metadata.namespace`.
+	// The current namespace of the kubeconfig is used when empty
+	Namespace string
+
+	Timeout time.Duration
+
+	Out io.Writer
+}
+
+// readiness is the readiness of a resource at a point in time
+type readiness struct {
+	ready bool
+
+	// failed is true when the resource never gets ready, like a Job that has exceeded its backoff limit
+	failed bool
+
+	// message describes the progress, like "2 of 3 updated replicas are available"
+	message string
+}
+
+// WaitForReady waits until all the workloads in the manifest get ready, by polling their statuses with kubectl.
+//
+// Deployments, StatefulSets and DaemonSets are ready when their rollouts have completed, Jobs when they have completed,
+// PersistentVolumeClaims when they are bound, and LoadBalancer Services when their load balancers are provisioned.
+// A progress line is written to o.Out whenever the progress of a resource changes.
+// When the timeout is hit, the returned error names the resources that are not ready, with their last events.
+// A failed Job returns the error immediately, as it never gets ready.
+func (r *Runner) WaitForReady(m string, o WaitOpts) error {
+	resources, err := manifest.Parse(m, o.Namespace)
+	if err != nil {
+		return err
+	}
+
+	resources, _ = manifest.SplitHooks(resources)
+
+	return r.waitForResources(resources, o)
+}
+
+// waitForResources waits until all the trackable resources among the resources get ready
+func (r *Runner) waitForResources(resources []*manifest.Resource, o WaitOpts) error {
+	var targets []*manifest.Resource
+	for _, res := range resources {
+		if isTrackable(res) {
+			targets = append(targets, res)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(o.Out, "waiting for %d resource(s) to be ready\n", len(targets))
+
+	var refs []ResourceRef
+	for _, res := range targets {
+		refs = append(refs, ResourceRef{Kind: kubectlType(res), Namespace: res.Namespace, Name: res.Name})
+	}
+
+	last := map[string]readiness{}
+
+	deadline := time.Now().Add(o.Timeout)
+
+	for {
+		objs, err := r.getObjectsByRefs(refs, true)
+		if err != nil {
+			return err
+		}
+
+		live := map[string]map[string]interface{}{}
+		for _, obj := range objs {
+			live[objectKey(obj)] = obj
+		}
+
+		var pending []*manifest.Resource
+
+		for _, res := range targets {
+			key := resourceKey(res)
+
+			var rd readiness
+			if obj, ok := live[key]; ok {
+				rd = readinessOf(obj)
+			} else {
+				rd = readiness{message: "not found"}
+			}
+
+			if prev, ok := last[key]; !ok || prev != rd {
+				fmt.Fprintf(o.Out, "%s: %s\n", waitRef(res), rd.message)
+				last[key] = rd
+			}
+
+			if rd.failed {
+				return r.failedError(res, rd)
+			}
+
+			if !rd.ready {
+				pending = append(pending, res)
+			}
+		}
+
+		if len(pending) == 0 {
+			fmt.Fprintf(o.Out, "all %d resource(s) are ready\n", len(targets))
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return r.notReadyError(pending, last, o)
+		}
+
+		time.Sleep(waitInterval)
+	}
+}
+
+func isTrackable(res *manifest.Resource) bool {
+	switch res.Kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "Job", "PersistentVolumeClaim":
+		return true
+	case "Service":
+		spec, _ := res.Object["spec"].(map[string]interface{})
+		return spec["type"] == "LoadBalancer"
+	}
+	return false
+}
+
+// resourceID identifies the resource in progress lines and errors, like `Deployment/myapp`.
+// The namespace is omitted as kubectl may have resolved it from the kubeconfig
+func resourceID(res *manifest.Resource) string {
+	return fmt.Sprintf("%s/%s", res.Kind, res.Name)
+}
+
+// objectKey is resourceKey of the live object, so that the resources of the same kind and name in different
+// namespaces are tracked separately.
+// The namespace is empty for the objects fetched without `-n`, as fetchByRefs drops it
+func objectKey(obj map[string]interface{}) string {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	ns, _ := metadata["namespace"].(string)
+	return fmt.Sprintf("%s/%s/%s", obj["kind"], ns, metadata["name"])
+}
+
+// waitRef names the resource in progress lines and errors, like `default/Deployment/myapp`
+func waitRef(res *manifest.Resource) string {
+	return ResourceRef{Kind: res.Kind, Namespace: res.Namespace, Name: res.Name}.String()
+}
+
+// readinessOf determines the readiness of the resource from its status, in the same way as `kubectl rollout status`
+func readinessOf(obj map[string]interface{}) readiness {
+	generation := intField(obj, "metadata", "generation")
+	observed := intField(obj, "status", "observedGeneration")
+
+	switch obj["kind"] {
+	case "Deployment", "StatefulSet", "DaemonSet":
+		if observed < generation {
+			return readiness{message: "waiting for the spec update to be observed"}
+		}
+	}
+
+	switch obj["kind"] {
+	case "Deployment":
+		replicas := intFieldOr(obj, 1, "spec", "replicas")
+		updated := intField(obj, "status", "updatedReplicas")
+		current := intField(obj, "status", "replicas")
+		available := intField(obj, "status", "availableReplicas")
+
+		switch {
+		case updated < replicas:
+			return readiness{message: fmt.Sprintf("%d of %d replicas have been updated", updated, replicas)}
+		case current > updated:
+			return readiness{message: fmt.Sprintf("%d old replicas are pending termination", current-updated)}
+		case available < updated:
+			return readiness{message: fmt.Sprintf("%d of %d updated replicas are available", available, updated)}
+		}
+
+		return readiness{ready: true, message: fmt.Sprintf("%d of %d updated replicas are available", available, updated)}
+	case "StatefulSet":
+		replicas := intFieldOr(obj, 1, "spec", "replicas")
+		ready := intField(obj, "status", "readyReplicas")
+		updated := intField(obj, "status", "updatedReplicas")
+
+		strategy, _ := nestedField(obj, "spec", "updateStrategy", "type").(string)
+		partition := intField(obj, "spec", "updateStrategy", "rollingUpdate", "partition")
+
+		switch {
+		case ready < replicas:
+			return readiness{message: fmt.Sprintf("%d of %d replicas are ready", ready, replicas)}
+		case strategy != "OnDelete" && updated < replicas-partition:
+			return readiness{message: fmt.Sprintf("%d of %d replicas have been updated", updated, replicas-partition)}
+		case strategy != "OnDelete" && partition == 0 && nestedField(obj, "status", "currentRevision") != nestedField(obj, "status", "updateRevision"):
+			return readiness{message: "waiting for the rolling update to complete"}
+		}
+
+		return readiness{ready: true, message: fmt.Sprintf("%d of %d replicas are ready", ready, replicas)}
+	case "DaemonSet":
+		desired := intField(obj, "status", "desiredNumberScheduled")
+		updated := intField(obj, "status", "updatedNumberScheduled")
+		available := intField(obj, "status", "numberAvailable")
+
+		switch {
+		case updated < desired:
+			return readiness{message: fmt.Sprintf("%d of %d pods have been updated", updated, desired)}
+		case available < desired:
+			return readiness{message: fmt.Sprintf("%d of %d updated pods are available", available, desired)}
+		}
+
+		return readiness{ready: true, message: fmt.Sprintf("%d of %d updated pods are available", available, desired)}
+	case "Job":
+		completions := intFieldOr(obj, 1, "spec", "completions")
+		succeeded := intField(obj, "status", "succeeded")
+
+		conditions, _ := nestedField(obj, "status", "conditions").([]interface{})
+		for _, c := range conditions {
+			cond, _ := c.(map[string]interface{})
+			if cond["type"] == "Failed" && cond["status"] == "True" {
+				return readiness{failed: true, message: fmt.Sprintf("failed: %v", cond["message"])}
+			}
+		}
+
+		if succeeded < completions {
+			return readiness{message: fmt.Sprintf("%d of %d completions have succeeded", succeeded, completions)}
+		}
+
+		return readiness{ready: true, message: "completed"}
+	case "PersistentVolumeClaim":
+		phase, _ := nestedField(obj, "status", "phase").(string)
+		if phase != "Bound" {
+			return readiness{message: fmt.Sprintf("waiting to be bound, currently %s", phase)}
+		}
+
+		return readiness{ready: true, message: "bound"}
+	case "Service":
+		ingress, _ := nestedField(obj, "status", "loadBalancer", "ingress").([]interface{})
+		if len(ingress) == 0 {
+			return readiness{message: "waiting for the load balancer to be provisioned"}
+		}
+
+		return readiness{ready: true, message: "load balancer has been provisioned"}
+	}
+
+	return readiness{ready: true, message: "ready"}
+}
+
+// notReadyError returns the error that names the resources that are not ready, with their last events
+func (r *Runner) notReadyError(pending []*manifest.Resource, last map[string]readiness, o WaitOpts) error {
+	var lines []string
+
+	for _, res := range pending {
+		lines = append(lines, fmt.Sprintf("  %s: %s", waitRef(res), last[resourceKey(res)].message))
+		lines = append(lines, r.eventLines(res)...)
+	}
+
+	return fmt.Errorf("timed out after %s waiting for %d resource(s) to be ready:\n%s", o.Timeout, len(pending), strings.Join(lines, "\n"))
+}
+
+// failedError returns the error for the resource that never gets ready, with its last events
+func (r *Runner) failedError(res *manifest.Resource, rd readiness) error {
+	lines := append([]string{fmt.Sprintf("%s %s", waitRef(res), rd.message)}, r.eventLines(res)...)
+
+	return fmt.Errorf("%s", strings.Join(lines, "\n"))
+}
+
+// eventLines returns the last events of the resource indented for the errors
+func (r *Runner) eventLines(res *manifest.Resource) []string {
+	events, err := r.lastEvents(res, 3)
+	if err != nil {
+		return []string{fmt.Sprintf("    (unable to get events: %v)", err)}
+	}
+
+	var lines []string
+	for _, e := range events {
+		lines = append(lines, "    "+e)
+	}
+
+	return lines
+}
+
+// lastEvents returns the last n events of the resource, formatted like `Warning FailedScheduling: 0/3 nodes are available`
+func (r *Runner) lastEvents(res *manifest.Resource, n int) ([]string, error) {
+	selector := fmt.Sprintf("--field-selector=involvedObject.kind=%s,involvedObject.name=%s", res.Kind, res.Name)
+
+	events, err := r.getObjects(res.Namespace, []string{"events", selector}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTimestamp(events[i]) < eventTimestamp(events[j])
+	})
+
+	if len(events) > n {
+		events = events[len(events)-n:]
+	}
+
+	var result []string
+	for _, e := range events {
+		result = append(result, fmt.Sprintf("%v %v: %v", e["type"], e["reason"], strings.TrimSpace(fmt.Sprint(e["message"]))))
+	}
+
+	return result, nil
+}
+
+func eventTimestamp(e map[string]interface{}) string {
+	for _, f := range []string{"lastTimestamp", "eventTime", "firstTimestamp"} {
+		if ts, ok := e[f].(string); ok && ts != "" {
+			return ts
+		}
+	}
+	metadata, _ := e["metadata"].(map[string]interface{})
+	ts, _ := metadata["creationTimestamp"].(string)
+	return ts
+}
+
+func nestedField(obj map[string]interface{}, path ...string) interface{} {
+	var v interface{} = obj
+	for _, p := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[p]
+	}
+	return v
+}
+
+func intField(obj map[string]interface{}, path ...string) int64 {
+	return intFieldOr(obj, 0, path...)
+}
+
+func intFieldOr(obj map[string]interface{}, def int64, path ...string) int64 {
+	switch v := nestedField(obj, path...).(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case uint64:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	return def
+}
@@ -0,0 +1,124 @@
+package helmx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubKubectl puts a no-op kubectl in PATH, as kubectl is looked up in PATH before the commander is called.
+// The returned func restores PATH
+func stubKubectl(t *testing.T) func() {
+	bin, err := ioutil.TempDir("", "helmx-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(bin, "kubectl"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		os.RemoveAll(bin)
+		t.Fatal(err)
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+path)
+
+	return func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(bin)
+	}
+}
+
+func TestWaitForReady(t *testing.T) {
+	defer stubKubectl(t)()
+
+	const m = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: a
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: b
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  namespace: a
+`
+
+	const (
+		ready    = `{"kind": "Deployment", "metadata": {"name": "app", "namespace": "%s"}, "spec": {"replicas": 1}, "status": {"replicas": 1, "updatedReplicas": 1, "availableReplicas": 1}}`
+		notReady = `{"kind": "Deployment", "metadata": {"name": "app", "namespace": "%s"}, "spec": {"replicas": 1}, "status": {"replicas": 1, "updatedReplicas": 1, "availableReplicas": 0}}`
+		running  = `{"kind": "Job", "metadata": {"name": "migrate", "namespace": "a"}, "status": {"active": 1}}`
+		failed   = `{"kind": "Job", "metadata": {"name": "migrate", "namespace": "a"}, "status": {"conditions": [{"type": "Failed", "status": "True", "message": "Job has reached the specified backoff limit"}]}}`
+	)
+
+	testcases := []struct {
+		// objects is the JSON of the live objects in each namespace
+		objects map[string][]string
+
+		err string
+	}{
+		{
+			// The ready Deployment in the namespace a must not be mistaken for the one in the namespace b
+			objects: map[string][]string{
+				"a": {fmt.Sprintf(ready, "a"), running},
+				"b": {fmt.Sprintf(notReady, "b")},
+			},
+			err: `timed out after 0s waiting for 2 resource(s) to be ready:
+  b/Deployment/app: 0 of 1 updated replicas are available
+  a/Job/migrate: 0 of 1 completions have succeeded`,
+		},
+		{
+			objects: map[string][]string{
+				"a": {fmt.Sprintf(notReady, "a"), failed},
+				"b": {fmt.Sprintf(ready, "b")},
+			},
+			err: `a/Job/migrate failed: Job has reached the specified backoff limit`,
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		r := New(Commander(func(cmd string, args []string, stdout, stderr io.Writer, env map[string]string) error {
+			var ns string
+			for _, a := range args {
+				if strings.HasPrefix(a, "-n=") {
+					ns = strings.TrimPrefix(a, "-n=")
+				}
+			}
+
+			var items []string
+			if args[len(args)-2] != "events" {
+				items = tc.objects[ns]
+			}
+
+			fmt.Fprintf(stdout, `{"kind": "List", "items": [%s]}`, strings.Join(items, ","))
+
+			return nil
+		}))
+
+		out := &bytes.Buffer{}
+
+		err := r.WaitForReady(m, WaitOpts{Out: out})
+
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+
+		if errMsg != tc.err {
+			t.Errorf("unexpected error for case %d:\nexpected=%q\ngot=%q", i, tc.err, errMsg)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+// images lists the container images used by K8s resources, and pins them to digests for reproducible deployments.
+package images
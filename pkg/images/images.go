@@ -0,0 +1,86 @@
+package images
+
+import (
+	"strings"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+	"github.com/mumoshu/helm-x/pkg/policy"
+)
+
+// Image is a container image used by a container or an init container of a resource
+type Image struct {
+	// Image is the image reference as written in the manifest, like `nginx:1.17`
+	Image string `json:"image"`
+
+	// Repository is the fully-qualified repository of the image, like `docker.io/library/nginx`
+	Repository string `json:"repository"`
+
+	Tag    string `json:"tag,omitempty"`
+	Digest string `json:"digest,omitempty"`
+
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Container string `json:"container"`
+	Init      bool   `json:"init,omitempty"`
+
+	// Source is the path to the template file that rendered the resource
+	Source string `json:"source,omitempty"`
+}
+
+// Pinned returns true when the image is referenced by its digest
+func (i Image) Pinned() bool {
+	return i.Digest != ""
+}
+
+// List returns the images of all the containers and init containers of the resources, in the order of appearance
+func List(resources []*manifest.Resource) []Image {
+	var images []Image
+
+	for _, res := range resources {
+		inits := len(res.InitContainers())
+
+		for i, c := range res.Containers() {
+			ref, _ := c["image"].(string)
+			if ref == "" {
+				continue
+			}
+
+			name, _ := c["name"].(string)
+
+			images = append(images, Image{
+				Image:      ref,
+				Repository: policy.NormalizeImage(ref),
+				Tag:        policy.ImageTag(ref),
+				Digest:     Digest(ref),
+				Kind:       res.Kind,
+				Namespace:  res.Namespace,
+				Name:       res.Name,
+				Container:  name,
+				Init:       i < inits,
+				Source:     res.Source,
+			})
+		}
+	}
+
+	return images
+}
+
+// Unpinned returns the images that aren't referenced by digests
+func Unpinned(images []Image) []Image {
+	var unpinned []Image
+	for _, i := range images {
+		if !i.Pinned() {
+			unpinned = append(unpinned, i)
+		}
+	}
+	return unpinned
+}
+
+// Digest returns the digest of the image reference like `sha256:...`, or an empty string if the image has no digest
+func Digest(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	return ""
+}
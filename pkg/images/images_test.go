@@ -0,0 +1,137 @@
+package images
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+const testManifest = `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: gcr.io/myproject/init@sha256:0123
+      containers:
+      - name: app
+        image: nginx:1.17
+      - name: sidecar
+        image: envoyproxy/envoy
+---
+# Source: app/templates/cronjob.yaml
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: backup
+  namespace: default
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: backup
+            image: localhost:5000/backup:v1
+---
+# Source: app/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+`
+
+func TestList(t *testing.T) {
+	resources, err := manifest.Parse(testManifest, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for _, i := range List(resources) {
+		actual = append(actual, i.Kind+"/"+i.Name+" "+i.Container+" "+i.Repository+" "+i.Tag+" "+i.Digest)
+		if i.Init != (i.Container == "init") {
+			t.Errorf("unexpected init flag of container %s: %v", i.Container, i.Init)
+		}
+	}
+
+	expected := []string{
+		"Deployment/app init gcr.io/myproject/init  sha256:0123",
+		"Deployment/app app docker.io/library/nginx 1.17 ",
+		"Deployment/app sidecar docker.io/envoyproxy/envoy  ",
+		"CronJob/backup backup localhost:5000/backup v1 ",
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected images:\nexpected=%q\ngot=%q", expected, actual)
+	}
+
+	if unpinned := Unpinned(List(resources)); len(unpinned) != 3 {
+		t.Errorf("unexpected number of unpinned images: expected=3, got=%d", len(unpinned))
+	}
+}
+
+func TestPinManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-x-images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "digests.yaml")
+	content := `digests:
+  docker.io/library/nginx:1.17: sha256:aaaa
+  envoyproxy/envoy:latest: envoyproxy/envoy@sha256:bbbb
+  localhost:5000/backup:v2: sha256:cccc
+`
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	digests, err := LoadDigests(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinned, pinnings, err := PinManifest(testManifest, digests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for _, p := range pinnings {
+		actual = append(actual, p.String())
+	}
+
+	expected := []string{
+		"pinned nginx:1.17 in Deployment/app container app to nginx@sha256:aaaa",
+		"pinned envoyproxy/envoy in Deployment/app container sidecar to envoyproxy/envoy@sha256:bbbb",
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected pinnings:\nexpected=%q\ngot=%q", expected, actual)
+	}
+
+	resources, err := manifest.Parse(pinned, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if unpinned := Unpinned(List(resources)); len(unpinned) != 1 || unpinned[0].Image != "localhost:5000/backup:v1" {
+		t.Errorf("unexpected unpinned images after pinning: %+v", unpinned)
+	}
+
+	if m, _, err := PinManifest(testManifest, Digests{}); err != nil || m != testManifest {
+		t.Errorf("unexpected result for the empty digests: %v", err)
+	}
+}
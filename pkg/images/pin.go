@@ -0,0 +1,139 @@
+package images
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+	"github.com/mumoshu/helm-x/pkg/policy"
+)
+
+// Digests maps images in the form of `REPOSITORY:TAG` to their digests
+type Digests map[string]string
+
+// LoadDigests loads the mapping of images to digests from the YAML file like:
+//
+//	digests:
+//	  nginx:1.17: sha256:...
+//	  gcr.io/myproject/app:1.0: gcr.io/myproject/app@sha256:...
+//
+// The images are matched after normalization, so that `nginx:1.17` matches `docker.io/library/nginx:1.17`, too.
+// Images without tags are treated as `latest`. Values can be either digests or image references with digests.
+func LoadDigests(file string) (Digests, error) {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var f struct {
+		Digests map[string]string `yaml:"digests"`
+	}
+
+	if err := yaml.Unmarshal(bs, &f); err != nil {
+		return nil, fmt.Errorf("unable to parse digests file %s: %v", file, err)
+	}
+
+	digests := Digests{}
+
+	for image, d := range f.Digests {
+		if strings.Contains(image, "@") {
+			return nil, fmt.Errorf("invalid digests file %s: %s is already pinned to a digest", file, image)
+		}
+
+		if ref := Digest(d); ref != "" {
+			d = ref
+		}
+
+		if !strings.Contains(d, ":") {
+			return nil, fmt.Errorf("invalid digests file %s: %q for %s isn't a digest like sha256:...", file, d, image)
+		}
+
+		digests[key(image)] = d
+	}
+
+	return digests, nil
+}
+
+// Lookup returns the digest of the image, or false when the image isn't in the mapping or already pinned to a digest
+func (d Digests) Lookup(image string) (string, bool) {
+	if Digest(image) != "" {
+		return "", false
+	}
+	digest, ok := d[key(image)]
+	return digest, ok
+}
+
+func key(image string) string {
+	tag := policy.ImageTag(image)
+	if tag == "" {
+		tag = "latest"
+	}
+	return policy.NormalizeImage(image) + ":" + tag
+}
+
+// Pinning is a change made by Pin
+type Pinning struct {
+	Resource  *manifest.Resource
+	Container string
+	From, To  string
+}
+
+func (p Pinning) String() string {
+	return fmt.Sprintf("pinned %s in %s/%s container %s to %s", p.From, p.Resource.Kind, p.Resource.Name, p.Container, p.To)
+}
+
+// Pin rewrites the tags of the container images in the resources to the digests found in the mapping, like
+// `nginx:1.17` to `nginx@sha256:...`. The images missing in the mapping are left as-is.
+func Pin(resources []*manifest.Resource, digests Digests) []Pinning {
+	var pinnings []Pinning
+
+	for _, res := range resources {
+		for _, c := range res.Containers() {
+			image, _ := c["image"].(string)
+
+			digest, ok := digests.Lookup(image)
+			if !ok {
+				continue
+			}
+
+			repo := image
+			if tag := policy.ImageTag(image); tag != "" {
+				repo = strings.TrimSuffix(image, ":"+tag)
+			}
+
+			pinned := repo + "@" + digest
+
+			c["image"] = pinned
+
+			name, _ := c["name"].(string)
+
+			pinnings = append(pinnings, Pinning{Resource: res, Container: name, From: image, To: pinned})
+		}
+	}
+
+	return pinnings
+}
+
+// PinManifest pins the images in the multi-document manifest with Pin, and returns the resulting manifest along with
+// the changes made. The manifest is returned as-is when nothing is pinned.
+func PinManifest(m string, digests Digests) (string, []Pinning, error) {
+	resources, err := manifest.Parse(m, "")
+	if err != nil {
+		return "", nil, err
+	}
+
+	pinnings := Pin(resources, digests)
+	if len(pinnings) == 0 {
+		return m, nil, nil
+	}
+
+	pinned, err := manifest.Join(resources)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return pinned, pinnings, nil
+}
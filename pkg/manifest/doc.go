@@ -0,0 +1,2 @@
+// manifest parses K8s manifests rendered by `helm template` into resources, so that they can be inspected and compared one by one.
+package manifest
@@ -0,0 +1,252 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Resource is a K8s resource contained in a multi-document manifest
+type Resource struct {
+	// Source is the path to the template file that rendered the resource, taken from the `# Source:` comment
+	Source string
+
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+
+	Object map[string]interface{}
+}
+
+// Key uniquely identifies the resource within a release
+func (r *Resource) Key() string {
+	return fmt.Sprintf("%s/%s/%s/%s", r.APIVersion, r.Kind, r.Namespace, r.Name)
+}
+
+// String returns the human-readable identifier of the resource, in the same format as helm-diff
+func (r *Resource) String() string {
+	return fmt.Sprintf("%s, %s, %s (%s)", r.Namespace, r.Name, r.Kind, r.APIVersion)
+}
+
+// Yaml returns the resource serialized in YAML with sorted keys
+func (r *Resource) Yaml() (string, error) {
+	return Marshal(r.Object)
+}
+
+// See https://github.com/helm/helm/blob/2b36b1ad46278380aa70b8c190c346ce50e8dc96/pkg/hooks/hooks.go#L27
+const hookAnnotation = "helm.sh/hook"
+
+var (
+	separatorPattern = regexp.MustCompile(`(?m)^---[ \t]*(#.*)?$`)
+	sourcePattern    = regexp.MustCompile(`(?m)^#\s*Source:\s*(.+?)\s*$`)
+)
+
+// Parse splits the manifest into resources.
+//
+// defaultNamespace is set to namespaced resources that have no `metadata.namespace`, so that the resources rendered by
+// `helm template` can be compared with the ones obtained from the cluster.
+// The custom resources of the cluster-scoped CustomResourceDefinitions in the manifest are treated as cluster-scoped,
+// even when the CRDs are yet to be installed.
+func Parse(manifest, defaultNamespace string) ([]*Resource, error) {
+	type document struct {
+		source string
+		obj    map[string]interface{}
+	}
+
+	var docs []document
+
+	for _, doc := range separatorPattern.Split(manifest, -1) {
+		var source string
+		if m := sourcePattern.FindStringSubmatch(doc); m != nil {
+			source = m[1]
+		}
+
+		obj := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return nil, fmt.Errorf("unable to parse manifest from %s: %v", sourceOrUnknown(source), err)
+		}
+
+		if len(obj) == 0 {
+			continue
+		}
+
+		if obj["kind"] == "CustomResourceDefinition" {
+			declareClusterScoped(obj)
+		}
+
+		docs = append(docs, document{source: source, obj: obj})
+	}
+
+	var resources []*Resource
+
+	for _, d := range docs {
+		res, err := newResource(d.source, d.obj, defaultNamespace)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, res)
+	}
+
+	return resources, nil
+}
+
+// FromObject turns the object obtained from the cluster or elsewhere into a resource
+func FromObject(obj map[string]interface{}, defaultNamespace string) (*Resource, error) {
+	return newResource("", obj, defaultNamespace)
+}
+
+func newResource(source string, obj map[string]interface{}, defaultNamespace string) (*Resource, error) {
+	res := &Resource{Source: source, Object: obj}
+
+	res.APIVersion, _ = obj["apiVersion"].(string)
+	res.Kind, _ = obj["kind"].(string)
+
+	if res.Kind == "" {
+		return nil, fmt.Errorf("unable to parse manifest from %s: missing kind", sourceOrUnknown(source))
+	}
+
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	res.Name, _ = metadata["name"].(string)
+	if res.Name == "" {
+		res.Name, _ = metadata["generateName"].(string)
+	}
+	res.Namespace, _ = metadata["namespace"].(string)
+
+	if IsClusterScoped(res.Kind) {
+		res.Namespace = ""
+	} else if res.Namespace == "" {
+		res.Namespace = defaultNamespace
+	}
+
+	return res, nil
+}
+
+func sourceOrUnknown(source string) string {
+	if source == "" {
+		return "unknown source"
+	}
+	return source
+}
+
+// Marshal serializes the object into YAML with sorted keys and 2-space indentation
+func Marshal(obj interface{}) (string, error) {
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(obj); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// IsHook returns true when the resource is a helm hook, annotated with `helm.sh/hook`
+func (r *Resource) IsHook() bool {
+	return r.Annotation(hookAnnotation) != ""
+}
+
+// HookEvents returns the events the hook is run on, like `pre-install` and `pre-upgrade`.
+// Empty when the resource isn't a hook
+func (r *Resource) HookEvents() []string {
+	var events []string
+	for _, e := range strings.Split(r.Annotation(hookAnnotation), ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Annotation returns the value of the annotation, or an empty string if the resource isn't annotated with it
+func (r *Resource) Annotation(name string) string {
+	metadata, _ := r.Object["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	v, _ := annotations[name].(string)
+	return v
+}
+
+// SplitHooks separates helm hooks from the other resources, like helm does before storing the release manifest
+func SplitHooks(resources []*Resource) ([]*Resource, []*Resource) {
+	var others, hooks []*Resource
+	for _, r := range resources {
+		if r.IsHook() {
+			hooks = append(hooks, r)
+		} else {
+			others = append(others, r)
+		}
+	}
+	return others, hooks
+}
+
+// Join serializes the resources back into a multi-document manifest, each preceded by its `# Source:` comment
+func Join(resources []*Resource) (string, error) {
+	buf := &strings.Builder{}
+
+	for _, res := range resources {
+		y, err := res.Yaml()
+		if err != nil {
+			return "", err
+		}
+
+		buf.WriteString("---\n")
+		if res.Source != "" {
+			fmt.Fprintf(buf, "# Source: %s\n", res.Source)
+		}
+		buf.WriteString(y)
+	}
+
+	return buf.String(), nil
+}
+
+// PodSpec returns the pod spec of the workload, or nil if the resource has no pod template
+func (r *Resource) PodSpec() map[string]interface{} {
+	path := []string{"spec", "template", "spec"}
+
+	switch r.Kind {
+	case "Pod":
+		path = []string{"spec"}
+	case "CronJob":
+		path = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	}
+
+	cur := r.Object
+	for _, f := range path {
+		next, ok := cur[f].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = next
+	}
+
+	return cur
+}
+
+// InitContainers returns the init containers of the workload
+func (r *Resource) InitContainers() []map[string]interface{} {
+	return r.podSpecItems("initContainers")
+}
+
+// Containers returns both the init containers and the containers of the workload
+func (r *Resource) Containers() []map[string]interface{} {
+	return append(r.InitContainers(), r.podSpecItems("containers")...)
+}
+
+func (r *Resource) podSpecItems(key string) []map[string]interface{} {
+	spec := r.PodSpec()
+	if spec == nil {
+		return nil
+	}
+
+	var cs []map[string]interface{}
+	items, _ := spec[key].([]interface{})
+	for _, item := range items {
+		if c, ok := item.(map[string]interface{}); ok {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
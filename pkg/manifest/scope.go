@@ -0,0 +1,119 @@
+package manifest
+
+import (
+	"strings"
+	"sync"
+)
+
+// clusterScopedKinds are kinds, resource names and short names of the well-known cluster-scoped resources.
+// They are the fallback for when the cluster can't tell the scopes, like when it is unreachable
+var clusterScopedKinds = map[string]struct{}{}
+
+func init() {
+	for _, k := range []string{
+		"namespace", "namespaces", "ns",
+		"node", "nodes", "no",
+		"persistentvolume", "persistentvolumes", "pv",
+		"storageclass", "storageclasses", "sc",
+		"priorityclass", "priorityclasses", "pc",
+		"runtimeclass", "runtimeclasses",
+		"clusterrole", "clusterroles",
+		"clusterrolebinding", "clusterrolebindings",
+		"customresourcedefinition", "customresourcedefinitions", "crd", "crds",
+		"apiservice", "apiservices",
+		"mutatingwebhookconfiguration", "mutatingwebhookconfigurations",
+		"validatingwebhookconfiguration", "validatingwebhookconfigurations",
+		"podsecuritypolicy", "podsecuritypolicies", "psp",
+		"certificatesigningrequest", "certificatesigningrequests", "csr",
+		"csidriver", "csidrivers",
+		"csinode", "csinodes",
+		"volumeattachment", "volumeattachments",
+	} {
+		clusterScopedKinds[k] = struct{}{}
+	}
+}
+
+var (
+	scopeMu sync.Mutex
+
+	// scopeResolver returns the kinds, resource names and short names of the cluster-scoped resources served by the
+	// cluster, including the custom resources like `ClusterIssuer`
+	scopeResolver func() ([]string, error)
+
+	// resolved caches the result of scopeResolver for the rest of the run
+	resolved map[string]struct{}
+
+	// declared are the cluster-scoped kinds declared by the CustomResourceDefinitions parsed so far, so that the custom
+	// resources installed along with their CRDs are recognized before the CRDs exist in the cluster
+	declared = map[string]struct{}{}
+)
+
+// SetScopeResolver sets the func that asks the cluster for the cluster-scoped kinds, like
+// `kubectl api-resources --namespaced=false`.
+// It is called once on the first call to IsClusterScoped, and the result is cached for the rest of the run.
+// The well-known cluster-scoped kinds are used alone when it fails.
+func SetScopeResolver(f func() ([]string, error)) {
+	scopeMu.Lock()
+	defer scopeMu.Unlock()
+
+	scopeResolver = f
+	resolved = nil
+}
+
+// IsClusterScoped returns true when the kind is cluster-scoped, according to the cluster, the CRDs parsed so far
+// and the well-known cluster-scoped kinds.
+// The kind can be given as a Kind like `ClusterRole`, a resource name like `clusterroles.rbac.authorization.k8s.io`
+// or a short name like `crd`.
+func IsClusterScoped(kind string) bool {
+	k := normalizeKind(kind)
+
+	scopeMu.Lock()
+	defer scopeMu.Unlock()
+
+	if resolved == nil && scopeResolver != nil {
+		resolved = map[string]struct{}{}
+
+		if kinds, err := scopeResolver(); err == nil {
+			for _, r := range kinds {
+				resolved[normalizeKind(r)] = struct{}{}
+			}
+		}
+	}
+
+	for _, kinds := range []map[string]struct{}{resolved, declared, clusterScopedKinds} {
+		if _, ok := kinds[k]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// declareClusterScoped records the kind, the resource names and the short names of the custom resources declared by
+// the CustomResourceDefinition when they are cluster-scoped
+func declareClusterScoped(crd map[string]interface{}) {
+	spec, _ := crd["spec"].(map[string]interface{})
+	if scope, _ := spec["scope"].(string); scope != "Cluster" {
+		return
+	}
+
+	names, _ := spec["names"].(map[string]interface{})
+
+	kinds := []interface{}{names["kind"], names["plural"], names["singular"]}
+	if shortNames, ok := names["shortNames"].([]interface{}); ok {
+		kinds = append(kinds, shortNames...)
+	}
+
+	scopeMu.Lock()
+	defer scopeMu.Unlock()
+
+	for _, k := range kinds {
+		if s, ok := k.(string); ok && s != "" {
+			declared[normalizeKind(s)] = struct{}{}
+		}
+	}
+}
+
+func normalizeKind(kind string) string {
+	return strings.ToLower(strings.SplitN(kind, ".", 2)[0])
+}
@@ -0,0 +1,2 @@
+// notify sends the outcomes of the operations on helm releases, like `helm x apply`, to webhooks and Slack channels.
+package notify
@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mumoshu/helm-x/pkg/diff"
+)
+
+// Commands whose outcomes are notified
+const (
+	CommandApply    = "apply"
+	CommandDiff     = "diff"
+	CommandRollback = "rollback"
+)
+
+// Statuses of the outcomes
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Notification is the outcome of a command run on a release, sent as the JSON payload of the generic webhooks
+type Notification struct {
+	// Command is one of `apply`, `diff` and `rollback`
+	Command string `json:"command"`
+
+	Release     string `json:"release"`
+	Namespace   string `json:"namespace,omitempty"`
+	KubeContext string `json:"kubeContext,omitempty"`
+
+	// Source is the directory, the chart or the plan the release is rendered from
+	Source       string `json:"source,omitempty"`
+	ChartVersion string `json:"chartVersion,omitempty"`
+
+	// User is the local user who ran the command
+	User string `json:"user,omitempty"`
+
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Diff is the number of the resources added, changed and removed by the command. Omitted when it couldn't be
+	// computed, like when the cluster is unreachable
+	Diff *diff.Summary `json:"diff,omitempty"`
+
+	// Status is either `succeeded` or `failed`
+	Status string `json:"status"`
+
+	// Error is the error message of the failure
+	Error string `json:"error,omitempty"`
+
+	StartedAt time.Time `json:"startedAt"`
+
+	// Duration is the time taken by the command like `1m2.5s`
+	Duration string `json:"duration"`
+
+	// DurationSeconds is Duration in seconds, for the receivers aggregating them
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// New returns the notification of the command on the release started now
+func New(command, release string) *Notification {
+	return &Notification{
+		Command:   command,
+		Release:   release,
+		User:      currentUser(),
+		StartedAt: time.Now(),
+	}
+}
+
+// Complete sets the status and the duration of the command, which failed when err is not nil
+func (n *Notification) Complete(err error) {
+	d := time.Since(n.StartedAt)
+
+	n.Duration = d.Round(time.Millisecond).String()
+	n.DurationSeconds = d.Seconds()
+
+	if err != nil {
+		n.Status = StatusFailed
+		n.Error = err.Error()
+	} else {
+		n.Status = StatusSucceeded
+	}
+}
+
+// Title is the one-line summary of the notification like `helm x apply of release app in namespace prod succeeded`
+func (n *Notification) Title() string {
+	var target []string
+
+	target = append(target, "release "+n.Release)
+	if n.Namespace != "" {
+		target = append(target, "in namespace "+n.Namespace)
+	}
+	if n.KubeContext != "" {
+		target = append(target, "on "+n.KubeContext)
+	}
+
+	var dryRun string
+	if n.DryRun {
+		dryRun = " (dry-run)"
+	}
+
+	title := fmt.Sprintf("helm x %s%s of %s %s", n.Command, dryRun, strings.Join(target, " "), n.Status)
+	if n.User != "" {
+		title += " by " + n.User
+	}
+
+	return title
+}
+
+// DiffSummary returns the diff in the form of `1 added, 2 changed, 0 removed`, or an empty string if it's unknown
+func (n *Notification) DiffSummary() string {
+	if n.Diff == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d added, %d changed, %d removed", n.Diff.Added, n.Diff.Changed, n.Diff.Removed)
+}
+
+func currentUser() string {
+	for _, v := range []string{"USER", "USERNAME"} {
+		if u := os.Getenv(v); u != "" {
+			return u
+		}
+	}
+	return ""
+}
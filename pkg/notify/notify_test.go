@@ -0,0 +1,215 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mumoshu/helm-x/pkg/diff"
+)
+
+type request struct {
+	header http.Header
+	body   map[string]interface{}
+}
+
+func newServer(t *testing.T, statuses ...int) (*httptest.Server, *[]request) {
+	var reqs []request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("unable to decode payload: %v", err)
+		}
+
+		reqs = append(reqs, request{header: r.Header, body: body})
+
+		status := http.StatusOK
+		if len(reqs) <= len(statuses) {
+			status = statuses[len(reqs)-1]
+		}
+		w.WriteHeader(status)
+	}))
+
+	return srv, &reqs
+}
+
+func TestNotify(t *testing.T) {
+	sleep = func(time.Duration) {}
+	defer func() { sleep = time.Sleep }()
+
+	webhook, webhookReqs := newServer(t, http.StatusServiceUnavailable)
+	defer webhook.Close()
+
+	slack, slackReqs := newServer(t)
+	defer slack.Close()
+
+	failures, failureReqs := newServer(t)
+	defer failures.Close()
+
+	notifier, err := NewNotifier(Config{
+		Retries: 1,
+		Sinks: []Sink{
+			{URL: webhook.URL, Headers: map[string]string{"Authorization": "Bearer token"}},
+			{Type: SinkSlack, URL: slack.URL, Commands: []string{CommandApply}},
+			{URL: failures.URL, Statuses: []string{StatusFailed}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := New(CommandApply, "app")
+	n.Namespace = "prod"
+	n.Source = "./chart"
+	n.ChartVersion = "1.2.3"
+	n.User = "alice"
+	n.Diff = &diff.Summary{Added: 1, Changed: 2}
+	n.Complete(errors.New("UPGRADE FAILED"))
+
+	if err := notifier.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*webhookReqs) != 2 {
+		t.Fatalf("expected the webhook to be retried once after 503, got %d request(s)", len(*webhookReqs))
+	}
+
+	req := (*webhookReqs)[1]
+	if h := req.header.Get("Authorization"); h != "Bearer token" {
+		t.Errorf("unexpected Authorization header: %q", h)
+	}
+
+	for k, v := range map[string]interface{}{
+		"command":      "apply",
+		"release":      "app",
+		"namespace":    "prod",
+		"source":       "./chart",
+		"chartVersion": "1.2.3",
+		"status":       "failed",
+		"error":        "UPGRADE FAILED",
+		"diff":         map[string]interface{}{"added": 1.0, "changed": 2.0, "removed": 0.0, "suppressed": 0.0},
+	} {
+		if actual, _ := json.Marshal(req.body[k]); string(actual) != mustMarshal(t, v) {
+			t.Errorf("unexpected %s in webhook payload: expected=%s, got=%s", k, mustMarshal(t, v), actual)
+		}
+	}
+
+	if _, ok := req.body["duration"].(string); !ok {
+		t.Errorf("missing duration in webhook payload: %v", req.body)
+	}
+
+	if len(*slackReqs) != 1 {
+		t.Fatalf("expected 1 slack request, got %d", len(*slackReqs))
+	}
+
+	expectedText := "helm x apply of release app in namespace prod failed by alice"
+	if text := (*slackReqs)[0].body["text"]; text != expectedText {
+		t.Errorf("unexpected slack text: expected=%q, got=%q", expectedText, text)
+	}
+
+	if len(*failureReqs) != 1 {
+		t.Errorf("expected the sink for failures to be notified, got %d request(s)", len(*failureReqs))
+	}
+
+	// Filtered out by commands and statuses
+	d := New(CommandDiff, "app")
+	d.Complete(nil)
+
+	if err := notifier.Notify(d); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*slackReqs) != 1 || len(*failureReqs) != 1 {
+		t.Errorf("unexpected notifications to the filtered sinks: slack=%d, failures=%d", len(*slackReqs), len(*failureReqs))
+	}
+}
+
+func TestNotifyFailure(t *testing.T) {
+	sleep = func(time.Duration) {}
+	defer func() { sleep = time.Sleep }()
+
+	srv, reqs := newServer(t, http.StatusBadRequest, http.StatusBadRequest)
+	defer srv.Close()
+
+	notifier, err := NewNotifier(Config{Retries: 3, Sinks: []Sink{{URL: srv.URL + "/secret/path"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := New(CommandApply, "app")
+	n.Complete(nil)
+
+	err = notifier.Notify(n)
+	if err == nil {
+		t.Fatal("expected error, got none")
+	}
+
+	if len(*reqs) != 1 {
+		t.Errorf("expected no retry on 400, got %d request(s)", len(*reqs))
+	}
+
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("the webhook path must be redacted from the error: %v", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("HELM_X_TEST_SLACK_URL", "https://hooks.slack.com/services/x")
+	defer os.Unsetenv("HELM_X_TEST_SLACK_URL")
+
+	file := filepath.Join(dir, "notify.yaml")
+	config := `timeout: 5s
+retries: 2
+sinks:
+- type: slack
+  url: $HELM_X_TEST_SLACK_URL
+  commands: [apply]
+- url: https://example.com/hook
+`
+	if err := ioutil.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Timeout != 5*time.Second || c.Retries != 2 || len(c.Sinks) != 2 {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+
+	if c.Sinks[0].URL != "https://hooks.slack.com/services/x" || c.Sinks[1].Type != SinkWebhook {
+		t.Errorf("unexpected sinks: %+v", c.Sinks)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("sinks:\n- type: email\n  url: https://example.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadConfig(file); err == nil {
+		t.Error("expected error for the unsupported sink type, got none")
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bs)
+}
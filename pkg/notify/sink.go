@@ -0,0 +1,276 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sink types
+const (
+	// SinkWebhook posts the notification as-is in JSON
+	SinkWebhook = "webhook"
+
+	// SinkSlack posts the message in the format of Slack incoming webhooks, which is supported by Mattermost and
+	// Rocket.Chat, too
+	SinkSlack = "slack"
+)
+
+// Sink is the destination of notifications
+type Sink struct {
+	// Type is either `webhook` or `slack`. Defaults to `webhook`
+	Type string `yaml:"type"`
+
+	URL string `yaml:"url"`
+
+	// Headers are added to the requests, like `Authorization`
+	Headers map[string]string `yaml:"headers"`
+
+	// Commands limits the commands notified to the sink, like `[apply, rollback]`. All the commands when empty
+	Commands []string `yaml:"commands"`
+
+	// Statuses limits the statuses notified to the sink, like `[failed]`. All the statuses when empty
+	Statuses []string `yaml:"statuses"`
+}
+
+func (s Sink) accepts(n *Notification) bool {
+	return (len(s.Commands) == 0 || contains(s.Commands, n.Command)) &&
+		(len(s.Statuses) == 0 || contains(s.Statuses, n.Status))
+}
+
+func (s Sink) payload(n *Notification) ([]byte, error) {
+	if s.Type == SinkSlack {
+		return json.Marshal(slackMessage(n))
+	}
+	return json.Marshal(n)
+}
+
+// Config is the set of the sinks and how notifications are sent to them
+type Config struct {
+	Sinks []Sink `yaml:"sinks"`
+
+	// Timeout is the timeout of each request. Defaults to 10s
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Retries is the number of times to retry the requests failed with network errors, 429 or 5xx responses
+	Retries int `yaml:"retries"`
+
+	// Backoff is the time to wait before the first retry, doubled after each retry. Defaults to 1s
+	Backoff time.Duration `yaml:"backoff"`
+}
+
+// LoadConfig loads the config from the YAML file like:
+//
+//	timeout: 5s
+//	retries: 3
+//	sinks:
+//	- type: slack
+//	  url: https://hooks.slack.com/services/...
+//	  commands: [apply, rollback]
+//	- url: https://example.com/deployments
+//	  headers:
+//	    Authorization: Bearer ...
+//	  statuses: [failed]
+//
+// Environment variables like `$SLACK_WEBHOOK_URL` in URLs and headers are expanded, to keep secrets out of the file.
+func LoadConfig(file string) (*Config, error) {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Config
+
+	if err := yaml.Unmarshal(bs, &c); err != nil {
+		return nil, fmt.Errorf("unable to parse notification config %s: %v", file, err)
+	}
+
+	for i := range c.Sinks {
+		s := &c.Sinks[i]
+
+		s.URL = expandEnv(s.URL)
+		for k, v := range s.Headers {
+			s.Headers[k] = expandEnv(v)
+		}
+
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("invalid notification config %s: sink %d: %v", file, i, err)
+		}
+	}
+
+	return &c, nil
+}
+
+func (s *Sink) validate() error {
+	if s.Type == "" {
+		s.Type = SinkWebhook
+	}
+
+	if s.Type != SinkWebhook && s.Type != SinkSlack {
+		return fmt.Errorf("unsupported type %q: must be either %s or %s", s.Type, SinkWebhook, SinkSlack)
+	}
+
+	if !strings.HasPrefix(s.URL, "http://") && !strings.HasPrefix(s.URL, "https://") {
+		return fmt.Errorf("url %q must start with http:// or https://", s.URL)
+	}
+
+	for _, c := range s.Commands {
+		if c != CommandApply && c != CommandDiff && c != CommandRollback {
+			return fmt.Errorf("unsupported command %q: must be one of %s, %s and %s", c, CommandApply, CommandDiff, CommandRollback)
+		}
+	}
+
+	for _, st := range s.Statuses {
+		if st != StatusSucceeded && st != StatusFailed {
+			return fmt.Errorf("unsupported status %q: must be either %s or %s", st, StatusSucceeded, StatusFailed)
+		}
+	}
+
+	return nil
+}
+
+// Notifier sends notifications to the sinks
+type Notifier struct {
+	Config
+
+	client *http.Client
+}
+
+// NewNotifier returns the notifier for the config
+func NewNotifier(c Config) (*Notifier, error) {
+	for i := range c.Sinks {
+		if err := c.Sinks[i].validate(); err != nil {
+			return nil, fmt.Errorf("invalid notification sink %d: %v", i, err)
+		}
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+
+	if c.Backoff == 0 {
+		c.Backoff = time.Second
+	}
+
+	return &Notifier{Config: c, client: &http.Client{Timeout: c.Timeout}}, nil
+}
+
+// sleep is replaced in tests
+var sleep = time.Sleep
+
+// Notify sends the notification to all the sinks accepting it, and returns the error describing the failed ones.
+// A failure of a sink doesn't prevent the others from being notified.
+func (n *Notifier) Notify(notification *Notification) error {
+	var errs []string
+
+	for _, s := range n.Sinks {
+		if !s.accepts(notification) {
+			continue
+		}
+
+		if err := n.send(s, notification); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s: %v", s.Type, redact(s.URL), err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to notify %d sink(s):\n%s", len(errs), strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
+
+func (n *Notifier) send(s Sink, notification *Notification) error {
+	body, err := s.payload(notification)
+	if err != nil {
+		return err
+	}
+
+	backoff := n.Backoff
+
+	for i := 0; ; i++ {
+		retryable, err := n.post(s, body)
+		if err == nil {
+			return nil
+		}
+
+		if !retryable || i >= n.Retries {
+			return err
+		}
+
+		sleep(backoff)
+
+		backoff *= 2
+	}
+}
+
+// post sends the payload, and returns true along with the error when the failure is worth retrying
+func (n *Notifier) post(s Sink, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "helm-x")
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		// Unwrapped to not leak the URL into the error message
+		if ue, ok := err.(*url.Error); ok {
+			err = ue.Err
+		}
+		return true, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		io.Copy(ioutil.Discard, res.Body)
+		return false, nil
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+
+	err = fmt.Errorf("unexpected response %s: %s", res.Status, strings.TrimSpace(string(msg)))
+
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500, err
+}
+
+// redact removes the path of the URL from error messages, as webhook URLs like Slack's contain secrets in the path
+func redact(u string) string {
+	i := strings.Index(u, "://")
+	if i < 0 {
+		return u
+	}
+
+	if j := strings.Index(u[i+3:], "/"); j >= 0 {
+		return u[:i+3+j] + "/..."
+	}
+
+	return u
+}
+
+func expandEnv(s string) string {
+	return strings.TrimSpace(os.ExpandEnv(s))
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package notify
+
+type slackPayload struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Text   string       `json:"text,omitempty"`
+	Fields []slackField `json:"fields"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// slackMessage formats the notification as the message of Slack incoming webhooks, with the details in the fields of
+// an attachment colored by the status
+func slackMessage(n *Notification) slackPayload {
+	color := "good"
+	if n.Status == StatusFailed {
+		color = "danger"
+	}
+
+	var fields []slackField
+
+	field := func(title, value string) {
+		if value != "" {
+			fields = append(fields, slackField{Title: title, Value: value, Short: true})
+		}
+	}
+
+	field("Release", n.Release)
+	field("Namespace", n.Namespace)
+	field("Source", n.Source)
+	field("Chart Version", n.ChartVersion)
+	field("Diff", n.DiffSummary())
+	field("Duration", n.Duration)
+
+	a := slackAttachment{Color: color, Fields: fields}
+	if n.Error != "" {
+		a.Text = "```\n" + n.Error + "\n```"
+	}
+
+	return slackPayload{Text: n.Title(), Attachments: []slackAttachment{a}}
+}
@@ -0,0 +1,2 @@
+// policy checks the rendered K8s manifests against the rules like "no privileged containers" before they are applied.
+package policy
@@ -0,0 +1,299 @@
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+const (
+	SeverityWarn = "warn"
+	SeverityDeny = "deny"
+)
+
+// ExemptAnnotation is the annotation to exempt the resource from the comma-separated list of the rules, or `*` for all
+const ExemptAnnotation = "helm-x/policy-exempt"
+
+// Rule enables one of the built-in rules with the severity
+type Rule struct {
+	// Name is the name of the built-in rule, like `no-privileged`
+	Name string `yaml:"name"`
+
+	// Severity is either `warn` to only report the violations, or `deny` to refuse applying them. Defaults to `deny`
+	Severity string `yaml:"severity"`
+
+	// Registries is the list of the registries, optionally followed by repository paths like `gcr.io/myproject`,
+	// that images can be pulled from. Used by `allowed-registries` only
+	Registries []string `yaml:"registries,omitempty"`
+}
+
+// Violation is a resource that violates a rule
+type Violation struct {
+	Rule     string
+	Severity string
+	Resource *manifest.Resource
+	Message  string
+}
+
+func (v Violation) String() string {
+	source := v.Resource.Source
+	if source == "" {
+		source = "unknown source"
+	}
+	return fmt.Sprintf("[%s] %s: %s/%s in %s: %s", v.Severity, v.Rule, v.Resource.Kind, v.Resource.Name, source, v.Message)
+}
+
+// Policy is the set of the rules to be evaluated against the rendered resources
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+type check func(res *manifest.Resource, rule Rule) []string
+
+var checks = map[string]check{
+	"no-privileged":           checkPrivileged,
+	"require-resource-limits": checkResourceLimits,
+	"no-host-path":            checkHostPath,
+	"allowed-registries":      checkRegistries,
+	"no-latest-tag":           checkLatestTag,
+}
+
+// RuleNames returns the names of the built-in rules
+func RuleNames() []string {
+	var names []string
+	for n := range checks {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load loads the policy from the YAML file like:
+//
+//	rules:
+//	- name: no-privileged
+//	  severity: deny
+//	- name: allowed-registries
+//	  severity: deny
+//	  registries:
+//	  - gcr.io/myproject
+//	- name: no-latest-tag
+//	  severity: warn
+func Load(file string) (*Policy, error) {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Policy{}
+	if err := yaml.Unmarshal(bs, p); err != nil {
+		return nil, fmt.Errorf("unable to parse policy from %s: %v", file, err)
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", file, err)
+	}
+
+	return p, nil
+}
+
+func (p *Policy) validate() error {
+	for i := range p.Rules {
+		r := &p.Rules[i]
+
+		if _, ok := checks[r.Name]; !ok {
+			return fmt.Errorf("unknown rule \"%s\": must be one of %s", r.Name, strings.Join(RuleNames(), ", "))
+		}
+
+		switch r.Severity {
+		case "":
+			r.Severity = SeverityDeny
+		case SeverityWarn, SeverityDeny:
+		default:
+			return fmt.Errorf("unsupported severity \"%s\" of rule %s: must be either %s or %s", r.Severity, r.Name, SeverityWarn, SeverityDeny)
+		}
+
+		if r.Name == "allowed-registries" && len(r.Registries) == 0 {
+			return fmt.Errorf("rule %s requires registries", r.Name)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate returns the violations of the rules by the resources, except the ones exempted by the annotation
+func (p *Policy) Evaluate(resources []*manifest.Resource) []Violation {
+	var violations []Violation
+
+	for _, res := range resources {
+		exempted := exemptions(res)
+
+		for _, rule := range p.Rules {
+			if exempted["*"] || exempted[rule.Name] {
+				continue
+			}
+
+			for _, msg := range checks[rule.Name](res, rule) {
+				violations = append(violations, Violation{Rule: rule.Name, Severity: rule.Severity, Resource: res, Message: msg})
+			}
+		}
+	}
+
+	return violations
+}
+
+// Denied returns the violations of the rules whose severity is `deny`
+func Denied(violations []Violation) []Violation {
+	var denied []Violation
+	for _, v := range violations {
+		if v.Severity == SeverityDeny {
+			denied = append(denied, v)
+		}
+	}
+	return denied
+}
+
+func exemptions(res *manifest.Resource) map[string]bool {
+	exempted := map[string]bool{}
+	for _, name := range strings.Split(res.Annotation(ExemptAnnotation), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			exempted[name] = true
+		}
+	}
+	return exempted
+}
+
+func checkPrivileged(res *manifest.Resource, _ Rule) []string {
+	var msgs []string
+	for _, c := range res.Containers() {
+		if privileged, _ := nested(c, "securityContext", "privileged").(bool); privileged {
+			msgs = append(msgs, fmt.Sprintf("container %s is privileged", c["name"]))
+		}
+	}
+	return msgs
+}
+
+func checkResourceLimits(res *manifest.Resource, _ Rule) []string {
+	var msgs []string
+	for _, c := range res.Containers() {
+		var missing []string
+		for _, r := range []string{"cpu", "memory"} {
+			if nested(c, "resources", "limits", r) == nil {
+				missing = append(missing, r)
+			}
+		}
+		if len(missing) > 0 {
+			msgs = append(msgs, fmt.Sprintf("container %s has no %s limit", c["name"], strings.Join(missing, " and ")))
+		}
+	}
+	return msgs
+}
+
+func checkHostPath(res *manifest.Resource, _ Rule) []string {
+	spec := res.PodSpec()
+	if spec == nil {
+		return nil
+	}
+
+	var msgs []string
+	volumes, _ := spec["volumes"].([]interface{})
+	for _, v := range volumes {
+		vol, _ := v.(map[string]interface{})
+		if path := nested(vol, "hostPath", "path"); path != nil {
+			msgs = append(msgs, fmt.Sprintf("volume %s mounts hostPath %v", vol["name"], path))
+		}
+	}
+	return msgs
+}
+
+func checkRegistries(res *manifest.Resource, rule Rule) []string {
+	var msgs []string
+	for _, c := range res.Containers() {
+		image, _ := c["image"].(string)
+		if image == "" {
+			continue
+		}
+
+		name := NormalizeImage(image)
+
+		var allowed bool
+		for _, r := range rule.Registries {
+			r = strings.TrimSuffix(r, "/")
+			if name == r || strings.HasPrefix(name, r+"/") {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			msgs = append(msgs, fmt.Sprintf("container %s uses image %s, which is not from any of the allowed registries %s", c["name"], image, strings.Join(rule.Registries, ", ")))
+		}
+	}
+	return msgs
+}
+
+func checkLatestTag(res *manifest.Resource, _ Rule) []string {
+	var msgs []string
+	for _, c := range res.Containers() {
+		image, _ := c["image"].(string)
+		if image == "" || strings.Contains(image, "@") {
+			continue
+		}
+
+		if tag := ImageTag(image); tag == "" || tag == "latest" {
+			msgs = append(msgs, fmt.Sprintf("container %s uses image %s without a fixed tag", c["name"], image))
+		}
+	}
+	return msgs
+}
+
+// NormalizeImage returns the fully-qualified repository of the image without the tag and the digest, like
+// `docker.io/library/nginx` for `nginx:1.17`
+func NormalizeImage(image string) string {
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+
+	items := strings.SplitN(name, "/", 2)
+	if len(items) == 1 {
+		return "docker.io/library/" + name
+	}
+
+	if first := items[0]; !strings.ContainsAny(first, ".:") && first != "localhost" {
+		return "docker.io/" + name
+	}
+
+	return name
+}
+
+// ImageTag returns the tag of the image, or an empty string if the image has no tag
+func ImageTag(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return ""
+}
+
+func nested(obj map[string]interface{}, fields ...string) interface{} {
+	var cur interface{} = obj
+	for _, f := range fields {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[f]
+	}
+	return cur
+}
@@ -0,0 +1,145 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+const testManifest = `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: gcr.io/myproject/init@sha256:0123
+        resources:
+          limits:
+            cpu: 100m
+            memory: 64Mi
+      containers:
+      - name: app
+        image: nginx
+        securityContext:
+          privileged: true
+        resources:
+          limits:
+            cpu: 100m
+      volumes:
+      - name: logs
+        hostPath:
+          path: /var/log
+---
+# Source: app/templates/agent.yaml
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+  annotations:
+    helm-x/policy-exempt: no-privileged, no-host-path
+spec:
+  template:
+    spec:
+      containers:
+      - name: agent
+        image: quay.io/org/agent:latest
+        securityContext:
+          privileged: true
+        resources:
+          limits:
+            cpu: 100m
+            memory: 64Mi
+      volumes:
+      - name: root
+        hostPath:
+          path: /
+---
+# Source: app/templates/job.yaml
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: cleanup
+  annotations:
+    helm-x/policy-exempt: "*"
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: cleanup
+            image: busybox
+`
+
+func TestEvaluate(t *testing.T) {
+	resources, err := manifest.Parse(testManifest, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Policy{Rules: []Rule{
+		{Name: "no-privileged"},
+		{Name: "require-resource-limits", Severity: SeverityWarn},
+		{Name: "no-host-path"},
+		{Name: "allowed-registries", Registries: []string{"gcr.io/myproject", "docker.io/library"}},
+		{Name: "no-latest-tag", Severity: SeverityWarn},
+	}}
+
+	if err := p.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for _, v := range p.Evaluate(resources) {
+		actual = append(actual, v.String())
+	}
+
+	expected := []string{
+		"[deny] no-privileged: Deployment/app in app/templates/deployment.yaml: container app is privileged",
+		"[warn] require-resource-limits: Deployment/app in app/templates/deployment.yaml: container app has no memory limit",
+		"[deny] no-host-path: Deployment/app in app/templates/deployment.yaml: volume logs mounts hostPath /var/log",
+		"[warn] no-latest-tag: Deployment/app in app/templates/deployment.yaml: container app uses image nginx without a fixed tag",
+		"[deny] allowed-registries: DaemonSet/agent in app/templates/agent.yaml: container agent uses image quay.io/org/agent:latest, which is not from any of the allowed registries gcr.io/myproject, docker.io/library",
+		"[warn] no-latest-tag: DaemonSet/agent in app/templates/agent.yaml: container agent uses image quay.io/org/agent:latest without a fixed tag",
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected violations:\nexpected=%v\ngot=%v", expected, actual)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testcases := []struct {
+		rule Rule
+		err  string
+	}{
+		{
+			rule: Rule{Name: "no-such-rule"},
+			err:  `unknown rule "no-such-rule": must be one of allowed-registries, no-host-path, no-latest-tag, no-privileged, require-resource-limits`,
+		},
+		{
+			rule: Rule{Name: "no-privileged", Severity: "error"},
+			err:  `unsupported severity "error" of rule no-privileged: must be either warn or deny`,
+		},
+		{
+			rule: Rule{Name: "allowed-registries"},
+			err:  `rule allowed-registries requires registries`,
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		p := &Policy{Rules: []Rule{tc.rule}}
+
+		if err := p.validate(); err == nil || err.Error() != tc.err {
+			t.Errorf("unexpected error for case %d: expected=%q, got=%v", i, tc.err, err)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package releasetool
 import (
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"github.com/golang/protobuf/ptypes/any"
 	"k8s.io/helm/pkg/proto/hapi/chart"
 	rspb "k8s.io/helm/pkg/proto/hapi/release"
@@ -16,10 +15,43 @@ import (
 type ReleaseManifest func(release *rspb.Release, tillerNs string) (interface{}, error)
 
 func TurnHelmTemplateToInstall(chartName, version, tillerNs, releaseName, ns, manifest string, releaseManifests ...ReleaseManifest) (string, error) {
-	man, hooks, err := SplitManifestAndHooks(manifest)
+	release, err := NewRelease(chartName, version, releaseName, ns, manifest, AdoptedDescription)
 	if err != nil {
 		return "", err
 	}
+
+	concatenated := release.Manifest
+
+	for _, m := range releaseManifests {
+		releaseObj, err := m(release, tillerNs)
+		if err != nil {
+			return "", err
+		}
+
+		/// Turn the release object into JSON, and then YAML
+
+		releaseJsonBytes, err := json.Marshal(releaseObj)
+		if err != nil {
+			return "", err
+		}
+
+		releaseYamlBytes, err := yaml.JSONToYAML(releaseJsonBytes)
+		if err != nil {
+			return "", err
+		}
+
+		concatenated = concatenated + "\n---\n" + string(releaseYamlBytes)
+	}
+
+	return concatenated, nil
+}
+
+// NewRelease builds the DEPLOYED release record from the output of `helm template`, with the hooks split from the manifest
+func NewRelease(chartName, version, releaseName, ns, manifest, description string) (*rspb.Release, error) {
+	man, hooks, err := SplitManifestAndHooks(manifest)
+	if err != nil {
+		return nil, err
+	}
 	manifestData := []byte(base64.StdEncoding.EncodeToString([]byte(man)))
 	vData := []byte(base64.StdEncoding.EncodeToString([]byte("This release is generated by helm-x")))
 	templates := []*chart.Template{
@@ -64,7 +96,7 @@ func TurnHelmTemplateToInstall(chartName, version, tillerNs, releaseName, ns, ma
 			Status: &rspb.Status{
 				Code: rspb.Status_DEPLOYED,
 			},
-			Description: fmt.Sprintf("Adopted with helm-x"),
+			Description: description,
 		},
 		Chart:    c,
 		Config:   &chart.Config{Raw: "{}"},
@@ -75,46 +107,37 @@ func TurnHelmTemplateToInstall(chartName, version, tillerNs, releaseName, ns, ma
 		Namespace: ns,
 	}
 
-	concatenated := man
-
-	for _, m := range releaseManifests {
-		releaseObj, err := m(release, tillerNs)
-		if err != nil {
-			return "", err
-		}
-
-		/// Turn the release object into JSON, and then YAML
+	return release, nil
+}
 
-		releaseJsonBytes, err := json.Marshal(releaseObj)
-		if err != nil {
-			return "", err
-		}
+func (s *ReleaseTool) BumpVersion(release *rspb.Release) (*rspb.Release, error) {
+	history, err := s.driver.History(release.Name)
+	if err != nil && !isReleaseNotFound(err) {
+		return nil, err
+	}
 
-		releaseYamlBytes, err := yaml.JSONToYAML(releaseJsonBytes)
-		if err != nil {
-			return "", err
+	// The first revision is "1", as the release is installed for the first time
+	release.Version = 1
+	for _, r := range history {
+		if r.Version >= release.Version {
+			release.Version = r.Version + 1
 		}
-
-		concatenated = concatenated + "\n---\n" + string(releaseYamlBytes)
 	}
 
-	return concatenated, nil
+	return release, nil
 }
 
-func (s *ReleaseTool) BumpVersion(release *rspb.Release) (*rspb.Release, error) {
-	latest, err := s.GetLatestRelease(release.Name)
+func (s *ReleaseTool) ReleaseToConfigMap(release *rspb.Release, tillerNs string) (interface{}, error) {
+	release, err := s.BumpVersion(release)
 	if err != nil {
 		return nil, err
 	}
-	release.Version = latest.Version + 1
 
-	return release, nil
+	return ConfigMapOf(release, tillerNs)
 }
 
-func (s *ReleaseTool) ReleaseToConfigMap(release *rspb.Release, tillerNs string) (interface{}, error) {
-	var err error
-	release, err = s.BumpVersion(release)
-
+// ConfigMapOf returns the ConfigMap that stores the revision of the release as it is, without bumping the version
+func ConfigMapOf(release *rspb.Release, tillerNs string) (interface{}, error) {
 	// Adopted from https://github.com/helm/helm/blob/90f50a11db5e81be0edd179b60a50adb9fcf3942/pkg/storage/driver/cfgmaps.go#L152-L164 with love
 	var lbs labels
 
@@ -137,9 +160,16 @@ func (s *ReleaseTool) ReleaseToConfigMap(release *rspb.Release, tillerNs string)
 }
 
 func (s *ReleaseTool) ReleaseToSecret(release *rspb.Release, tillerNs string) (interface{}, error) {
-	var err error
-	release, err = s.BumpVersion(release)
+	release, err := s.BumpVersion(release)
+	if err != nil {
+		return nil, err
+	}
+
+	return SecretOf(release, tillerNs)
+}
 
+// SecretOf returns the Secret that stores the revision of the release as it is, without bumping the version
+func SecretOf(release *rspb.Release, tillerNs string) (interface{}, error) {
 	// Adopted from https://github.com/helm/helm/blob/90f50a11db5e81be0edd179b60a50adb9fcf3942/pkg/storage/driver/secrets.go#L152-L157 with love
 
 	var lbs labels
@@ -66,9 +66,14 @@ func SplitManifestAndHooks(manifest string) (string, []*release.Hook, error) {
 			continue
 		}
 
-		hookEvent, ok := events[hook]
-		if !ok {
-			return "", nil, fmt.Errorf("unexpected hook: %s", hook)
+		// A hook can be run on multiple events, like `pre-install,pre-upgrade`
+		var hookEvents []release.Hook_Event
+		for _, h := range strings.Split(hook, ",") {
+			hookEvent, ok := events[strings.TrimSpace(h)]
+			if !ok {
+				return "", nil, fmt.Errorf("unexpected hook: %s", h)
+			}
+			hookEvents = append(hookEvents, hookEvent)
 		}
 
 		if r.Metadata.Name == "" {
@@ -80,7 +85,7 @@ func SplitManifestAndHooks(manifest string) (string, []*release.Hook, error) {
 			Kind:     r.Kind,
 			Path:     source,
 			Manifest: strings.Join(lines[1:], "\n"),
-			Events:   []release.Hook_Event{hookEvent},
+			Events:   hookEvents,
 		}
 
 		result = append(result, rh)
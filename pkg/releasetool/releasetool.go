@@ -3,6 +3,7 @@ package releasetool
 import (
 	"encoding/base64"
 	"fmt"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes/any"
 	"k8s.io/helm/pkg/kube"
 	"k8s.io/helm/pkg/proto/hapi/chart"
@@ -10,6 +11,7 @@ import (
 	"k8s.io/helm/pkg/storage"
 	"k8s.io/helm/pkg/storage/driver"
 	"k8s.io/helm/pkg/timeconv"
+	"strings"
 
 	// Required because go mod doesn't handle this transitive dep of helm
 	// and results in `kube.New(nil).KubernetesClientSet()` to fail compiling on missing KubernetesClientSet()
@@ -68,10 +70,21 @@ func NewConfigMapBackedReleaseTool(tillerNs string) (*ReleaseTool, error) {
 	}, nil
 }
 
+// NewMemoryReleaseTool returns the release tool backed by the in-memory storage, that is used in tests in place of
+// the tiller namespace
+func NewMemoryReleaseTool() *ReleaseTool {
+	return &ReleaseTool{
+		driver: storage.Init(driver.NewMemory()),
+	}
+}
+
 func (s *ReleaseTool) GetLatestRelease(name string) (*rspb.Release, error) {
 	return s.driver.Last(name)
 }
 
+// AdoptedDescription is the description of the release revisions created by AdoptRelease
+const AdoptedDescription = "Adopted with helm-x"
+
 func (s *ReleaseTool) AdoptRelease(name, ns, manifest string) error {
 	manifestData := []byte(base64.StdEncoding.EncodeToString([]byte(manifest)))
 	vData := []byte(base64.StdEncoding.EncodeToString([]byte("This release is generated by helm-x")))
@@ -106,7 +119,7 @@ func (s *ReleaseTool) AdoptRelease(name, ns, manifest string) error {
 			FirstDeployed: ts,
 			LastDeployed:  ts,
 			Status:        &rspb.Status{},
-			Description:   fmt.Sprintf("Adopted with helm-x"),
+			Description:   AdoptedDescription,
 		},
 		Config:   &chart.Config{Raw: ""},
 		Manifest: manifest,
@@ -124,6 +137,119 @@ func (s *ReleaseTool) AdoptRelease(name, ns, manifest string) error {
 	return nil
 }
 
+// AdoptIntoRelease adopts the resources in the manifest into the release.
+// When the release already has revisions, including a FAILED one left by a failed install, a new DEPLOYED revision
+// is written on top of the latest one, with the manifest appended to the latest manifest, and the deployed revisions
+// are superseded as Tiller does on upgrade. Otherwise the first revision is created with AdoptRelease.
+func (s *ReleaseTool) AdoptIntoRelease(name, ns, manifest string) error {
+	history, err := s.History(name)
+	if err != nil && !isReleaseNotFound(err) {
+		return err
+	}
+
+	var latest *rspb.Release
+	for _, r := range history {
+		if latest == nil || r.Version > latest.Version {
+			latest = r
+		}
+	}
+
+	if latest == nil {
+		return s.AdoptRelease(name, ns, manifest)
+	}
+
+	release := proto.Clone(latest).(*rspb.Release)
+	release.Manifest = latest.Manifest + manifest
+
+	ts := timeconv.Now()
+	firstDeployed := ts
+	if latest.Info != nil && latest.Info.FirstDeployed != nil {
+		firstDeployed = latest.Info.FirstDeployed
+	}
+	release.Info = &rspb.Info{
+		FirstDeployed: firstDeployed,
+		LastDeployed:  ts,
+		Status:        &rspb.Status{Code: rspb.Status_DEPLOYED},
+		Description:   AdoptedDescription,
+	}
+
+	if _, err := s.BumpVersion(release); err != nil {
+		return err
+	}
+
+	for _, r := range history {
+		if r.Info != nil && r.Info.Status != nil && r.Info.Status.Code == rspb.Status_DEPLOYED {
+			if err := s.Supersede(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.driver.Create(release)
+}
+
+// UpdateManifest replaces the manifest stored in the release revision in place.
+// The template of the dummy chart is updated as well when the revision has been created by AdoptRelease.
+func (s *ReleaseTool) UpdateManifest(release *rspb.Release, manifest string) error {
+	release.Manifest = manifest
+
+	if release.Info != nil && release.Info.Description == AdoptedDescription && release.Chart != nil {
+		for _, t := range release.Chart.Templates {
+			if t.Name == "templates/all.yaml" {
+				t.Data = []byte(base64.StdEncoding.EncodeToString([]byte(manifest)))
+			}
+		}
+	}
+
+	return s.driver.Update(release)
+}
+
 func (s *ReleaseTool) GetDeployedRelease(name string) (*rspb.Release, error) {
 	return s.driver.Deployed(name)
 }
+
+// History returns all the revisions of the release
+func (s *ReleaseTool) History(name string) ([]*rspb.Release, error) {
+	return s.driver.History(name)
+}
+
+// DeleteRelease deletes all the revisions of the release from the storage, without deleting the resources in the release
+func (s *ReleaseTool) DeleteRelease(name string) ([]*rspb.Release, error) {
+	history, err := s.driver.History(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []*rspb.Release
+
+	for _, rel := range history {
+		d, err := s.driver.Delete(name, rel.Version)
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, d)
+	}
+
+	return deleted, nil
+}
+
+// Create writes the revision of the release into the storage as it is
+func (s *ReleaseTool) Create(release *rspb.Release) error {
+	return s.driver.Create(release)
+}
+
+// Supersede marks the revision of the release as SUPERSEDED, like Tiller does to the previous revision on upgrade
+func (s *ReleaseTool) Supersede(release *rspb.Release) error {
+	release.Info.Status.Code = rspb.Status_SUPERSEDED
+	return s.driver.Update(release)
+}
+
+// isReleaseNotFound returns true when the storage returned the error because the release has no revision
+func isReleaseNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "not found")
+}
+
+// IsNotDeployed returns true when the error is returned from GetDeployedRelease because the release has never been deployed
+func IsNotDeployed(err error) bool {
+	return err != nil && strings.Contains(err.Error(), storage.NoReleasesErr)
+}
@@ -0,0 +1,3 @@
+// usage computes the CPU and memory that K8s workloads request in total, and predicts whether they fit in
+// ResourceQuotas.
+package usage
@@ -0,0 +1,160 @@
+package usage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+// Quota is a ResourceQuota with the hard limits on the resources known to helm-x
+type Quota struct {
+	Name      string
+	Namespace string
+
+	// Hard maps each of `requests.cpu`, `requests.memory`, `limits.cpu`, `limits.memory` and `pods` to the limit, in
+	// millicores for CPU, bytes for memory and the count for pods
+	Hard map[string]int64
+
+	// Scoped is true when the quota has scopes or a scope selector, which are unsupported
+	Scoped bool
+}
+
+func (q Quota) String() string {
+	return fmt.Sprintf("ResourceQuota %s/%s", q.Namespace, q.Name)
+}
+
+// hardAliases maps the keys of `spec.hard` to the ones of Hard. `cpu` and `memory` are the same as the requests
+var hardAliases = map[string]string{
+	"cpu":          RequestsCPU,
+	"memory":       RequestsMemory,
+	RequestsCPU:    RequestsCPU,
+	RequestsMemory: RequestsMemory,
+	LimitsCPU:      LimitsCPU,
+	LimitsMemory:   LimitsMemory,
+	"pods":         "pods",
+	"count/pods":   "pods",
+}
+
+// LoadQuotas loads the ResourceQuotas from the YAML file, which may contain multiple documents or a List like the output
+// of `kubectl get resourcequota -o yaml`. Quotas without `metadata.namespace` are put in defaultNamespace
+func LoadQuotas(file, defaultNamespace string) ([]Quota, error) {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := manifest.Parse(string(bs), defaultNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []*manifest.Resource
+
+	for _, res := range resources {
+		if res.Kind != "List" {
+			objs = append(objs, res)
+			continue
+		}
+
+		// Unwrap the List returned by `kubectl get resourcequota -o yaml`
+		items, _ := res.Object["items"].([]interface{})
+		for _, item := range items {
+			obj, _ := item.(map[string]interface{})
+			r, err := manifest.FromObject(obj, defaultNamespace)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse %s: %v", file, err)
+			}
+			objs = append(objs, r)
+		}
+	}
+
+	var quotas []Quota
+
+	for _, res := range objs {
+		if res.Kind != "ResourceQuota" {
+			continue
+		}
+
+		q := Quota{Name: res.Name, Namespace: res.Namespace, Hard: map[string]int64{}}
+
+		spec, _ := res.Object["spec"].(map[string]interface{})
+
+		_, scopes := spec["scopes"]
+		_, selector := spec["scopeSelector"]
+		q.Scoped = scopes || selector
+
+		hard, _ := spec["hard"].(map[string]interface{})
+		for k, v := range hard {
+			name, ok := hardAliases[k]
+			if !ok {
+				continue
+			}
+
+			qty, err := resource.ParseQuantity(fmt.Sprint(v))
+			if err != nil {
+				return nil, fmt.Errorf("%s has invalid %s %v: %v", q, k, v, err)
+			}
+
+			if name == RequestsCPU || name == LimitsCPU {
+				q.Hard[name] = qty.MilliValue()
+			} else {
+				q.Hard[name] = qty.Value()
+			}
+		}
+
+		quotas = append(quotas, q)
+	}
+
+	if len(quotas) == 0 {
+		return nil, fmt.Errorf("no ResourceQuota found in %s", file)
+	}
+
+	return quotas, nil
+}
+
+// Check predicts why creating the workloads in the namespace of the quota would fail, assuming that nothing else uses
+// the quota. That is, the total exceeding the hard limit, or the containers not specifying the resources limited by the
+// quota, which K8s refuses. Workloads in the other namespaces are ignored
+func (q Quota) Check(workloads []Workload) []string {
+	var total Amounts
+	var pods int64
+	var msgs []string
+
+	names := make([]string, 0, len(q.Hard))
+	for name := range q.Hard {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, w := range workloads {
+		if w.Resource.Namespace != q.Namespace {
+			continue
+		}
+
+		total.add(w.Total, 1)
+		pods += w.Pods
+
+		for _, name := range names {
+			for _, c := range w.Unspecified[name] {
+				msgs = append(msgs, fmt.Sprintf("%s: %s/%s container %s must specify %s", q, w.Resource.Kind, w.Resource.Name, c, name))
+			}
+		}
+	}
+
+	for _, name := range names {
+		used := total.Get(name)
+		if name == "pods" {
+			used = pods
+		}
+
+		if hard := q.Hard[name]; used > hard {
+			msgs = append(msgs, fmt.Sprintf("%s: %s %s exceeds the hard limit %s", q, name, Format(name, used), Format(name, hard)))
+		}
+	}
+
+	return msgs
+}
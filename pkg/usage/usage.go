@@ -0,0 +1,327 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+const (
+	RequestsCPU    = "requests.cpu"
+	RequestsMemory = "requests.memory"
+	LimitsCPU      = "limits.cpu"
+	LimitsMemory   = "limits.memory"
+)
+
+// Amounts is the amounts of CPU in millicores and memory in bytes, requested and limited
+type Amounts struct {
+	CPURequests    int64
+	CPULimits      int64
+	MemoryRequests int64
+	MemoryLimits   int64
+}
+
+// Get returns the amount of the resource like `requests.cpu`
+func (a Amounts) Get(name string) int64 {
+	switch name {
+	case RequestsCPU:
+		return a.CPURequests
+	case LimitsCPU:
+		return a.CPULimits
+	case RequestsMemory:
+		return a.MemoryRequests
+	case LimitsMemory:
+		return a.MemoryLimits
+	}
+	return 0
+}
+
+func (a *Amounts) add(b Amounts, times int64) {
+	a.CPURequests += b.CPURequests * times
+	a.CPULimits += b.CPULimits * times
+	a.MemoryRequests += b.MemoryRequests * times
+	a.MemoryLimits += b.MemoryLimits * times
+}
+
+func (a *Amounts) max(b Amounts) {
+	if b.CPURequests > a.CPURequests {
+		a.CPURequests = b.CPURequests
+	}
+	if b.CPULimits > a.CPULimits {
+		a.CPULimits = b.CPULimits
+	}
+	if b.MemoryRequests > a.MemoryRequests {
+		a.MemoryRequests = b.MemoryRequests
+	}
+	if b.MemoryLimits > a.MemoryLimits {
+		a.MemoryLimits = b.MemoryLimits
+	}
+}
+
+// MarshalJSON emits the amounts in the same structure and format as container resources, like
+// `{"requests":{"cpu":"500m","memory":"1Gi"},"limits":{...}}`
+func (a Amounts) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]map[string]string{
+		"requests": {"cpu": FormatCPU(a.CPURequests), "memory": FormatMemory(a.MemoryRequests)},
+		"limits":   {"cpu": FormatCPU(a.CPULimits), "memory": FormatMemory(a.MemoryLimits)},
+	})
+}
+
+// FormatCPU formats the millicores like `1500m` or `2`
+func FormatCPU(millis int64) string {
+	return resource.NewMilliQuantity(millis, resource.DecimalSI).String()
+}
+
+// FormatMemory formats the bytes like `512Mi` or `2Gi`
+func FormatMemory(bytes int64) string {
+	return resource.NewQuantity(bytes, resource.BinarySI).String()
+}
+
+// Format formats the amount of the resource like `requests.cpu`
+func Format(name string, v int64) string {
+	if strings.HasSuffix(name, ".cpu") {
+		return FormatCPU(v)
+	}
+	if strings.HasSuffix(name, ".memory") {
+		return FormatMemory(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// Workload is a resource that runs pods, along with the resources requested by its pods
+type Workload struct {
+	Resource *manifest.Resource
+
+	// Pods is the number of the pods run by the workload, like `spec.replicas` of Deployments
+	Pods int64
+
+	// Pod is the amounts of a pod, which is the larger one of the sum of the containers and the largest init container
+	// for each resource, as K8s schedules pods
+	Pod Amounts
+
+	// Total is the amounts of all the pods
+	Total Amounts
+
+	// Unspecified maps each of `requests.cpu`, `requests.memory`, `limits.cpu` and `limits.memory` to the containers
+	// that don't specify it. A container specifying only the limit is considered to request the same amount, as K8s does
+	Unspecified map[string][]string
+}
+
+// MissingRequests returns the messages for the containers that request no CPU or memory
+func (w Workload) MissingRequests() []string {
+	missing := map[string][]string{}
+	var containers []string
+
+	for _, r := range []string{RequestsCPU, RequestsMemory} {
+		for _, c := range w.Unspecified[r] {
+			if _, ok := missing[c]; !ok {
+				containers = append(containers, c)
+			}
+			missing[c] = append(missing[c], strings.TrimPrefix(r, "requests."))
+		}
+	}
+
+	var msgs []string
+	for _, c := range containers {
+		noun := "request"
+		if len(missing[c]) > 1 {
+			noun = "requests"
+		}
+		msgs = append(msgs, fmt.Sprintf("container %s has no %s %s", c, strings.Join(missing[c], " and "), noun))
+	}
+	return msgs
+}
+
+// Workloads returns the workloads among the resources, with the number of pods computed from `spec.replicas` or
+// `spec.parallelism`. DaemonSets are assumed to run a pod per node on the number of nodes.
+func Workloads(resources []*manifest.Resource, nodes int64) ([]Workload, error) {
+	var workloads []Workload
+
+	for _, res := range resources {
+		spec := res.PodSpec()
+		if spec == nil {
+			continue
+		}
+
+		w := Workload{Resource: res, Unspecified: map[string][]string{}}
+
+		var err error
+
+		switch res.Kind {
+		case "Pod":
+			w.Pods = 1
+		case "DaemonSet":
+			w.Pods = nodes
+		case "Job":
+			w.Pods, err = count(res.Object, "parallelism", "spec")
+		case "CronJob":
+			w.Pods, err = count(res.Object, "parallelism", "spec", "jobTemplate", "spec")
+		default:
+			w.Pods, err = count(res.Object, "replicas", "spec")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %v", res.Kind, res.Name, err)
+		}
+
+		var init Amounts
+		for _, c := range res.InitContainers() {
+			a, err := w.container(c)
+			if err != nil {
+				return nil, err
+			}
+			init.max(a)
+		}
+
+		inits := len(res.InitContainers())
+		for _, c := range res.Containers()[inits:] {
+			a, err := w.container(c)
+			if err != nil {
+				return nil, err
+			}
+			w.Pod.add(a, 1)
+		}
+
+		w.Pod.max(init)
+		w.Total.add(w.Pod, w.Pods)
+
+		workloads = append(workloads, w)
+	}
+
+	return workloads, nil
+}
+
+func (w *Workload) container(c map[string]interface{}) (Amounts, error) {
+	name, _ := c["name"].(string)
+
+	resources, _ := c["resources"].(map[string]interface{})
+	requests, _ := resources["requests"].(map[string]interface{})
+	limits, _ := resources["limits"].(map[string]interface{})
+
+	var a Amounts
+
+	for _, f := range []struct {
+		name     string
+		values   map[string]interface{}
+		fallback map[string]interface{}
+		key      string
+		to       *int64
+	}{
+		{RequestsCPU, requests, limits, "cpu", &a.CPURequests},
+		{RequestsMemory, requests, limits, "memory", &a.MemoryRequests},
+		{LimitsCPU, limits, nil, "cpu", &a.CPULimits},
+		{LimitsMemory, limits, nil, "memory", &a.MemoryLimits},
+	} {
+		v, ok := f.values[f.key]
+		if !ok {
+			v, ok = f.fallback[f.key]
+		}
+		if !ok {
+			w.Unspecified[f.name] = append(w.Unspecified[f.name], name)
+			continue
+		}
+
+		q, err := resource.ParseQuantity(fmt.Sprint(v))
+		if err != nil {
+			return a, fmt.Errorf("%s/%s: container %s has invalid %s %v: %v", w.Resource.Kind, w.Resource.Name, name, f.name, v, err)
+		}
+
+		if f.key == "cpu" {
+			*f.to = q.MilliValue()
+		} else {
+			*f.to = q.Value()
+		}
+	}
+
+	return a, nil
+}
+
+// count returns the integer field of the object at the path, or 1 if it's missing as the default of K8s
+func count(obj map[string]interface{}, field string, path ...string) (int64, error) {
+	cur := obj
+	for _, p := range path {
+		next, ok := cur[p].(map[string]interface{})
+		if !ok {
+			return 1, nil
+		}
+		cur = next
+	}
+
+	switch v := cur[field].(type) {
+	case nil:
+		return 1, nil
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	default:
+		return 0, fmt.Errorf("%s must be an integer, but was %v", strings.Join(append(path, field), "."), v)
+	}
+}
+
+// Summary is the total of the workloads of the kind in the namespace.
+// Kind is empty for the total of all the kinds, and Namespace is empty for the total of all the namespaces
+type Summary struct {
+	Namespace string  `json:"namespace,omitempty"`
+	Kind      string  `json:"kind,omitempty"`
+	Workloads int     `json:"workloads"`
+	Pods      int64   `json:"pods"`
+	Total     Amounts `json:"total"`
+}
+
+// Summarize returns the totals per namespace and kind, each namespace followed by its total, sorted by the namespace
+// and the kind. The grand total is appended when there are multiple namespaces
+func Summarize(workloads []Workload) []Summary {
+	byKind := map[[2]string]*Summary{}
+	byNs := map[string]*Summary{}
+	total := &Summary{}
+
+	for _, w := range workloads {
+		ns, kind := w.Resource.Namespace, w.Resource.Kind
+
+		k := [2]string{ns, kind}
+		if byKind[k] == nil {
+			byKind[k] = &Summary{Namespace: ns, Kind: kind}
+		}
+		if byNs[ns] == nil {
+			byNs[ns] = &Summary{Namespace: ns}
+		}
+
+		for _, s := range []*Summary{byKind[k], byNs[ns], total} {
+			s.Workloads++
+			s.Pods += w.Pods
+			s.Total.add(w.Total, 1)
+		}
+	}
+
+	var keys [][2]string
+	for k := range byKind {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+
+	var summaries []Summary
+	for i, k := range keys {
+		summaries = append(summaries, *byKind[k])
+		if i == len(keys)-1 || keys[i+1][0] != k[0] {
+			summaries = append(summaries, *byNs[k[0]])
+		}
+	}
+
+	if len(byNs) > 1 {
+		summaries = append(summaries, *total)
+	}
+
+	return summaries
+}
@@ -0,0 +1,176 @@
+package usage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+const testManifest = `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 3
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: app:1.0
+        resources:
+          requests:
+            cpu: "2"
+            memory: 64Mi
+      containers:
+      - name: app
+        image: app:1.0
+        resources:
+          requests:
+            cpu: 500m
+            memory: 256Mi
+          limits:
+            cpu: 1
+            memory: 512Mi
+      - name: istio-proxy
+        image: istio/proxyv2:1.3.0
+        resources:
+          limits:
+            cpu: 100m
+---
+# Source: app/templates/daemonset.yaml
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+  namespace: monitoring
+spec:
+  template:
+    spec:
+      containers:
+      - name: agent
+        image: agent:1.0
+        resources:
+          requests:
+            cpu: 100m
+            memory: 1Gi
+---
+# Source: app/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+`
+
+func testWorkloads(t *testing.T) []Workload {
+	t.Helper()
+
+	resources, err := manifest.Parse(testManifest, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workloads, err := Workloads(resources, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return workloads
+}
+
+func TestWorkloads(t *testing.T) {
+	workloads := testWorkloads(t)
+
+	if len(workloads) != 2 {
+		t.Fatalf("unexpected number of workloads: expected=2, got=%d", len(workloads))
+	}
+
+	app := workloads[0]
+
+	// The init container requests more CPU than the sum of the containers, and the sidecar requests its CPU limit
+	expected := Amounts{CPURequests: 2000, CPULimits: 1100, MemoryRequests: 256 << 20, MemoryLimits: 512 << 20}
+	if app.Pods != 3 || app.Pod != expected {
+		t.Errorf("unexpected pod of %s: pods=%d, amounts=%+v", app.Resource.Name, app.Pods, app.Pod)
+	}
+
+	if missing := app.MissingRequests(); !reflect.DeepEqual(missing, []string{"container istio-proxy has no memory request"}) {
+		t.Errorf("unexpected missing requests: %q", missing)
+	}
+
+	var actual [][]string
+	for _, s := range Summarize(workloads) {
+		actual = append(actual, []string{s.Namespace, s.Kind, FormatCPU(s.Total.CPURequests), FormatMemory(s.Total.MemoryRequests), FormatMemory(s.Total.MemoryLimits)})
+	}
+
+	expectedSummaries := [][]string{
+		{"default", "Deployment", "6", "768Mi", "1536Mi"},
+		{"default", "", "6", "768Mi", "1536Mi"},
+		{"monitoring", "DaemonSet", "200m", "2Gi", "0"},
+		{"monitoring", "", "200m", "2Gi", "0"},
+		{"", "", "6200m", "2816Mi", "1536Mi"},
+	}
+
+	if !reflect.DeepEqual(actual, expectedSummaries) {
+		t.Errorf("unexpected summaries:\nexpected=%q\ngot=%q", expectedSummaries, actual)
+	}
+}
+
+func TestQuotaCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-x-usage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "quota.yaml")
+	content := `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ResourceQuota
+  metadata:
+    name: compute
+  spec:
+    hard:
+      cpu: "4"
+      limits.memory: 2Gi
+      pods: "10"
+---
+apiVersion: v1
+kind: ResourceQuota
+metadata:
+  name: besteffort
+spec:
+  scopes:
+  - BestEffort
+  hard:
+    pods: "1"
+`
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	quotas, err := LoadQuotas(file, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(quotas) != 2 || quotas[0].Scoped || !quotas[1].Scoped {
+		t.Fatalf("unexpected quotas: %+v", quotas)
+	}
+
+	expected := []string{
+		"ResourceQuota default/compute: Deployment/app container migrate must specify limits.memory",
+		"ResourceQuota default/compute: Deployment/app container istio-proxy must specify limits.memory",
+		"ResourceQuota default/compute: requests.cpu 6 exceeds the hard limit 4",
+	}
+
+	if actual := quotas[0].Check(testWorkloads(t)); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected quota failures:\nexpected=%q\ngot=%q", expected, actual)
+	}
+}
@@ -0,0 +1,188 @@
+package validation
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// BundledKubeVersion is the K8s version of the schemas bundled with helm-x, that is the version of the K8s API types
+// helm-x is built with
+const BundledKubeVersion = "1.13"
+
+var (
+	bundledOnce sync.Once
+	bundled     *Schemas
+	bundledErr  error
+)
+
+// Bundled returns the schemas of the K8s version helm-x is built with, generated from the K8s API types
+// including the ones of `apiextensions.k8s.io`.
+//
+// Unlike the OpenAPI spec served by K8s, the required fields are not checked, as the types carry no such information.
+func Bundled() (*Schemas, error) {
+	bundledOnce.Do(func() {
+		s := runtime.NewScheme()
+
+		if bundledErr = scheme.AddToScheme(s); bundledErr != nil {
+			return
+		}
+
+		if bundledErr = apiextensionsv1beta1.AddToScheme(s); bundledErr != nil {
+			return
+		}
+
+		bundled = newSchemas(BundledKubeVersion)
+
+		b := &builder{defs: bundled.defs}
+
+		for k, t := range s.AllKnownTypes() {
+			if k.Version == runtime.APIVersionInternal {
+				continue
+			}
+			bundled.kinds[gvk{Group: k.Group, Version: k.Version, Kind: k.Kind}] = b.schemaOf(t)
+		}
+	})
+
+	if bundledErr != nil {
+		return nil, bundledErr
+	}
+
+	// Copy the set so that adding CRDs doesn't affect the later callers
+	s := newSchemas(bundled.KubeVersion)
+	s.defs = bundled.defs
+	for k, v := range bundled.kinds {
+		s.kinds[k] = v
+	}
+
+	return s, nil
+}
+
+// builder generates the schemas of Go types in the same way as the OpenAPI spec of K8s, by following their JSON tags
+type builder struct {
+	defs map[string]*Schema
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+func (b *builder) schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch defName(t) {
+	case "io.k8s.apimachinery.pkg.apis.meta.v1.Time", "io.k8s.apimachinery.pkg.apis.meta.v1.MicroTime":
+		return &Schema{Type: "string", Format: "date-time"}
+	case "io.k8s.apimachinery.pkg.apis.meta.v1.Duration":
+		return &Schema{Type: "string"}
+	case quantityDef:
+		return &Schema{Type: "string", Format: formatQuantity}
+	case "io.k8s.apimachinery.pkg.util.intstr.IntOrString":
+		return &Schema{Type: "string", Format: "int-or-string"}
+	}
+
+	// Any other type with the custom unmarshaller, like RawExtension, accepts anything
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: &schemaOrBool{Allows: true, Schema: b.schemaOf(t.Elem())}}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: &schemaOrArray{Schema: b.schemaOf(t.Elem())}}
+	case reflect.Struct:
+		name := defName(t)
+		if name == "" {
+			return b.structSchema(t)
+		}
+		if _, ok := b.defs[name]; !ok {
+			// Register the placeholder first, so that recursive types like JSONSchemaProps refer to themselves
+			def := &Schema{}
+			b.defs[name] = def
+			*def = *b.structSchema(t)
+		}
+		return &Schema{Ref: "#/definitions/" + name}
+	}
+
+	return &Schema{}
+}
+
+func (b *builder) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		items := strings.Split(tag, ",")
+		name := items[0]
+
+		var inline bool
+		for _, opt := range items[1:] {
+			inline = inline || opt == "inline"
+		}
+
+		if f.Anonymous && (inline || name == "") {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			for k, v := range b.structSchema(ft).Properties {
+				s.Properties[k] = v
+			}
+			continue
+		}
+
+		if f.PkgPath != "" {
+			// Unexported
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		s.Properties[name] = b.schemaOf(f.Type)
+	}
+
+	return s
+}
+
+// defName returns the name of the type in the OpenAPI spec of K8s, like `io.k8s.api.apps.v1.Deployment` for
+// `k8s.io/api/apps/v1.Deployment`
+func defName(t reflect.Type) string {
+	if t.Name() == "" || t.PkgPath() == "" {
+		return ""
+	}
+
+	items := strings.Split(t.PkgPath(), "/")
+
+	domain := strings.Split(items[0], ".")
+	for i, j := 0, len(domain)-1; i < j; i, j = i+1, j-1 {
+		domain[i], domain[j] = domain[j], domain[i]
+	}
+
+	return strings.Join(append(append(domain, items[1:]...), t.Name()), ".")
+}
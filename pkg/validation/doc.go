@@ -0,0 +1,3 @@
+// validation checks K8s resources against the OpenAPI schemas of the target K8s version and the CRDs, without
+// connecting to a cluster, so that invalid manifests are caught before they're applied.
+package validation
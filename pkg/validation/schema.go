@@ -0,0 +1,343 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+// Schema is the subset of the OpenAPI v2 and v3 schema object that is used by K8s and CRDs
+type Schema struct {
+	Ref    string `json:"$ref,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Format string `json:"format,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *schemaOrBool      `json:"additionalProperties,omitempty"`
+	Items                *schemaOrArray     `json:"items,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+
+	AllOf []*Schema `json:"allOf,omitempty"`
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+	OneOf []*Schema `json:"oneOf,omitempty"`
+
+	PreserveUnknownFields bool `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+	IntOrString           bool `json:"x-kubernetes-int-or-string,omitempty"`
+	EmbeddedResource      bool `json:"x-kubernetes-embedded-resource,omitempty"`
+
+	GroupVersionKinds []gvk `json:"x-kubernetes-group-version-kind,omitempty"`
+}
+
+type gvk struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+func (k gvk) String() string {
+	if k.Group == "" {
+		return fmt.Sprintf("%s/%s", k.Version, k.Kind)
+	}
+	return fmt.Sprintf("%s/%s/%s", k.Group, k.Version, k.Kind)
+}
+
+func gvkOf(apiVersion, kind string) gvk {
+	k := gvk{Version: apiVersion, Kind: kind}
+	if i := strings.Index(apiVersion, "/"); i >= 0 {
+		k.Group, k.Version = apiVersion[:i], apiVersion[i+1:]
+	}
+	return k
+}
+
+// schemaOrBool is either a schema, or `true` to allow any value, or `false` to allow nothing
+type schemaOrBool struct {
+	Allows bool
+	Schema *Schema
+}
+
+func (s *schemaOrBool) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &s.Allows); err == nil {
+		return nil
+	}
+	s.Allows = true
+	return json.Unmarshal(data, &s.Schema)
+}
+
+// schemaOrArray is either a schema for all the items, or the list of schemas for the items at the same positions
+type schemaOrArray struct {
+	Schema  *Schema
+	Schemas []*Schema
+}
+
+func (s *schemaOrArray) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &s.Schemas); err == nil {
+		return nil
+	}
+	return json.Unmarshal(data, &s.Schema)
+}
+
+func (s *schemaOrArray) at(i int) *Schema {
+	if s == nil {
+		return nil
+	}
+	if s.Schema != nil {
+		return s.Schema
+	}
+	if i < len(s.Schemas) {
+		return s.Schemas[i]
+	}
+	return nil
+}
+
+const (
+	objectMetaDef  = "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"
+	quantityDef    = "io.k8s.apimachinery.pkg.api.resource.Quantity"
+	formatQuantity = "quantity"
+)
+
+// Schemas is the set of the schemas of the K8s kinds, optionally extended with the ones of the CRDs
+type Schemas struct {
+	// KubeVersion is the K8s version the schemas came from
+	KubeVersion string
+
+	defs  map[string]*Schema
+	kinds map[gvk]*Schema
+
+	// crds is the set of the kinds defined by CRDs, whose apiVersion, kind and metadata are validated by K8s itself
+	crds map[gvk]bool
+}
+
+func newSchemas(kubeVersion string) *Schemas {
+	return &Schemas{
+		KubeVersion: kubeVersion,
+		defs:        map[string]*Schema{},
+		kinds:       map[gvk]*Schema{},
+		crds:        map[gvk]bool{},
+	}
+}
+
+// LoadOpenAPI loads the schemas from the OpenAPI v2 spec of K8s, that is the `swagger.json` served by the API server at
+// `/openapi/v2` or found at `api/openapi-spec/swagger.json` in the K8s repository
+func LoadOpenAPI(file, kubeVersion string) (*Schemas, error) {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var spec struct {
+		Definitions map[string]*Schema `json:"definitions"`
+	}
+
+	if err := json.Unmarshal(bs, &spec); err != nil {
+		return nil, fmt.Errorf("unable to parse OpenAPI spec %s: %v", file, err)
+	}
+
+	if len(spec.Definitions) == 0 {
+		return nil, fmt.Errorf("unable to load OpenAPI spec %s: no definitions found", file)
+	}
+
+	s := newSchemas(kubeVersion)
+	s.defs = spec.Definitions
+
+	if q, ok := s.defs[quantityDef]; ok {
+		q.Format = formatQuantity
+	}
+
+	for _, def := range s.defs {
+		for _, k := range def.GroupVersionKinds {
+			s.kinds[k] = def
+		}
+	}
+
+	return s, nil
+}
+
+// Load returns the schemas of the K8s version, from `DIR/<kubeVersion>/swagger.json` or `DIR/swagger.json` when dir is
+// set, or the bundled ones otherwise.
+func Load(dir, kubeVersion string) (*Schemas, error) {
+	if dir == "" {
+		if kubeVersion != "" && !sameMinor(kubeVersion, BundledKubeVersion) {
+			return nil, fmt.Errorf("no schemas bundled for K8s %s: only %s is bundled. Download swagger.json of the version and specify the directory containing it with --schema-dir", kubeVersion, BundledKubeVersion)
+		}
+		return Bundled()
+	}
+
+	var candidates []string
+	if kubeVersion != "" {
+		for _, v := range uniq(strings.TrimPrefix(kubeVersion, "v"), minorOf(kubeVersion)) {
+			candidates = append(candidates, filepath.Join(dir, v, "swagger.json"), filepath.Join(dir, "v"+v, "swagger.json"))
+		}
+	}
+	candidates = append(candidates, filepath.Join(dir, "swagger.json"))
+
+	for _, f := range candidates {
+		if _, err := os.Stat(f); err == nil {
+			return LoadOpenAPI(f, kubeVersion)
+		}
+	}
+
+	return nil, fmt.Errorf("no OpenAPI spec found for K8s %s: tried %s", kubeVersion, strings.Join(candidates, ", "))
+}
+
+// minorOf returns the major and minor versions like `1.13` of the version like `v1.13.4`
+func minorOf(v string) string {
+	v = strings.TrimPrefix(v, "v")
+	items := strings.SplitN(v, ".", 3)
+	if len(items) < 2 {
+		return v
+	}
+	return items[0] + "." + items[1]
+}
+
+func sameMinor(a, b string) bool {
+	return minorOf(a) == minorOf(b)
+}
+
+func uniq(items ...string) []string {
+	var res []string
+	seen := map[string]bool{}
+	for _, i := range items {
+		if !seen[i] {
+			seen[i] = true
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// AddCRD adds the schemas of the custom resources defined by the CRD, from either `spec.validation.openAPIV3Schema` of
+// `apiextensions.k8s.io/v1beta1` or `spec.versions[].schema.openAPIV3Schema` of both `v1beta1` and `v1`.
+//
+// The versions without a schema are still added, so that their custom resources are not reported as unknown kinds.
+func (s *Schemas) AddCRD(res *manifest.Resource) error {
+	if res.Kind != "CustomResourceDefinition" {
+		return fmt.Errorf("%s/%s is not a CustomResourceDefinition", res.Kind, res.Name)
+	}
+
+	spec, _ := res.Object["spec"].(map[string]interface{})
+	group, _ := spec["group"].(string)
+	names, _ := spec["names"].(map[string]interface{})
+	kind, _ := names["kind"].(string)
+
+	if group == "" || kind == "" {
+		return fmt.Errorf("CustomResourceDefinition %s has no spec.group or spec.names.kind", res.Name)
+	}
+
+	var common *Schema
+	if v, ok := spec["validation"].(map[string]interface{}); ok {
+		sc, err := toSchema(v["openAPIV3Schema"])
+		if err != nil {
+			return fmt.Errorf("CustomResourceDefinition %s: spec.validation.openAPIV3Schema: %v", res.Name, err)
+		}
+		common = sc
+	}
+
+	versions := map[string]*Schema{}
+	if v, ok := spec["version"].(string); ok && v != "" {
+		versions[v] = common
+	}
+
+	items, _ := spec["versions"].([]interface{})
+	for i, item := range items {
+		v, _ := item.(map[string]interface{})
+		name, _ := v["name"].(string)
+		if name == "" {
+			continue
+		}
+
+		sc := common
+		if schema, ok := v["schema"].(map[string]interface{}); ok {
+			var err error
+			sc, err = toSchema(schema["openAPIV3Schema"])
+			if err != nil {
+				return fmt.Errorf("CustomResourceDefinition %s: spec.versions[%d].schema.openAPIV3Schema: %v", res.Name, i, err)
+			}
+		}
+		versions[name] = sc
+	}
+
+	for v, sc := range versions {
+		k := gvk{Group: group, Version: v, Kind: kind}
+		if sc == nil {
+			// Any field is allowed in a custom resource without schema
+			sc = &Schema{}
+		}
+		s.kinds[k] = sc
+		s.crds[k] = true
+	}
+
+	return nil
+}
+
+// AddCRDs adds the schemas of all the CRDs among the resources
+func (s *Schemas) AddCRDs(resources []*manifest.Resource) error {
+	for _, res := range resources {
+		if res.Kind != "CustomResourceDefinition" {
+			continue
+		}
+		if err := s.AddCRD(res); err != nil {
+			return fmt.Errorf("%v\nSource: %s", err, sourceOf(res))
+		}
+	}
+	return nil
+}
+
+// LoadCRDDir adds the schemas of the CRDs found in the YAML and JSON files under the directory
+func (s *Schemas) LoadCRDDir(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		resources, err := manifest.Parse(string(bs), "")
+		if err != nil {
+			return fmt.Errorf("unable to parse %s: %v", path, err)
+		}
+
+		for _, res := range resources {
+			if res.Source == "" {
+				res.Source = path
+			}
+		}
+
+		return s.AddCRDs(resources)
+	})
+}
+
+func toSchema(v interface{}) (*Schema, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var sc Schema
+	if err := json.Unmarshal(bs, &sc); err != nil {
+		return nil, err
+	}
+
+	return &sc, nil
+}
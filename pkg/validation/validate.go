@@ -0,0 +1,250 @@
+package validation
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+// ResourceError is the list of the problems found in a resource
+type ResourceError struct {
+	Resource *manifest.Resource
+	Problems []string
+}
+
+func (e *ResourceError) Error() string {
+	return fmt.Sprintf("%s/%s is invalid:\n  %s\nSource: %s", e.Resource.Kind, e.Resource.Name, strings.Join(e.Problems, "\n  "), sourceOf(e.Resource))
+}
+
+func sourceOf(res *manifest.Resource) string {
+	if res.Source == "" {
+		return "unknown"
+	}
+	return res.Source
+}
+
+// HasSchema returns true when the schema of the kind of the resource is known
+func (s *Schemas) HasSchema(res *manifest.Resource) bool {
+	_, ok := s.kinds[gvkOf(res.APIVersion, res.Kind)]
+	return ok
+}
+
+// Validate returns the problems found in the resource, like unknown fields and values of wrong types, each prefixed with
+// the path to the field like `spec.template.spec.containers[0].image`
+func (s *Schemas) Validate(res *manifest.Resource) []string {
+	k := gvkOf(res.APIVersion, res.Kind)
+
+	sc, ok := s.kinds[k]
+	if !ok {
+		return []string{fmt.Sprintf("no schema found for %s in K8s %s", k, s.KubeVersion)}
+	}
+
+	v := &validator{defs: s.defs}
+
+	if !s.crds[k] {
+		v.validate("", res.Object, sc)
+		return v.problems
+	}
+
+	// apiVersion, kind and metadata of custom resources are validated by K8s rather than the CRD
+	obj := map[string]interface{}{}
+	for key, val := range res.Object {
+		switch key {
+		case "apiVersion", "kind":
+		case "metadata":
+			if meta, ok := s.defs[objectMetaDef]; ok {
+				v.validate("metadata", val, meta)
+			}
+		default:
+			obj[key] = val
+		}
+	}
+
+	v.validate("", obj, sc)
+
+	return v.problems
+}
+
+// ValidateResources validates all the resources, and returns an error listing every invalid resource along with its
+// source template. Resources of unknown kinds are reported unless ignoreMissingSchemas is true.
+func (s *Schemas) ValidateResources(resources []*manifest.Resource, ignoreMissingSchemas bool) error {
+	var errs []string
+
+	for _, res := range resources {
+		if ignoreMissingSchemas && !s.HasSchema(res) {
+			continue
+		}
+
+		if problems := s.Validate(res); len(problems) > 0 {
+			errs = append(errs, (&ResourceError{Resource: res, Problems: problems}).Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d resource(s) are invalid against the schemas of K8s %s:\n%s", len(errs), s.KubeVersion, strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
+
+type validator struct {
+	defs     map[string]*Schema
+	problems []string
+}
+
+func (v *validator) errorf(path, format string, args ...interface{}) {
+	if path == "" {
+		path = "<root>"
+	}
+	v.problems = append(v.problems, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) resolve(sc *Schema) *Schema {
+	for i := 0; sc != nil && sc.Ref != "" && i < 32; i++ {
+		def, ok := v.defs[strings.TrimPrefix(sc.Ref, "#/definitions/")]
+		if !ok {
+			// Unresolvable references accept anything, rather than failing on a partial spec
+			return nil
+		}
+		sc = def
+	}
+	return sc
+}
+
+func (v *validator) validate(path string, val interface{}, sc *Schema) {
+	sc = v.resolve(sc)
+	if sc == nil || val == nil {
+		return
+	}
+
+	for _, s := range sc.AllOf {
+		v.validate(path, val, s)
+	}
+
+	if sc.IntOrString || sc.Format == "int-or-string" {
+		if t := typeOf(val); t != "string" && t != "integer" {
+			v.errorf(path, "expected integer or string, got %s", t)
+		}
+		return
+	}
+
+	if sc.Format == formatQuantity {
+		if t := typeOf(val); t != "string" && t != "integer" && t != "number" {
+			v.errorf(path, "expected quantity, got %s", t)
+		}
+		return
+	}
+
+	typ := sc.Type
+	if typ == "" && sc.Properties != nil {
+		typ = "object"
+	}
+
+	switch typ {
+	case "":
+		// Any value is allowed
+	case "object":
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			v.errorf(path, "expected object, got %s", typeOf(val))
+			return
+		}
+		v.validateObject(path, m, sc)
+	case "array":
+		items, ok := val.([]interface{})
+		if !ok {
+			v.errorf(path, "expected array, got %s", typeOf(val))
+			return
+		}
+		for i, item := range items {
+			v.validate(fmt.Sprintf("%s[%d]", path, i), item, sc.Items.at(i))
+		}
+	case "integer":
+		if t := typeOf(val); t != "integer" {
+			v.errorf(path, "expected integer, got %s", t)
+		}
+	case "number":
+		if t := typeOf(val); t != "integer" && t != "number" {
+			v.errorf(path, "expected number, got %s", t)
+		}
+	default:
+		if t := typeOf(val); t != typ {
+			v.errorf(path, "expected %s, got %s", typ, t)
+		}
+	}
+}
+
+func (v *validator) validateObject(path string, m map[string]interface{}, sc *Schema) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		p := k
+		if path != "" {
+			p = path + "." + k
+		}
+
+		if prop, ok := sc.Properties[k]; ok {
+			v.validate(p, m[k], prop)
+			continue
+		}
+
+		switch {
+		case sc.AdditionalProperties != nil:
+			if !sc.AdditionalProperties.Allows {
+				v.errorf(p, "unknown field")
+			} else {
+				v.validate(p, m[k], sc.AdditionalProperties.Schema)
+			}
+		case sc.EmbeddedResource && (k == "apiVersion" || k == "kind" || k == "metadata"):
+		case sc.PreserveUnknownFields, len(sc.Properties) == 0, len(sc.AnyOf) > 0, len(sc.OneOf) > 0:
+			// Objects without properties, like the ones of CRDs without structural schemas, accept any field
+		default:
+			v.errorf(p, "unknown field")
+		}
+	}
+
+	for _, r := range sc.Required {
+		if _, ok := m[r]; !ok {
+			p := r
+			if path != "" {
+				p = path + "." + r
+			}
+			v.errorf(p, "missing required field")
+		}
+	}
+}
+
+func typeOf(val interface{}) string {
+	switch x := val.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string, time.Time:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "integer"
+	case float32:
+		return numberType(float64(x))
+	case float64:
+		return numberType(x)
+	}
+	return fmt.Sprintf("%T", val)
+}
+
+func numberType(f float64) string {
+	if f == math.Trunc(f) && !math.IsInf(f, 0) {
+		return "integer"
+	}
+	return "number"
+}
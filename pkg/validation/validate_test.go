@@ -0,0 +1,198 @@
+package validation
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mumoshu/helm-x/pkg/manifest"
+)
+
+const testManifest = `---
+# Source: x/templates/foo.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+  labels:
+    app: foo
+spec:
+  replicas: "2"
+  selector:
+    matchLabels:
+      app: foo
+  template:
+    metadata:
+      labels:
+        app: foo
+    spec:
+      containers:
+      - name: foo
+        image: foo:1.0
+        imagePullPolicyy: Always
+        ports:
+        - containerPort: http
+        resources:
+          limits:
+            cpu: 0.5
+            memory: 64Mi
+---
+# Source: x/templates/crd.yaml
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  version: v1
+  names:
+    kind: Widget
+    plural: widgets
+  validation:
+    openAPIV3Schema:
+      properties:
+        spec:
+          type: object
+          required:
+          - size
+          properties:
+            size:
+              type: integer
+            labels:
+              type: object
+              additionalProperties:
+                type: string
+---
+# Source: x/templates/widget.yaml
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: w
+  labelz: {}
+spec:
+  color: red
+  labels:
+    a: 1
+---
+# Source: x/templates/unknown.yaml
+apiVersion: example.com/v2
+kind: Gadget
+metadata:
+  name: g
+`
+
+func TestValidate(t *testing.T) {
+	resources, err := manifest.Parse(testManifest, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Bundled()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.AddCRDs(resources); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{
+		{
+			`spec.replicas: expected integer, got string`,
+			`spec.template.spec.containers[0].imagePullPolicyy: unknown field`,
+			`spec.template.spec.containers[0].ports[0].containerPort: expected integer, got string`,
+		},
+		nil,
+		{
+			`metadata.labelz: unknown field`,
+			`spec.color: unknown field`,
+			`spec.labels.a: expected string, got integer`,
+			`spec.size: missing required field`,
+		},
+		{
+			`no schema found for example.com/v2/Gadget in K8s 1.13`,
+		},
+	}
+
+	for i, res := range resources {
+		if actual := s.Validate(res); !reflect.DeepEqual(actual, expected[i]) {
+			t.Errorf("unexpected problems of %s:\nexpected=%q\ngot=%q", res.Source, expected[i], actual)
+		}
+	}
+
+	if err := s.ValidateResources(resources[3:], true); err != nil {
+		t.Errorf("unexpected error on ignoring missing schemas: %v", err)
+	}
+
+	expectedErr := `1 resource(s) are invalid against the schemas of K8s 1.13:
+Gadget/g is invalid:
+  no schema found for example.com/v2/Gadget in K8s 1.13
+Source: x/templates/unknown.yaml`
+
+	if err := s.ValidateResources(resources[3:], false); err == nil || err.Error() != expectedErr {
+		t.Errorf("unexpected error:\nexpected=%s\ngot=%v", expectedErr, err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-x-validation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spec := `{
+  "definitions": {
+    "io.k8s.api.core.v1.ConfigMap": {
+      "required": ["data"],
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "data": {"type": "object", "additionalProperties": {"type": "string"}}
+      },
+      "x-kubernetes-group-version-kind": [{"group": "", "kind": "ConfigMap", "version": "v1"}]
+    },
+    "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+      "properties": {"name": {"type": "string"}}
+    }
+  }
+}`
+
+	if err := os.MkdirAll(filepath.Join(dir, "1.16"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "1.16", "swagger.json"), []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(dir, "1.15"); err == nil {
+		t.Error("expected error for the missing version, got none")
+	}
+
+	if _, err := Load("", "1.16"); err == nil {
+		t.Error("expected error for the version not bundled, got none")
+	}
+
+	s, err := Load(dir, "v1.16.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err := manifest.Parse("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: c\n  namespace: x\n", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`metadata.namespace: unknown field`,
+		`data: missing required field`,
+	}
+
+	if actual := s.Validate(resources[0]); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected problems:\nexpected=%q\ngot=%q", expected, actual)
+	}
+}